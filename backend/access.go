@@ -0,0 +1,159 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// --- League Access ---
+//
+// Every league-scoped route resolves the caller's relationship to the
+// league before its handler runs. Members (anyone with a team, plus the
+// league's commissioners) can use everything their role allows. Leagues
+// are private by default; a public league can also be read, but not
+// changed, by any signed-in user. Chat, trades and invites stay members
+// only either way.
+
+const (
+	errLeaguePrivate = "LEAGUE_PRIVATE"
+	errAuthRequired  = "AUTH_REQUIRED"
+)
+
+// leagueAccess is the caller's standing in a league.
+type leagueAccess struct {
+	LeagueID   int
+	UserID     int
+	TeamID     int    // 0 when the caller has no team
+	Role       string // "owner", "commissioner", "member" or "viewer"
+	Visibility string // "private" or "public"
+}
+
+func (a *leagueAccess) member() bool {
+	return a.Role != "viewer"
+}
+
+// resolveLeagueAccess works out what userID may do in a league. It fails
+// only when the league doesn't exist.
+func resolveLeagueAccess(leagueID, userID int) (*leagueAccess, error) {
+	a := &leagueAccess{LeagueID: leagueID, UserID: userID, Role: "viewer"}
+	var ownerID int
+	if err := db.QueryRow("SELECT owner_id, visibility FROM leagues WHERE id = ?", leagueID).Scan(&ownerID, &a.Visibility); err != nil {
+		return nil, newAPIError(404, errLeagueNotFound, "League not found")
+	}
+	a.TeamID, _ = leagueTeamOf(leagueID, userID)
+	switch {
+	case userID != 0 && ownerID == userID:
+		a.Role = "owner"
+	case userID != 0 && isCommissioner(leagueID, userID):
+		a.Role = "commissioner"
+	case a.TeamID != 0:
+		a.Role = "member"
+	}
+	return a, nil
+}
+
+// allow reports whether the caller may make this request. Viewers of a
+// public league get read-only access.
+func (a *leagueAccess) allow(membersOnly bool, method string) error {
+	if a.member() {
+		return nil
+	}
+	if !membersOnly && a.Visibility == "public" && method == fiber.MethodGet {
+		return nil
+	}
+	if a.Visibility == "public" {
+		return newAPIError(403, errNotInLeague, "You don't have a team in this league")
+	}
+	return newAPIError(403, errLeaguePrivate, "This league is private")
+}
+
+func leagueAccessMiddleware(membersOnly bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		leagueID, _ := strconv.Atoi(c.Params("id"))
+		a, err := resolveLeagueAccess(leagueID, getUserID(c))
+		if err != nil {
+			return err
+		}
+		if err := a.allow(membersOnly, c.Method()); err != nil {
+			return err
+		}
+		c.Locals("league_access", a)
+		return c.Next()
+	}
+}
+
+// leagueViewer guards routes that public leagues show to everyone;
+// leagueMember guards routes only members can use.
+var (
+	leagueViewer = leagueAccessMiddleware(false)
+	leagueMember = leagueAccessMiddleware(true)
+)
+
+// teamViewer guards /teams/:id routes by the team's league.
+func teamViewer(c *fiber.Ctx) error {
+	teamID, _ := strconv.Atoi(c.Params("id"))
+	leagueID, _, err := loadTeam(teamID)
+	if err != nil {
+		return err
+	}
+	a, err := resolveLeagueAccess(leagueID, getUserID(c))
+	if err != nil {
+		return err
+	}
+	if err := a.allow(false, c.Method()); err != nil {
+		return err
+	}
+	c.Locals("league_access", a)
+	return c.Next()
+}
+
+// getLeagueAccess returns what the access middleware resolved.
+func getLeagueAccess(c *fiber.Ctx) *leagueAccess {
+	a, _ := c.Locals("league_access").(*leagueAccess)
+	return a
+}
+
+// userIDFromToken validates a JWT and returns its user, or 0.
+func userIDFromToken(tokenStr string) int {
+	if tokenStr == "" {
+		return 0
+	}
+	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	})
+	if err != nil || !token.Valid {
+		return 0
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	id, _ := claims["user_id"].(float64)
+	return int(id)
+}
+
+// wsLeagueAccess authorizes a WebSocket upgrade for :leagueId. Browsers
+// can't set headers on WebSocket requests, so the token comes in ?token=.
+func wsLeagueAccess(membersOnly bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token := c.Query("token")
+		if token == "" {
+			token = strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+		}
+		userID := userIDFromToken(token)
+		if userID == 0 {
+			return newAPIError(401, errAuthRequired, "Authentication required")
+		}
+		leagueID, _ := strconv.Atoi(c.Params("leagueId"))
+		a, err := resolveLeagueAccess(leagueID, userID)
+		if err != nil {
+			return err
+		}
+		if err := a.allow(membersOnly, fiber.MethodGet); err != nil {
+			return err
+		}
+		c.Locals("user_id", userID)
+		c.Locals("league_access", a)
+		return c.Next()
+	}
+}
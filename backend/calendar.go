@@ -0,0 +1,156 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// --- League Calendar ---
+//
+// Transactions are bounded by the league's season window and its
+// trade_deadline, waiver_cutoff and roster_lock_dates settings. All dates
+// are YYYY-MM-DD and inclusive: a deadline of 2026-08-31 still allows
+// trades on the 31st. Roster lock dates freeze every roster change for
+// that day.
+
+const (
+	errSeasonOver          = "SEASON_OVER"
+	errTradeDeadlinePassed = "TRADE_DEADLINE_PASSED"
+	errWaiverCutoffPassed  = "WAIVER_CUTOFF_PASSED"
+	errRosterLocked        = "ROSTER_LOCKED"
+)
+
+type leagueCalendar struct {
+	LeagueID                    int
+	SeasonStart, SeasonEnd      string
+	TradeDeadline, WaiverCutoff string
+	RosterLocks                 []string
+	// DraftDate is the day of the draft, if one is scheduled.
+	DraftDate string
+}
+
+func loadLeagueCalendar(leagueID int) (*leagueCalendar, error) {
+	cal := leagueCalendar{LeagueID: leagueID}
+	var locks string
+	err := db.QueryRow("SELECT season_start, season_end, trade_deadline, waiver_cutoff, roster_lock_dates, COALESCE(draft_date, '') FROM leagues WHERE id = ?", leagueID).
+		Scan(&cal.SeasonStart, &cal.SeasonEnd, &cal.TradeDeadline, &cal.WaiverCutoff, &locks, &cal.DraftDate)
+	if err != nil {
+		return nil, newAPIError(404, errLeagueNotFound, "League not found")
+	}
+	if len(cal.DraftDate) > 10 {
+		cal.DraftDate = cal.DraftDate[:10]
+	}
+	cal.RosterLocks = splitDates(locks)
+	return &cal, nil
+}
+
+func today() string {
+	return time.Now().UTC().Format("2006-01-02")
+}
+
+// rosterLockedToday reports whether today is one of the league's roster
+// lock dates.
+func rosterLockedToday(leagueID int) bool {
+	cal, err := loadLeagueCalendar(leagueID)
+	return err == nil && cal.rosterLocked(today())
+}
+
+func (cal *leagueCalendar) rosterLocked(day string) bool {
+	for _, d := range cal.RosterLocks {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// allows reports whether a transaction of the given kind ("trade",
+// "waiver" or "drop") may happen today, returning the reason if not.
+func (cal *leagueCalendar) allows(kind string) error {
+	day := today()
+	if cal.SeasonEnd != "" && day > cal.SeasonEnd {
+		return newAPIError(400, errSeasonOver, "The season has ended").with("season_end", cal.SeasonEnd)
+	}
+	if kind == "trade" && cal.TradeDeadline != "" && day > cal.TradeDeadline {
+		return newAPIError(400, errTradeDeadlinePassed, "The trade deadline has passed").with("trade_deadline", cal.TradeDeadline)
+	}
+	if kind == "waiver" && cal.WaiverCutoff != "" && day > cal.WaiverCutoff {
+		return newAPIError(400, errWaiverCutoffPassed, "The waiver cutoff has passed").with("waiver_cutoff", cal.WaiverCutoff)
+	}
+	if cal.rosterLocked(day) {
+		return newAPIError(400, errRosterLocked, "Rosters are locked today").with("date", day)
+	}
+	return nil
+}
+
+// requireTransactionWindow loads the league calendar and checks it allows
+// a transaction of the given kind today.
+func requireTransactionWindow(leagueID int, kind string) error {
+	cal, err := loadLeagueCalendar(leagueID)
+	if err != nil {
+		return err
+	}
+	return cal.allows(kind)
+}
+
+func getLeagueCalendar(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	cal, err := loadLeagueCalendar(leagueID)
+	if err != nil {
+		return err
+	}
+
+	events := []fiber.Map{}
+	add := func(date, kind, label string) {
+		if date != "" {
+			events = append(events, fiber.Map{"date": date, "type": kind, "label": label})
+		}
+	}
+	add(cal.DraftDate, "draft", "Draft")
+	add(cal.SeasonStart, "season_start", "Season starts")
+	add(cal.SeasonEnd, "season_end", "Season ends")
+	add(cal.TradeDeadline, "trade_deadline", "Trade deadline")
+	add(cal.WaiverCutoff, "waiver_cutoff", "Waiver cutoff")
+	for _, d := range cal.RosterLocks {
+		add(d, "roster_lock", "Rosters locked")
+	}
+
+	rows, err := db.Query(`SELECT m.id, m.title, m.release_date, t.id, t.name
+		FROM roster r JOIN teams t ON t.id = r.team_id JOIN movies m ON m.id = r.movie_id
+		WHERE t.league_id = ? AND m.release_date IS NOT NULL AND m.release_date != ''`, leagueID)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	for rows.Next() {
+		var movieID, teamID int
+		var title, releaseDate, teamName string
+		rows.Scan(&movieID, &title, &releaseDate, &teamID, &teamName)
+		events = append(events, fiber.Map{
+			"date": releaseDate, "type": "movie_release", "label": title + " releases",
+			"movie_id": movieID, "movie_title": title, "team_id": teamID, "team_name": teamName,
+		})
+	}
+	rows.Close()
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i]["date"].(string) < events[j]["date"].(string)
+	})
+
+	return c.JSON(fiber.Map{
+		"league_id":      leagueID,
+		"today":          today(),
+		"draft_date":     cal.DraftDate,
+		"season_start":   cal.SeasonStart,
+		"season_end":     cal.SeasonEnd,
+		"trade_deadline": cal.TradeDeadline,
+		"waiver_cutoff":  cal.WaiverCutoff,
+		"roster_locks":   cal.RosterLocks,
+		"trades_open":    cal.allows("trade") == nil,
+		"waivers_open":   cal.allows("waiver") == nil,
+		"roster_locked":  cal.rosterLocked(today()),
+		"events":         events,
+	})
+}
@@ -0,0 +1,622 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// --- Commissioner Tools ---
+//
+// The league owner (leagues.owner_id) can appoint co-commissioners, who get
+// every commissioner power except managing commissioners and handing the
+// league on. Commissioners can remove or replace team owners, force or
+// reverse transactions and edit any roster.
+//
+// Removing an owner once the draft has started leaves the team orphaned: it
+// is held by a placeholder user (users.is_system) until the commissioner
+// hands it to someone new. Before the draft the team is simply deleted.
+//
+// Every commissioner action is written to league_audit_log, which anyone
+// who can see the league can read.
+
+const (
+	errNotLeagueOwner  = "NOT_LEAGUE_OWNER"
+	errUserNotFound    = "USER_NOT_FOUND"
+	errTeamNotFound    = "TEAM_NOT_FOUND"
+	errAlreadyInLeague = "ALREADY_IN_LEAGUE"
+	errNotReversible   = "NOT_REVERSIBLE"
+)
+
+func isLeagueOwner(leagueID, userID int) bool {
+	var ownerID int
+	db.QueryRow("SELECT owner_id FROM leagues WHERE id = ?", leagueID).Scan(&ownerID)
+	return ownerID != 0 && ownerID == userID
+}
+
+// logLeagueAction records a commissioner action in the league's audit log.
+// teamID is 0 when the action isn't about one team.
+func logLeagueAction(ex execer, leagueID, userID int, action string, teamID int, details string) {
+	var team interface{}
+	if teamID != 0 {
+		team = teamID
+	}
+	ex.Exec("INSERT INTO league_audit_log (league_id, user_id, action, team_id, details) VALUES (?, ?, ?, ?, ?)",
+		leagueID, userID, action, team, details)
+}
+
+// requireCommissioner loads the league and checks the caller runs it.
+func requireCommissioner(c *fiber.Ctx, leagueID int) (status string, err error) {
+	if err := db.QueryRow("SELECT status FROM leagues WHERE id = ?", leagueID).Scan(&status); err != nil {
+		return "", newAPIError(404, errLeagueNotFound, "League not found")
+	}
+	if !isCommissioner(leagueID, getUserID(c)) {
+		return "", newAPIError(403, errNotCommissioner, "Only a commissioner can do this")
+	}
+	return status, nil
+}
+
+// userRef identifies a user by id or email in a request body.
+type userRef struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+// resolve finds the referenced user. Placeholder users can't be chosen.
+func (r userRef) resolve() (id int, name string, err error) {
+	var isSystem bool
+	if r.UserID != 0 {
+		err = db.QueryRow("SELECT id, display_name, is_system FROM users WHERE id = ?", r.UserID).Scan(&id, &name, &isSystem)
+	} else if r.Email != "" {
+		err = db.QueryRow("SELECT id, display_name, is_system FROM users WHERE email = ?", strings.TrimSpace(r.Email)).Scan(&id, &name, &isSystem)
+	} else {
+		return 0, "", newAPIError(400, "INVALID_REQUEST", "user_id or email required")
+	}
+	if err != nil || isSystem {
+		return 0, "", newAPIError(404, errUserNotFound, "User not found")
+	}
+	return id, name, nil
+}
+
+func leagueTeamOf(leagueID, userID int) (int, bool) {
+	var teamID int
+	err := db.QueryRow("SELECT id FROM teams WHERE league_id = ? AND user_id = ?", leagueID, userID).Scan(&teamID)
+	return teamID, err == nil
+}
+
+// loadTeam returns a team's league and owner.
+func loadTeam(teamID int) (leagueID, ownerID int, err error) {
+	if err := db.QueryRow("SELECT league_id, user_id FROM teams WHERE id = ?", teamID).Scan(&leagueID, &ownerID); err != nil {
+		return 0, 0, newAPIError(404, errTeamNotFound, "Team not found")
+	}
+	return leagueID, ownerID, nil
+}
+
+// orphanUser returns the placeholder user that holds a team without an
+// owner, creating it the first time the team is orphaned.
+func orphanUser(tx *sql.Tx, teamID int) (int, error) {
+	email := fmt.Sprintf("orphan-team-%d@system.invalid", teamID)
+	// "!" is never a valid bcrypt hash, so nobody can log in as it.
+	if _, err := tx.Exec("INSERT OR IGNORE INTO users (email, password_hash, display_name, is_system) VALUES (?, '!', 'Orphaned', 1)", email); err != nil {
+		return 0, err
+	}
+	var id int
+	err := tx.QueryRow("SELECT id FROM users WHERE email = ?", email).Scan(&id)
+	return id, err
+}
+
+// --- Commissioners ---
+
+func getCommissioners(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	var ownerID int
+	var ownerName string
+	if err := db.QueryRow("SELECT l.owner_id, u.display_name FROM leagues l JOIN users u ON u.id = l.owner_id WHERE l.id = ?", leagueID).
+		Scan(&ownerID, &ownerName); err != nil {
+		return newAPIError(404, errLeagueNotFound, "League not found")
+	}
+	commissioners := []fiber.Map{{"user_id": ownerID, "display_name": ownerName, "role": "owner"}}
+	rows, err := db.Query(`SELECT c.user_id, u.display_name, c.created_at FROM league_commissioners c JOIN users u ON u.id = c.user_id
+		WHERE c.league_id = ? ORDER BY c.created_at, c.id`, leagueID)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userID int
+		var name, appointedAt string
+		rows.Scan(&userID, &name, &appointedAt)
+		commissioners = append(commissioners, fiber.Map{"user_id": userID, "display_name": name, "role": "co_commissioner", "appointed_at": appointedAt})
+	}
+	return c.JSON(commissioners)
+}
+
+// addCommissioner appoints a league member as co-commissioner.
+func addCommissioner(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	userID := getUserID(c)
+	if !isLeagueOwner(leagueID, userID) {
+		return newAPIError(403, errNotLeagueOwner, "Only the league owner can appoint commissioners")
+	}
+	var body userRef
+	if err := c.BodyParser(&body); err != nil {
+		return newAPIError(400, "INVALID_REQUEST", "Invalid request")
+	}
+	targetID, name, err := body.resolve()
+	if err != nil {
+		return err
+	}
+	if _, ok := leagueTeamOf(leagueID, targetID); !ok {
+		return newAPIError(400, errNotInLeague, "Co-commissioners must have a team in the league").with("user_id", targetID)
+	}
+	if isCommissioner(leagueID, targetID) {
+		return newAPIError(409, "ALREADY_COMMISSIONER", "User is already a commissioner").with("user_id", targetID)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	tx.Exec("INSERT INTO league_commissioners (league_id, user_id, appointed_by) VALUES (?, ?, ?)", leagueID, targetID, userID)
+	logLeagueAction(tx, leagueID, userID, "commissioner_added", 0, name+" was made a co-commissioner")
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	createNotification(targetID, "commissioner_added", "You're a Co-Commissioner",
+		"You can now manage teams, rosters and transactions in this league.", leagueID)
+	return c.Status(201).JSON(fiber.Map{"message": "Co-commissioner added", "user_id": targetID})
+}
+
+// removeCommissioner takes co-commissioner powers away. The owner can
+// remove anyone; a co-commissioner can step down.
+func removeCommissioner(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	targetID, _ := strconv.Atoi(c.Params("userId"))
+	userID := getUserID(c)
+	if !isLeagueOwner(leagueID, userID) && userID != targetID {
+		return newAPIError(403, errNotLeagueOwner, "Only the league owner can remove commissioners")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	res, _ := tx.Exec("DELETE FROM league_commissioners WHERE league_id = ? AND user_id = ?", leagueID, targetID)
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return newAPIError(404, errNotCommissioner, "User is not a co-commissioner").with("user_id", targetID)
+	}
+	var name string
+	tx.QueryRow("SELECT display_name FROM users WHERE id = ?", targetID).Scan(&name)
+	logLeagueAction(tx, leagueID, userID, "commissioner_removed", 0, name+" is no longer a co-commissioner")
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	if targetID != userID {
+		createNotification(targetID, "commissioner_removed", "Commissioner Role Removed",
+			"You are no longer a co-commissioner of this league.", leagueID)
+	}
+	return c.JSON(fiber.Map{"message": "Co-commissioner removed", "user_id": targetID})
+}
+
+// transferLeague hands the league to another member, who becomes its owner.
+func transferLeague(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	userID := getUserID(c)
+	if !isLeagueOwner(leagueID, userID) {
+		return newAPIError(403, errNotLeagueOwner, "Only the league owner can transfer the league")
+	}
+	var body userRef
+	if err := c.BodyParser(&body); err != nil {
+		return newAPIError(400, "INVALID_REQUEST", "Invalid request")
+	}
+	targetID, name, err := body.resolve()
+	if err != nil {
+		return err
+	}
+	if targetID == userID {
+		return newAPIError(400, "INVALID_REQUEST", "You already own this league")
+	}
+	if _, ok := leagueTeamOf(leagueID, targetID); !ok {
+		return newAPIError(400, errNotInLeague, "The new owner must have a team in the league").with("user_id", targetID)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	tx.Exec("UPDATE leagues SET owner_id = ? WHERE id = ?", targetID, leagueID)
+	tx.Exec("DELETE FROM league_commissioners WHERE league_id = ? AND user_id = ?", leagueID, targetID)
+	logLeagueAction(tx, leagueID, userID, "ownership_transferred", 0, "League ownership was transferred to "+name)
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	notifyLeague(leagueID, "league_transferred", "New League Owner", name+" now owns the league.", userID)
+	return c.JSON(fiber.Map{"message": "League transferred", "owner_id": targetID})
+}
+
+// --- Team Owners ---
+
+// removeTeamOwner takes a team away from its owner. Before the draft the
+// team is deleted; after it the team is orphaned.
+func removeTeamOwner(c *fiber.Ctx) error {
+	teamID, _ := strconv.Atoi(c.Params("id"))
+	userID := getUserID(c)
+	leagueID, ownerID, err := loadTeam(teamID)
+	if err != nil {
+		return err
+	}
+	status, err := requireCommissioner(c, leagueID)
+	if err != nil {
+		return err
+	}
+	if isLeagueOwner(leagueID, ownerID) {
+		return newAPIError(409, "OWNER_TEAM", "Transfer the league before removing its owner's team")
+	}
+	var ownerName string
+	var orphaned bool
+	db.QueryRow("SELECT display_name, is_system FROM users WHERE id = ?", ownerID).Scan(&ownerName, &orphaned)
+	if orphaned {
+		return newAPIError(409, "TEAM_ORPHANED", "This team has no owner")
+	}
+	name := teamName(teamID)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	tx.Exec("DELETE FROM league_commissioners WHERE league_id = ? AND user_id = ?", leagueID, ownerID)
+	action := "team_orphaned"
+	if status == "pending" {
+		action = "team_removed"
+		tx.Exec("DELETE FROM waiver_claims WHERE team_id = ?", teamID)
+		// Keep the history that mentions the team, minus the link to it.
+		tx.Exec("UPDATE league_audit_log SET team_id = NULL WHERE team_id = ?", teamID)
+		tx.Exec("UPDATE league_invite_uses SET team_id = NULL WHERE team_id = ?", teamID)
+		tx.Exec("DELETE FROM teams WHERE id = ?", teamID)
+		logLeagueAction(tx, leagueID, userID, action, 0, fmt.Sprintf("%s (%s) was removed from the league", name, ownerName))
+	} else {
+		placeholder, err := orphanUser(tx, teamID)
+		if err != nil {
+			tx.Rollback()
+			return fiber.NewError(500, err.Error())
+		}
+		tx.Exec("UPDATE teams SET user_id = ? WHERE id = ?", placeholder, teamID)
+		tx.Exec("DELETE FROM waiver_claims WHERE team_id = ? AND status = 'pending'", teamID)
+		logLeagueAction(tx, leagueID, userID, action, teamID, fmt.Sprintf("%s was taken from %s and is now orphaned", name, ownerName))
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+
+	createNotification(ownerID, "team_removed", "Removed From League",
+		fmt.Sprintf("The commissioner removed you from %s.", name), leagueID)
+	broadcastLeagueEvent(leagueID, fiber.Map{"type": action, "league_id": leagueID, "team_id": teamID})
+	return c.JSON(fiber.Map{"message": "Team owner removed", "team_id": teamID, "action": action})
+}
+
+// assignTeamOwner hands a team to a user who isn't in the league yet,
+// replacing its current owner or adopting an orphaned team.
+func assignTeamOwner(c *fiber.Ctx) error {
+	teamID, _ := strconv.Atoi(c.Params("id"))
+	userID := getUserID(c)
+	leagueID, ownerID, err := loadTeam(teamID)
+	if err != nil {
+		return err
+	}
+	if _, err := requireCommissioner(c, leagueID); err != nil {
+		return err
+	}
+	if isLeagueOwner(leagueID, ownerID) {
+		return newAPIError(409, "OWNER_TEAM", "Transfer the league before replacing its owner's team")
+	}
+	var body userRef
+	if err := c.BodyParser(&body); err != nil {
+		return newAPIError(400, "INVALID_REQUEST", "Invalid request")
+	}
+	targetID, targetName, err := body.resolve()
+	if err != nil {
+		return err
+	}
+	if _, ok := leagueTeamOf(leagueID, targetID); ok {
+		return newAPIError(409, errAlreadyInLeague, "User already has a team in this league").with("user_id", targetID)
+	}
+	var ownerName string
+	var orphaned bool
+	db.QueryRow("SELECT display_name, is_system FROM users WHERE id = ?", ownerID).Scan(&ownerName, &orphaned)
+	name := teamName(teamID)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	tx.Exec("UPDATE teams SET user_id = ? WHERE id = ?", targetID, teamID)
+	tx.Exec("DELETE FROM league_commissioners WHERE league_id = ? AND user_id = ?", leagueID, ownerID)
+	details := fmt.Sprintf("%s was handed from %s to %s", name, ownerName, targetName)
+	if orphaned {
+		details = fmt.Sprintf("Orphaned team %s was handed to %s", name, targetName)
+	}
+	logLeagueAction(tx, leagueID, userID, "team_owner_assigned", teamID, details)
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+
+	createNotification(targetID, "team_assigned", "You Have a New Team",
+		fmt.Sprintf("The commissioner handed you %s.", name), leagueID)
+	if !orphaned {
+		createNotification(ownerID, "team_removed", "Removed From League",
+			fmt.Sprintf("The commissioner handed %s to a new owner.", name), leagueID)
+	}
+	broadcastLeagueEvent(leagueID, fiber.Map{"type": "team_owner_assigned", "league_id": leagueID, "team_id": teamID, "user_id": targetID})
+	return c.JSON(fiber.Map{"message": "Team owner assigned", "team_id": teamID, "user_id": targetID})
+}
+
+// --- Rosters and Transactions ---
+
+// commissionerAddMovie puts an unrostered movie straight onto a team,
+// skipping waivers and transaction windows.
+func commissionerAddMovie(c *fiber.Ctx) error {
+	teamID, _ := strconv.Atoi(c.Params("id"))
+	userID := getUserID(c)
+	leagueID, ownerID, err := loadTeam(teamID)
+	if err != nil {
+		return err
+	}
+	if _, err := requireCommissioner(c, leagueID); err != nil {
+		return err
+	}
+	if err := requireActiveLeague(db, leagueID); err != nil {
+		return err
+	}
+	var body struct {
+		MovieID int `json:"movie_id"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.MovieID == 0 {
+		return newAPIError(400, "INVALID_REQUEST", "movie_id required")
+	}
+	var title string
+	if err := db.QueryRow("SELECT title FROM movies WHERE id = ?", body.MovieID).Scan(&title); err != nil {
+		return newAPIError(404, errMovieNotFound, "Movie not found").with("movie_id", body.MovieID)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	if movieRosteredInLeague(tx, leagueID, body.MovieID) {
+		tx.Rollback()
+		return newAPIError(409, errMovieRostered, "Movie is already on a roster in this league").with("movie_id", body.MovieID)
+	}
+	if err := checkRosterChange(tx, teamID, []int{body.MovieID}, nil); err != nil {
+		tx.Rollback()
+		return err
+	}
+	tx.Exec("INSERT INTO roster (team_id, movie_id, acquisition_type) VALUES (?, ?, 'commissioner')", teamID, body.MovieID)
+	tx.Exec("INSERT INTO transactions (league_id, team_id, movie_id, type) VALUES (?, ?, ?, 'commissioner_add')", leagueID, teamID, body.MovieID)
+	tx.Exec("DELETE FROM waiver_wire WHERE league_id = ? AND movie_id = ?", leagueID, body.MovieID)
+	logLeagueAction(tx, leagueID, userID, "roster_add", teamID, fmt.Sprintf("%s was added to %s", title, teamName(teamID)))
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+
+	if ownerID != userID {
+		createNotification(ownerID, "roster_changed", "Roster Changed",
+			fmt.Sprintf("The commissioner added %s to your roster.", title), leagueID)
+	}
+	broadcastLeagueEvent(leagueID, fiber.Map{"type": "commissioner_add", "league_id": leagueID, "team_id": teamID, "movie_id": body.MovieID})
+	return c.Status(201).JSON(fiber.Map{"message": "Movie added", "team_id": teamID, "movie_id": body.MovieID})
+}
+
+// forceTrade executes an open trade without waiting for the other teams or
+// league review.
+func forceTrade(c *fiber.Ctx) error {
+	tradeID, _ := strconv.Atoi(c.Params("id"))
+	userID := getUserID(c)
+	t, err := loadTrade(db, tradeID)
+	if err != nil {
+		return err
+	}
+	if !isCommissioner(t.LeagueID, userID) {
+		return newAPIError(403, errNotCommissioner, "Only a commissioner can force a trade")
+	}
+	if t.Status != "in_review" {
+		if err := t.requirePending(); err != nil {
+			return err
+		}
+	}
+	invalidated, err := executeTrade(t)
+	if err != nil {
+		return err
+	}
+	db.Exec("UPDATE trade_teams SET status = 'accepted', responded_at = COALESCE(responded_at, CURRENT_TIMESTAMP) WHERE trade_id = ?", t.ID)
+	logLeagueAction(db, t.LeagueID, userID, "trade_forced", 0, fmt.Sprintf("Trade #%d between %s was forced through", t.ID, t.teamNames()))
+	notifyLeague(t.LeagueID, "trade_forced", "Trade Forced",
+		fmt.Sprintf("The commissioner pushed trade #%d between %s through", t.ID, t.teamNames()))
+	return c.JSON(fiber.Map{"message": "Trade executed", "status": t.Status, "invalidated_trades": invalidated})
+}
+
+// reverseTransaction undoes a transaction. Trades are reversed as a whole;
+// waiver pickups and commissioner adds leave the roster; drops come back
+// if nobody has picked the movie up since.
+func reverseTransaction(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	txnID, _ := strconv.Atoi(c.Params("txId"))
+	userID := getUserID(c)
+	if _, err := requireCommissioner(c, leagueID); err != nil {
+		return err
+	}
+	if err := requireActiveLeague(db, leagueID); err != nil {
+		return err
+	}
+
+	var teamID, movieID int
+	var txnType string
+	var tradeID sql.NullInt64
+	if err := db.QueryRow("SELECT team_id, movie_id, type, trade_id FROM transactions WHERE id = ? AND league_id = ?", txnID, leagueID).
+		Scan(&teamID, &movieID, &txnType, &tradeID); err != nil {
+		return newAPIError(404, "TRANSACTION_NOT_FOUND", "Transaction not found")
+	}
+	var reversed int
+	db.QueryRow("SELECT COUNT(*) FROM transactions WHERE reverses_id = ?", txnID).Scan(&reversed)
+	if reversed > 0 {
+		return newAPIError(409, errNotReversible, "Transaction has already been reversed")
+	}
+
+	if txnType == "trade" && tradeID.Valid {
+		return reverseTrade(c, int(tradeID.Int64), userID)
+	}
+	var add, remove []int
+	switch txnType {
+	case "waiver", "commissioner_add":
+		remove = []int{movieID}
+	case "drop", "commissioner_drop":
+		add = []int{movieID}
+	default:
+		return newAPIError(400, errNotReversible, "This kind of transaction can't be reversed").with("type", txnType)
+	}
+
+	var title string
+	db.QueryRow("SELECT title FROM movies WHERE id = ?", movieID).Scan(&title)
+	tx, err := db.Begin()
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	var details string
+	if len(add) > 0 {
+		if movieRosteredInLeague(tx, leagueID, movieID) {
+			tx.Rollback()
+			return newAPIError(409, errMovieRostered, "Movie has been picked up since it was dropped").with("movie_id", movieID)
+		}
+		if err := checkRosterChange(tx, teamID, add, nil); err != nil {
+			tx.Rollback()
+			return err
+		}
+		tx.Exec("INSERT INTO roster (team_id, movie_id, acquisition_type) VALUES (?, ?, 'commissioner')", teamID, movieID)
+		tx.Exec("DELETE FROM waiver_wire WHERE league_id = ? AND movie_id = ?", leagueID, movieID)
+		details = fmt.Sprintf("Drop of %s by %s was reversed", title, teamName(teamID))
+	} else {
+		res, _ := tx.Exec("DELETE FROM roster WHERE team_id = ? AND movie_id = ?", teamID, movieID)
+		if n, _ := res.RowsAffected(); n == 0 {
+			tx.Rollback()
+			return newAPIError(409, errMovieNotOwned, "Movie is no longer on this roster").with("movie_id", movieID)
+		}
+		if txnType == "waiver" {
+			// Give back the FAAB the claim cost.
+			var bid int
+			tx.QueryRow("SELECT bid FROM waiver_claims WHERE team_id = ? AND movie_id = ? AND status = 'won' ORDER BY id DESC LIMIT 1",
+				teamID, movieID).Scan(&bid)
+			tx.Exec("UPDATE teams SET faab_spent = MAX(faab_spent - ?, 0) WHERE id = ?", bid, teamID)
+		}
+		details = fmt.Sprintf("Pickup of %s by %s was reversed", title, teamName(teamID))
+	}
+	tx.Exec("INSERT INTO transactions (league_id, team_id, movie_id, type, reverses_id) VALUES (?, ?, ?, 'reversal', ?)",
+		leagueID, teamID, movieID, txnID)
+	logLeagueAction(tx, leagueID, userID, "transaction_reversed", teamID, details)
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+
+	var invalidated []int
+	if len(remove) > 0 {
+		invalidated = invalidateConflictingTrades(leagueID, 0, []tradeItem{{FromTeamID: teamID, MovieID: movieID}})
+	}
+	var ownerID int
+	db.QueryRow("SELECT user_id FROM teams WHERE id = ?", teamID).Scan(&ownerID)
+	createNotification(ownerID, "transaction_reversed", "Transaction Reversed", "The commissioner reversed a transaction: "+details+".", leagueID)
+	broadcastLeagueEvent(leagueID, fiber.Map{"type": "transaction_reversed", "league_id": leagueID, "transaction_id": txnID})
+	return c.JSON(fiber.Map{"message": "Transaction reversed", "transaction_id": txnID, "invalidated_trades": nonNil(invalidated)})
+}
+
+// reverseTrade sends every movie in an accepted trade back where it came
+// from.
+func reverseTrade(c *fiber.Ctx, tradeID, userID int) error {
+	t, err := loadTrade(db, tradeID)
+	if err != nil {
+		return err
+	}
+	if t.Status != "accepted" {
+		return newAPIError(409, errNotReversible, "Only completed trades can be reversed").with("trade_status", t.Status)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	var back []tradeItem
+	for _, it := range loadTradeItems(tx, t.ID) {
+		back = append(back, tradeItem{FromTeamID: it.ToTeamID, ToTeamID: it.FromTeamID, MovieID: it.MovieID})
+	}
+	if err := validateTradeItems(tx, back); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := checkTradeRosters(tx, back); err != nil {
+		tx.Rollback()
+		return err
+	}
+	tx.Exec("UPDATE trades SET status = 'reversed' WHERE id = ?", t.ID)
+	for _, it := range back {
+		var original int
+		tx.QueryRow("SELECT id FROM transactions WHERE trade_id = ? AND movie_id = ? AND type = 'trade' ORDER BY id DESC LIMIT 1",
+			t.ID, it.MovieID).Scan(&original)
+		tx.Exec("DELETE FROM roster WHERE team_id = ? AND movie_id = ?", it.FromTeamID, it.MovieID)
+		tx.Exec("INSERT OR IGNORE INTO roster (team_id, movie_id, acquisition_type) VALUES (?, ?, 'trade')", it.ToTeamID, it.MovieID)
+		tx.Exec("INSERT INTO transactions (league_id, team_id, movie_id, type, trade_id, reverses_id) VALUES (?, ?, ?, 'reversal', ?, ?)",
+			t.LeagueID, it.ToTeamID, it.MovieID, t.ID, original)
+	}
+	logLeagueAction(tx, t.LeagueID, userID, "trade_reversed", 0, fmt.Sprintf("Trade #%d between %s was reversed", t.ID, t.teamNames()))
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+
+	invalidated := invalidateConflictingTrades(t.LeagueID, t.ID, back)
+	notifyLeague(t.LeagueID, "trade_reversed", "Trade Reversed",
+		fmt.Sprintf("The commissioner reversed trade #%d between %s", t.ID, t.teamNames()))
+	broadcastLeagueEvent(t.LeagueID, fiber.Map{"type": "trade_reversed", "league_id": t.LeagueID, "trade_id": t.ID})
+	return c.JSON(fiber.Map{"message": "Trade reversed", "trade_id": t.ID, "invalidated_trades": invalidated})
+}
+
+func nonNil(ids []int) []int {
+	if ids == nil {
+		return []int{}
+	}
+	return ids
+}
+
+// --- Audit Log ---
+
+// getLeagueAuditLog lists commissioner actions, newest first.
+func getLeagueAuditLog(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 500 {
+		limit = 100
+	}
+
+	rows, err := db.Query(`SELECT a.id, a.user_id, u.display_name, a.action, a.team_id, a.details, a.created_at
+		FROM league_audit_log a JOIN users u ON u.id = a.user_id
+		WHERE a.league_id = ? ORDER BY a.created_at DESC, a.id DESC LIMIT ?`, leagueID, limit)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	defer rows.Close()
+	entries := []fiber.Map{}
+	for rows.Next() {
+		var id, uid int
+		var name, action, details, createdAt string
+		var teamID sql.NullInt64
+		rows.Scan(&id, &uid, &name, &action, &teamID, &details, &createdAt)
+		entry := fiber.Map{
+			"id": id, "user_id": uid, "actor": name, "action": action,
+			"team_id": nil, "details": details, "created_at": createdAt,
+		}
+		if teamID.Valid {
+			entry["team_id"] = teamID.Int64
+		}
+		entries = append(entries, entry)
+	}
+	return c.JSON(entries)
+}
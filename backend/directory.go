@@ -0,0 +1,343 @@
+package main
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// --- League Directory ---
+//
+// Public leagues are listed in a directory anyone signed in can search.
+// Joining one from the directory is immediate unless the commissioner turns
+// on join_approval, in which case joinLeague files a join request and a
+// commissioner approves or denies it. Invite links skip approval: sharing
+// one is the commissioner's say-so already.
+
+const (
+	errJoinRequestNotFound = "JOIN_REQUEST_NOT_FOUND"
+	errJoinRequestPending  = "JOIN_REQUEST_PENDING"
+	errLeagueFull          = "LEAGUE_FULL"
+	errLeagueNotOpen       = "LEAGUE_NOT_OPEN"
+)
+
+var directorySorts = map[string]string{
+	"draft_date": "draft_date IS NULL OR draft_date = '', draft_date",
+	"open_spots": "open_spots DESC",
+	"name":       "name",
+	"newest":     "id DESC",
+}
+
+// getLeagueDirectory lists public leagues. By default only leagues still
+// taking teams are shown.
+func getLeagueDirectory(c *fiber.Ctx) error {
+	userID := getUserID(c)
+	query := `SELECT * FROM (
+		SELECT l.id, l.name, l.season_year, l.max_teams, l.status, COALESCE(l.draft_date, '') AS draft_date,
+			l.scoring_mode, l.league_format, l.join_approval, u.display_name AS owner,
+			(SELECT COUNT(*) FROM teams t WHERE t.league_id = l.id) AS team_count,
+			l.max_teams - (SELECT COUNT(*) FROM teams t WHERE t.league_id = l.id) AS open_spots,
+			EXISTS(SELECT 1 FROM teams t WHERE t.league_id = l.id AND t.user_id = ?) AS joined,
+			EXISTS(SELECT 1 FROM league_join_requests r WHERE r.league_id = l.id AND r.user_id = ? AND r.status = 'pending') AS requested
+		FROM leagues l JOIN users u ON u.id = l.owner_id WHERE l.visibility = 'public'
+	) WHERE 1=1`
+	args := []interface{}{userID, userID}
+
+	switch status := c.Query("status", "pending"); status {
+	case "pending", "drafting", "active", "completed":
+		query += " AND status = ?"
+		args = append(args, status)
+	case "all":
+	default:
+		return newAPIError(400, "INVALID_FILTER", "status must be pending, drafting, active, completed or all")
+	}
+	if search := strings.TrimSpace(c.Query("search")); search != "" {
+		query += " AND name LIKE ?"
+		args = append(args, "%"+search+"%")
+	}
+	if v := c.Query("season_year"); v != "" {
+		query += " AND season_year = ?"
+		args = append(args, atoi(v))
+	}
+	if v := c.Query("min_size"); v != "" {
+		query += " AND max_teams >= ?"
+		args = append(args, atoi(v))
+	}
+	if v := c.Query("max_size"); v != "" {
+		query += " AND max_teams <= ?"
+		args = append(args, atoi(v))
+	}
+	if v := c.Query("open_spots"); v != "" {
+		query += " AND open_spots >= ?"
+		args = append(args, atoi(v))
+	}
+	if v := c.Query("scoring_mode"); v != "" {
+		query += " AND scoring_mode = ?"
+		args = append(args, v)
+	}
+	if v := c.Query("league_format"); v != "" {
+		query += " AND league_format = ?"
+		args = append(args, v)
+	}
+	// Draft dates are stored as text, so comparing the date part is enough.
+	if v := c.Query("draft_after"); v != "" {
+		query += " AND draft_date != '' AND substr(draft_date, 1, 10) >= ?"
+		args = append(args, v)
+	}
+	if v := c.Query("draft_before"); v != "" {
+		query += " AND draft_date != '' AND substr(draft_date, 1, 10) <= ?"
+		args = append(args, v)
+	}
+
+	order, ok := directorySorts[c.Query("sort", "draft_date")]
+	if !ok {
+		return newAPIError(400, "INVALID_FILTER", "sort must be draft_date, open_spots, name or newest")
+	}
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+	query += " ORDER BY " + order + ", id LIMIT ? OFFSET ?"
+	args = append(args, limit, c.QueryInt("offset", 0))
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	defer rows.Close()
+
+	leagues := []fiber.Map{}
+	for rows.Next() {
+		var id, year, maxTeams, teams, open int
+		var name, status, scoringMode, format, owner string
+		var draftDate interface{}
+		var approval, joined, requested bool
+		rows.Scan(&id, &name, &year, &maxTeams, &status, &draftDate, &scoringMode, &format, &approval, &owner,
+			&teams, &open, &joined, &requested)
+		leagues = append(leagues, fiber.Map{
+			"id": id, "name": name, "season_year": year, "max_teams": maxTeams, "status": status,
+			"draft_date": settingString(draftDate), "scoring_mode": scoringMode, "league_format": format,
+			"join_approval": approval, "owner": owner, "team_count": teams, "open_spots": open,
+			"joined": joined, "requested": requested,
+		})
+	}
+	return c.JSON(leagues)
+}
+
+// leagueOpenForTeams checks a league can take another team.
+func leagueOpenForTeams(q queryer, leagueID int) error {
+	var maxTeams, count int
+	var status string
+	if err := q.QueryRow("SELECT max_teams, status FROM leagues WHERE id = ?", leagueID).Scan(&maxTeams, &status); err != nil {
+		return newAPIError(404, errLeagueNotFound, "League not found")
+	}
+	if status != "pending" {
+		return newAPIError(400, errLeagueNotOpen, "League is not accepting new teams").with("league_status", status)
+	}
+	q.QueryRow("SELECT COUNT(*) FROM teams WHERE league_id = ?", leagueID).Scan(&count)
+	if count >= maxTeams {
+		return newAPIError(400, errLeagueFull, "League is full")
+	}
+	return nil
+}
+
+// requestToJoin files a join request for a league that requires approval.
+func requestToJoin(c *fiber.Ctx, leagueID, userID int, teamName, message string) error {
+	if _, ok := leagueTeamOf(leagueID, userID); ok {
+		return newAPIError(409, errAlreadyInLeague, "Already in this league")
+	}
+	res, err := db.Exec("INSERT INTO league_join_requests (league_id, user_id, team_name, message) VALUES (?, ?, ?, ?)",
+		leagueID, userID, teamName, strings.TrimSpace(message))
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return newAPIError(409, errJoinRequestPending, "You've already asked to join this league")
+		}
+		return fiber.NewError(500, err.Error())
+	}
+	requestID, _ := res.LastInsertId()
+
+	var name, leagueName string
+	db.QueryRow("SELECT display_name FROM users WHERE id = ?", userID).Scan(&name)
+	db.QueryRow("SELECT name FROM leagues WHERE id = ?", leagueID).Scan(&leagueName)
+	notifyCommissioners(leagueID, "join_request", "Join Request",
+		name+" asked to join "+leagueName+" as "+teamName+".")
+	return c.Status(202).JSON(fiber.Map{"message": "Join request sent", "request_id": requestID, "status": "pending"})
+}
+
+// withdrawJoinRequest cancels the caller's pending request to join a league.
+func withdrawJoinRequest(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	res, err := db.Exec("UPDATE league_join_requests SET status = 'withdrawn', decided_at = CURRENT_TIMESTAMP WHERE league_id = ? AND user_id = ? AND status = 'pending'",
+		leagueID, getUserID(c))
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return newAPIError(404, errJoinRequestNotFound, "No pending join request for this league")
+	}
+	return c.JSON(fiber.Map{"message": "Join request withdrawn"})
+}
+
+// getMyJoinRequests lists the caller's join requests, newest first.
+func getMyJoinRequests(c *fiber.Ctx) error {
+	rows, err := db.Query(`SELECT r.id, r.league_id, l.name, r.team_name, r.message, r.status, r.created_at, r.decided_at
+		FROM league_join_requests r JOIN leagues l ON l.id = r.league_id
+		WHERE r.user_id = ? ORDER BY r.created_at DESC, r.id DESC`, getUserID(c))
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	defer rows.Close()
+	requests := []fiber.Map{}
+	for rows.Next() {
+		var id, leagueID int
+		var leagueName, teamName, message, status string
+		var createdAt time.Time
+		var decidedAt sql.NullTime
+		rows.Scan(&id, &leagueID, &leagueName, &teamName, &message, &status, &createdAt, &decidedAt)
+		r := fiber.Map{
+			"id": id, "league_id": leagueID, "league_name": leagueName, "team_name": teamName,
+			"message": message, "status": status, "created_at": createdAt, "decided_at": nil,
+		}
+		if decidedAt.Valid {
+			r["decided_at"] = decidedAt.Time
+		}
+		requests = append(requests, r)
+	}
+	return c.JSON(requests)
+}
+
+// getJoinRequests lists a league's join requests for its commissioners.
+// ?status= picks pending (the default), approved, denied, withdrawn or all.
+func getJoinRequests(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	if _, err := requireCommissioner(c, leagueID); err != nil {
+		return err
+	}
+	query := `SELECT r.id, r.user_id, u.display_name, r.team_name, r.message, r.status, r.created_at, r.decided_at
+		FROM league_join_requests r JOIN users u ON u.id = r.user_id WHERE r.league_id = ?`
+	args := []interface{}{leagueID}
+	switch status := c.Query("status", "pending"); status {
+	case "pending", "approved", "denied", "withdrawn":
+		query += " AND r.status = ?"
+		args = append(args, status)
+	case "all":
+	default:
+		return newAPIError(400, "INVALID_FILTER", "status must be pending, approved, denied, withdrawn or all")
+	}
+	rows, err := db.Query(query+" ORDER BY r.created_at, r.id", args...)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	defer rows.Close()
+	requests := []fiber.Map{}
+	for rows.Next() {
+		var id, userID int
+		var name, teamName, message, status string
+		var createdAt time.Time
+		var decidedAt sql.NullTime
+		rows.Scan(&id, &userID, &name, &teamName, &message, &status, &createdAt, &decidedAt)
+		r := fiber.Map{
+			"id": id, "user_id": userID, "display_name": name, "team_name": teamName,
+			"message": message, "status": status, "created_at": createdAt, "decided_at": nil,
+		}
+		if decidedAt.Valid {
+			r["decided_at"] = decidedAt.Time
+		}
+		requests = append(requests, r)
+	}
+	return c.JSON(requests)
+}
+
+// loadJoinRequest returns a pending request in the league.
+func loadJoinRequest(q queryer, leagueID, requestID int) (userID int, teamName string, err error) {
+	var status string
+	if err := q.QueryRow("SELECT user_id, team_name, status FROM league_join_requests WHERE id = ? AND league_id = ?", requestID, leagueID).
+		Scan(&userID, &teamName, &status); err != nil {
+		return 0, "", newAPIError(404, errJoinRequestNotFound, "Join request not found")
+	}
+	if status != "pending" {
+		return 0, "", newAPIError(400, "JOIN_REQUEST_DECIDED", "This join request has already been "+status).with("status", status)
+	}
+	return userID, teamName, nil
+}
+
+// approveJoinRequest adds the applicant's team to the league.
+func approveJoinRequest(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	requestID, _ := strconv.Atoi(c.Params("requestId"))
+	if _, err := requireCommissioner(c, leagueID); err != nil {
+		return err
+	}
+	commissionerID := getUserID(c)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	defer tx.Rollback()
+	applicantID, name, err := loadJoinRequest(tx, leagueID, requestID)
+	if err != nil {
+		return err
+	}
+	if err := leagueOpenForTeams(tx, leagueID); err != nil {
+		return err
+	}
+	res, err := tx.Exec("INSERT INTO teams (league_id, user_id, name) VALUES (?, ?, ?)", leagueID, applicantID, name)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return newAPIError(409, errAlreadyInLeague, "That user is already in this league")
+		}
+		return fiber.NewError(500, err.Error())
+	}
+	teamID, _ := res.LastInsertId()
+	tx.Exec("UPDATE league_join_requests SET status = 'approved', decided_by = ?, decided_at = CURRENT_TIMESTAMP WHERE id = ?",
+		commissionerID, requestID)
+	logLeagueAction(tx, leagueID, commissionerID, "join_request_approved", int(teamID), "Approved a request to join as "+name)
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+
+	var leagueName string
+	db.QueryRow("SELECT name FROM leagues WHERE id = ?", leagueID).Scan(&leagueName)
+	createNotification(applicantID, "join_request_approved", "Join Request Approved",
+		"You're in! "+name+" has joined "+leagueName+".", leagueID)
+	broadcastLeagueEvent(leagueID, fiber.Map{"type": "team_joined", "league_id": leagueID, "team_id": teamID, "team_name": name})
+	return c.JSON(fiber.Map{"message": "Join request approved", "team_id": teamID})
+}
+
+// denyJoinRequest turns an applicant away, with an optional reason.
+func denyJoinRequest(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	requestID, _ := strconv.Atoi(c.Params("requestId"))
+	if _, err := requireCommissioner(c, leagueID); err != nil {
+		return err
+	}
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	c.BodyParser(&body)
+	commissionerID := getUserID(c)
+
+	applicantID, name, err := loadJoinRequest(db, leagueID, requestID)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec("UPDATE league_join_requests SET status = 'denied', decided_by = ?, decided_at = CURRENT_TIMESTAMP WHERE id = ?",
+		commissionerID, requestID); err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	var leagueName string
+	db.QueryRow("SELECT name FROM leagues WHERE id = ?", leagueID).Scan(&leagueName)
+	details := "Denied a request to join as " + name
+	msg := "Your request to join " + leagueName + " was declined."
+	if reason := strings.TrimSpace(body.Reason); reason != "" {
+		details += ": " + reason
+		msg += " Reason: " + reason
+	}
+	logLeagueAction(db, leagueID, commissionerID, "join_request_denied", 0, details)
+	createNotification(applicantID, "join_request_denied", "Join Request Declined", msg, leagueID)
+	return c.JSON(fiber.Map{"message": "Join request denied"})
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// --- Divisions ---
+//
+// A league can split its teams into divisions, optionally grouped into
+// conferences (a division's conference is just a label). Divisions shape
+// the season three ways:
+//
+//   - Standings rank each team within its division and conference too.
+//   - In h2h leagues division rivals meet division_matchups times per
+//     schedule cycle; everyone else meets once.
+//   - With playoff_division_winners, each division's leader is seeded
+//     ahead of the wildcards.
+//
+// Divisions and team assignments are fixed once the draft starts, since the
+// schedule is built from them when it ends. Names can change until the
+// league completes.
+
+const errDivisionNotFound = "DIVISION_NOT_FOUND"
+
+type division struct {
+	ID               int
+	Name, Conference string
+}
+
+// leagueDivisions returns a league's divisions in order and which division
+// each team is in.
+func leagueDivisions(q queryer, leagueID int) ([]division, map[int]int) {
+	var divisions []division
+	rows, err := q.Query("SELECT id, name, conference FROM league_divisions WHERE league_id = ? ORDER BY position, id", leagueID)
+	if err != nil {
+		return nil, nil
+	}
+	for rows.Next() {
+		var d division
+		rows.Scan(&d.ID, &d.Name, &d.Conference)
+		divisions = append(divisions, d)
+	}
+	rows.Close()
+
+	teamDivision := make(map[int]int)
+	rows, err = q.Query("SELECT id, division_id FROM teams WHERE league_id = ? AND division_id IS NOT NULL", leagueID)
+	if err != nil {
+		return divisions, teamDivision
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var teamID, divisionID int
+		rows.Scan(&teamID, &divisionID)
+		teamDivision[teamID] = divisionID
+	}
+	return divisions, teamDivision
+}
+
+// divisionGroups splits teams by division, in division order. Teams without
+// a division make up a last group. It returns nil if the league has fewer
+// than two divisions.
+func divisionGroups(leagueID int, teams []int) [][]int {
+	divisions, teamDivision := leagueDivisions(db, leagueID)
+	if len(divisions) < 2 {
+		return nil
+	}
+	index := make(map[int]int)
+	for i, d := range divisions {
+		index[d.ID] = i
+	}
+	groups := make([][]int, len(divisions)+1)
+	for _, t := range teams {
+		i, ok := index[teamDivision[t]]
+		if !ok {
+			i = len(divisions)
+		}
+		groups[i] = append(groups[i], t)
+	}
+	var nonEmpty [][]int
+	for _, g := range groups {
+		if len(g) > 0 {
+			nonEmpty = append(nonEmpty, g)
+		}
+	}
+	return nonEmpty
+}
+
+// divisionRounds are the extra rounds that make division rivals meet times
+// times per schedule cycle: each extra pass is a round robin inside every
+// division at once. Teams without a game in a round get a bye, and every
+// other pass swaps home and away.
+func divisionRounds(groups [][]int, times int) [][][2]int {
+	var rounds [][][2]int
+	for pass := 1; pass < times; pass++ {
+		var perGroup [][][][2]int
+		most := 0
+		for _, g := range groups {
+			rr := roundRobin(g)
+			perGroup = append(perGroup, rr)
+			if len(rr) > most {
+				most = len(rr)
+			}
+		}
+		for i := 0; i < most; i++ {
+			var pairs [][2]int
+			for gi, rr := range perGroup {
+				if i >= len(rr) {
+					for _, t := range groups[gi] {
+						pairs = append(pairs, [2]int{t, 0})
+					}
+					continue
+				}
+				for _, pair := range rr[i] {
+					if pass%2 == 1 && pair[1] != 0 {
+						pair[0], pair[1] = pair[1], pair[0]
+					}
+					pairs = append(pairs, pair)
+				}
+			}
+			rounds = append(rounds, pairs)
+		}
+	}
+	return rounds
+}
+
+// divisionSchedule is the round robin for an h2h league, with the extra
+// division rounds added when the league has divisions.
+func divisionSchedule(leagueID int, teams []int) [][][2]int {
+	rounds := roundRobin(teams)
+	groups := divisionGroups(leagueID, teams)
+	if groups == nil {
+		return rounds
+	}
+	var times int
+	db.QueryRow("SELECT division_matchups FROM leagues WHERE id = ?", leagueID).Scan(&times)
+	return append(rounds, divisionRounds(groups, times)...)
+}
+
+// seedDivisionWinners moves each division's best-ranked team to the front of
+// ranked, keeping the order otherwise.
+func seedDivisionWinners(leagueID int, ranked []int) []int {
+	var enabled bool
+	db.QueryRow("SELECT playoff_division_winners FROM leagues WHERE id = ?", leagueID).Scan(&enabled)
+	divisions, teamDivision := leagueDivisions(db, leagueID)
+	if !enabled || len(divisions) < 2 {
+		return ranked
+	}
+	led := make(map[int]bool)
+	var winners, rest []int
+	for _, t := range ranked {
+		d, ok := teamDivision[t]
+		if ok && !led[d] {
+			led[d] = true
+			winners = append(winners, t)
+			continue
+		}
+		rest = append(rest, t)
+	}
+	return append(winners, rest...)
+}
+
+// addDivisionRanks labels standings rows, already in league order, with
+// each team's division and its rank in its division and conference.
+func addDivisionRanks(leagueID int, standings []fiber.Map) {
+	divisions, teamDivision := leagueDivisions(db, leagueID)
+	byID := make(map[int]division)
+	for _, d := range divisions {
+		byID[d.ID] = d
+	}
+	divisionRank := make(map[int]int)
+	conferenceRank := make(map[string]int)
+	for _, s := range standings {
+		s["division_id"], s["division"], s["conference"] = nil, nil, nil
+		s["division_rank"], s["conference_rank"] = nil, nil
+		d, ok := byID[teamDivision[s["team_id"].(int)]]
+		if !ok {
+			continue
+		}
+		divisionRank[d.ID]++
+		s["division_id"], s["division"] = d.ID, d.Name
+		s["division_rank"] = divisionRank[d.ID]
+		if d.Conference != "" {
+			conferenceRank[d.Conference]++
+			s["conference"] = d.Conference
+			s["conference_rank"] = conferenceRank[d.Conference]
+		}
+	}
+}
+
+// groupStandingsByDivision turns ranked standings into one table per
+// division, with unassigned teams last.
+func groupStandingsByDivision(leagueID int, standings []fiber.Map) []fiber.Map {
+	divisions, _ := leagueDivisions(db, leagueID)
+	groups := []fiber.Map{}
+	index := make(map[int]int)
+	for i, d := range divisions {
+		index[d.ID] = i
+		groups = append(groups, fiber.Map{"division_id": d.ID, "name": d.Name, "conference": d.Conference, "standings": []fiber.Map{}})
+	}
+	var unassigned []fiber.Map
+	for _, s := range standings {
+		id, ok := s["division_id"].(int)
+		if !ok {
+			unassigned = append(unassigned, s)
+			continue
+		}
+		g := groups[index[id]]
+		g["standings"] = append(g["standings"].([]fiber.Map), s)
+	}
+	if len(unassigned) > 0 {
+		groups = append(groups, fiber.Map{"division_id": nil, "name": "Unassigned", "conference": "", "standings": unassigned})
+	}
+	return groups
+}
+
+// requireDivisionsEditable checks the caller can reshape the league's
+// divisions: they're a commissioner and the draft hasn't started.
+func requireDivisionsEditable(c *fiber.Ctx, leagueID int) error {
+	status, err := requireCommissioner(c, leagueID)
+	if err != nil {
+		return err
+	}
+	if status != "pending" {
+		return newAPIError(400, errSettingLocked, "Divisions can't change after the draft has started").with("league_status", status)
+	}
+	return nil
+}
+
+// getDivisions lists a league's divisions with their teams.
+func getDivisions(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	divisions, teamDivision := leagueDivisions(db, leagueID)
+	teams := make(map[int][]fiber.Map)
+	for _, id := range leagueTeamIDs(leagueID) {
+		d := teamDivision[id]
+		teams[d] = append(teams[d], fiber.Map{"team_id": id, "team_name": teamName(id)})
+	}
+	result := []fiber.Map{}
+	for _, d := range divisions {
+		list := teams[d.ID]
+		if list == nil {
+			list = []fiber.Map{}
+		}
+		result = append(result, fiber.Map{"id": d.ID, "name": d.Name, "conference": d.Conference, "teams": list})
+	}
+	unassigned := teams[0]
+	if unassigned == nil {
+		unassigned = []fiber.Map{}
+	}
+	return c.JSON(fiber.Map{"divisions": result, "unassigned": unassigned})
+}
+
+type divisionBody struct {
+	Name       *string `json:"name"`
+	Conference *string `json:"conference"`
+}
+
+// createDivision adds a division to a league.
+func createDivision(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	if err := requireDivisionsEditable(c, leagueID); err != nil {
+		return err
+	}
+	var body divisionBody
+	if err := c.BodyParser(&body); err != nil || body.Name == nil || strings.TrimSpace(*body.Name) == "" {
+		return newAPIError(400, "INVALID_REQUEST", "Division name required")
+	}
+	name := strings.TrimSpace(*body.Name)
+	conference := ""
+	if body.Conference != nil {
+		conference = strings.TrimSpace(*body.Conference)
+	}
+	var count, maxTeams int
+	db.QueryRow("SELECT COUNT(*) FROM league_divisions WHERE league_id = ?", leagueID).Scan(&count)
+	db.QueryRow("SELECT max_teams FROM leagues WHERE id = ?", leagueID).Scan(&maxTeams)
+	if count >= maxTeams/2 {
+		return newAPIError(400, "TOO_MANY_DIVISIONS", "Each division needs room for at least two teams").with("max_divisions", maxTeams/2)
+	}
+	res, err := db.Exec("INSERT INTO league_divisions (league_id, name, conference, position) VALUES (?, ?, ?, ?)",
+		leagueID, name, conference, count+1)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return newAPIError(409, "DIVISION_EXISTS", "There's already a division called "+name)
+		}
+		return fiber.NewError(500, err.Error())
+	}
+	id, _ := res.LastInsertId()
+	logLeagueAction(db, leagueID, getUserID(c), "division_created", 0, "Created division "+name)
+	return c.Status(201).JSON(fiber.Map{"id": id, "name": name, "conference": conference, "teams": []fiber.Map{}})
+}
+
+// updateDivision renames a division or moves it to another conference.
+func updateDivision(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	divisionID, _ := strconv.Atoi(c.Params("divisionId"))
+	status, err := requireCommissioner(c, leagueID)
+	if err != nil {
+		return err
+	}
+	if status == "completed" {
+		return newAPIError(400, errLeagueCompleted, "A completed league's settings are final")
+	}
+	var d division
+	if err := db.QueryRow("SELECT id, name, conference FROM league_divisions WHERE id = ? AND league_id = ?", divisionID, leagueID).
+		Scan(&d.ID, &d.Name, &d.Conference); err != nil {
+		return newAPIError(404, errDivisionNotFound, "Division not found")
+	}
+	var body divisionBody
+	if err := c.BodyParser(&body); err != nil {
+		return newAPIError(400, "INVALID_REQUEST", "Invalid request")
+	}
+	name, conference := d.Name, d.Conference
+	if body.Name != nil {
+		if name = strings.TrimSpace(*body.Name); name == "" {
+			return newAPIError(400, "INVALID_REQUEST", "Division name required")
+		}
+	}
+	if body.Conference != nil {
+		conference = strings.TrimSpace(*body.Conference)
+	}
+	if _, err := db.Exec("UPDATE league_divisions SET name = ?, conference = ? WHERE id = ?", name, conference, divisionID); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return newAPIError(409, "DIVISION_EXISTS", "There's already a division called "+name)
+		}
+		return fiber.NewError(500, err.Error())
+	}
+	if name != d.Name || conference != d.Conference {
+		logLeagueAction(db, leagueID, getUserID(c), "division_updated", 0, "Updated division "+d.Name)
+	}
+	return c.JSON(fiber.Map{"id": divisionID, "name": name, "conference": conference})
+}
+
+// deleteDivision removes a division; its teams become unassigned.
+func deleteDivision(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	divisionID, _ := strconv.Atoi(c.Params("divisionId"))
+	if err := requireDivisionsEditable(c, leagueID); err != nil {
+		return err
+	}
+	var name string
+	if err := db.QueryRow("SELECT name FROM league_divisions WHERE id = ? AND league_id = ?", divisionID, leagueID).Scan(&name); err != nil {
+		return newAPIError(404, errDivisionNotFound, "Division not found")
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	tx.Exec("UPDATE teams SET division_id = NULL WHERE division_id = ?", divisionID)
+	tx.Exec("DELETE FROM league_divisions WHERE id = ?", divisionID)
+	logLeagueAction(tx, leagueID, getUserID(c), "division_deleted", 0, "Deleted division "+name)
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	return c.JSON(fiber.Map{"message": "Division deleted"})
+}
+
+// assignDivision puts a team in a division, or takes it out with a null
+// division_id.
+func assignDivision(c *fiber.Ctx) error {
+	teamID, _ := strconv.Atoi(c.Params("id"))
+	leagueID, _, err := loadTeam(teamID)
+	if err != nil {
+		return err
+	}
+	if err := requireDivisionsEditable(c, leagueID); err != nil {
+		return err
+	}
+	var body struct {
+		DivisionID *int `json:"division_id"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return newAPIError(400, "INVALID_REQUEST", "Invalid request")
+	}
+	var divisionID interface{}
+	what := "no division"
+	if body.DivisionID != nil {
+		var name string
+		if err := db.QueryRow("SELECT name FROM league_divisions WHERE id = ? AND league_id = ?", *body.DivisionID, leagueID).Scan(&name); err != nil {
+			return newAPIError(404, errDivisionNotFound, "Division not found")
+		}
+		divisionID, what = *body.DivisionID, name
+	}
+	var current sql.NullInt64
+	db.QueryRow("SELECT division_id FROM teams WHERE id = ?", teamID).Scan(&current)
+	if (!current.Valid && divisionID == nil) || (current.Valid && divisionID == int(current.Int64)) {
+		return c.JSON(fiber.Map{"team_id": teamID, "division_id": divisionID})
+	}
+	db.Exec("UPDATE teams SET division_id = ? WHERE id = ?", divisionID, teamID)
+	logLeagueAction(db, leagueID, getUserID(c), "division_assigned", teamID, "Moved "+teamName(teamID)+" to "+what)
+	return c.JSON(fiber.Map{"team_id": teamID, "division_id": divisionID})
+}
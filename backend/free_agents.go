@@ -0,0 +1,136 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// --- Free Agents ---
+//
+// A movie's availability is league-specific: "rostered" when a team in the
+// league holds it, "on_waivers" while a recent drop's waiver period runs,
+// and "free_agent" otherwise. Only movies releasing inside the league's
+// season window are eligible.
+
+var freeAgentSorts = map[string]string{
+	"points":           "points",
+	"projected_points": "projected_points",
+	"release_date":     "release_date",
+	"budget":           "budget",
+	"title":            "title",
+}
+
+func getFreeAgents(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+
+	var seasonStart, seasonEnd string
+	err := db.QueryRow("SELECT season_start, season_end FROM leagues WHERE id = ?", leagueID).Scan(&seasonStart, &seasonEnd)
+	if err != nil {
+		return newAPIError(404, errLeagueNotFound, "League not found")
+	}
+
+	query := `SELECT * FROM (
+		SELECT m.id, COALESCE(m.tmdb_id, 0) AS tmdb_id, m.title, COALESCE(m.release_date, '') AS release_date, m.poster_url,
+			m.budget, m.domestic_gross, m.worldwide_gross, m.rt_score, m.status, m.points, m.projected_points,
+			COALESCE((SELECT t.id FROM roster r JOIN teams t ON t.id = r.team_id WHERE t.league_id = ? AND r.movie_id = m.id), 0) AS team_id,
+			COALESCE((SELECT MAX(ww.available_at) FROM waiver_wire ww
+				WHERE ww.league_id = ? AND ww.movie_id = m.id AND ww.available_at > datetime('now')), '') AS waiver_until
+		FROM movies m WHERE m.release_date >= ? AND m.release_date <= ?
+	) WHERE 1=1`
+	args := []interface{}{leagueID, leagueID, seasonStart, seasonEnd}
+
+	switch c.Query("availability", "available") {
+	case "available":
+		query += " AND team_id = 0"
+	case "free_agent":
+		query += " AND team_id = 0 AND waiver_until = ''"
+	case "on_waivers":
+		query += " AND team_id = 0 AND waiver_until != ''"
+	case "rostered":
+		query += " AND team_id != 0"
+	case "all":
+	default:
+		return newAPIError(400, "INVALID_FILTER", "availability must be available, free_agent, on_waivers, rostered or all")
+	}
+	if status := c.Query("status"); status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	if search := c.Query("search"); search != "" {
+		query += " AND title LIKE ?"
+		args = append(args, "%"+search+"%")
+	}
+	if v := c.Query("min_budget"); v != "" {
+		query += " AND budget >= ?"
+		args = append(args, atoi(v))
+	}
+	if v := c.Query("max_budget"); v != "" {
+		query += " AND budget <= ?"
+		args = append(args, atoi(v))
+	}
+	if v := c.Query("released_after"); v != "" {
+		query += " AND release_date >= ?"
+		args = append(args, v)
+	}
+	if v := c.Query("released_before"); v != "" {
+		query += " AND release_date <= ?"
+		args = append(args, v)
+	}
+
+	sortCol, ok := freeAgentSorts[c.Query("sort", "projected_points")]
+	if !ok {
+		return newAPIError(400, "INVALID_FILTER", "sort must be points, projected_points, release_date, budget or title")
+	}
+	order := c.Query("order")
+	if order == "" {
+		order = "desc"
+		if sortCol == "release_date" || sortCol == "title" {
+			order = "asc"
+		}
+	}
+	if order != "asc" && order != "desc" {
+		return newAPIError(400, "INVALID_FILTER", "order must be asc or desc")
+	}
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 500 {
+		limit = 100
+	}
+	query += " ORDER BY " + sortCol + " " + order + ", id LIMIT ? OFFSET ?"
+	args = append(args, limit, c.QueryInt("offset", 0))
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	defer rows.Close()
+
+	movies := []fiber.Map{}
+	for rows.Next() {
+		var id, tmdbID, teamID int
+		var title, relDate, poster, mstatus, waiverUntil string
+		var budget, domGross, wwGross, rt, pts, projPts float64
+		rows.Scan(&id, &tmdbID, &title, &relDate, &poster, &budget, &domGross, &wwGross, &rt, &mstatus, &pts, &projPts, &teamID, &waiverUntil)
+		m := fiber.Map{
+			"id": id, "tmdb_id": tmdbID, "title": title, "release_date": relDate,
+			"poster_url": poster, "budget": budget, "domestic_gross": domGross,
+			"worldwide_gross": wwGross, "rt_score": rt, "status": mstatus,
+			"points": pts, "projected_points": projPts,
+			"availability": "free_agent", "waiver_until": nil, "team_id": nil,
+		}
+		switch {
+		case teamID != 0:
+			m["availability"] = "rostered"
+			m["team_id"] = teamID
+			m["team_name"] = teamName(teamID)
+		case waiverUntil != "":
+			m["availability"] = "on_waivers"
+			if t, err := time.Parse("2006-01-02 15:04:05", waiverUntil); err == nil {
+				m["waiver_until"] = t.Format(time.RFC3339)
+			}
+		}
+		movies = append(movies, m)
+	}
+	return c.JSON(movies)
+}
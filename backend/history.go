@@ -0,0 +1,347 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// --- Season History ---
+//
+// Completed leagues are archived in league_results (final standings) and
+// league_result_picks (every draft pick with the movie's final numbers).
+// All-time records and career stats are built from the archive only, so
+// they don't move when live movie data changes.
+//
+// A league started as the next season of an earlier one points at it with
+// previous_league_id. Those chains are a league's lineage; history can be
+// filtered to one lineage with ?league_id= (any league in the chain).
+
+// archiveLeague writes a league's final standings, in finishing order, and
+// its draft picks to the archive. The archive is never rewritten, so any
+// failure is returned for the caller to roll back.
+func archiveLeague(tx *sql.Tx, leagueID int, standings []finalStanding) error {
+	var seasonYear int
+	if err := tx.QueryRow("SELECT season_year FROM leagues WHERE id = ?", leagueID).Scan(&seasonYear); err != nil {
+		return err
+	}
+	for i, s := range standings {
+		_, err := tx.Exec(`INSERT INTO league_results (league_id, season_year, team_id, user_id, team_name, owner_name, final_rank,
+			total_points, wins, losses, ties, points_for, points_against, champion)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			leagueID, seasonYear, s.TeamID, s.UserID, s.TeamName, s.OwnerName, i+1,
+			s.Points, s.Record.Wins, s.Record.Losses, s.Record.Ties, s.Record.PointsFor, s.Record.PointsAg, i == 0)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(`INSERT INTO league_result_picks (league_id, season_year, team_id, user_id, team_name, owner_name,
+			movie_id, movie_title, draft_round, pick_number, points, budget, worldwide_gross)
+		SELECT dp.league_id, ?, t.id, t.user_id, t.name, u.display_name,
+			m.id, m.title, dp.round, dp.pick_number, m.points, m.budget, m.worldwide_gross
+		FROM draft_picks dp JOIN teams t ON t.id = dp.team_id JOIN users u ON u.id = t.user_id JOIN movies m ON m.id = dp.movie_id
+		WHERE dp.league_id = ?`, seasonYear, leagueID)
+	return err
+}
+
+// archiveCompletedLeagues archives leagues that completed before the
+// archive existed.
+func archiveCompletedLeagues() {
+	rows, err := db.Query(`SELECT id FROM leagues WHERE status = 'completed'
+		AND id NOT IN (SELECT DISTINCT league_id FROM league_results)`)
+	if err != nil {
+		return
+	}
+	var leagues []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		leagues = append(leagues, id)
+	}
+	rows.Close()
+	for _, id := range leagues {
+		standings := finalStandings(id)
+		if len(standings) == 0 {
+			continue
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return
+		}
+		if err := archiveLeague(tx, id, standings); err != nil {
+			tx.Rollback()
+			log.Printf("Failed to archive league %d: %v", id, err)
+			continue
+		}
+		tx.Exec("UPDATE leagues SET champion_team_id = COALESCE(champion_team_id, ?) WHERE id = ?", standings[0].TeamID, id)
+		tx.Commit()
+	}
+}
+
+// leagueLineage returns every league in the same chain of seasons as
+// leagueID, oldest first.
+func leagueLineage(leagueID int) []int {
+	root := leagueID
+	seen := map[int]bool{root: true}
+	for {
+		var prev sql.NullInt64
+		db.QueryRow("SELECT previous_league_id FROM leagues WHERE id = ?", root).Scan(&prev)
+		if !prev.Valid || seen[int(prev.Int64)] {
+			break
+		}
+		root = int(prev.Int64)
+		seen[root] = true
+	}
+	lineage := []int{root}
+	for i := 0; i < len(lineage); i++ {
+		rows, err := db.Query("SELECT id FROM leagues WHERE previous_league_id = ? ORDER BY id", lineage[i])
+		if err != nil {
+			break
+		}
+		for rows.Next() {
+			var id int
+			rows.Scan(&id)
+			lineage = append(lineage, id)
+		}
+		rows.Close()
+	}
+	return lineage
+}
+
+// historyFilter narrows archive queries to a lineage and/or a user. With
+// Restricted set, only public leagues and leagues ViewerID played in or
+// runs are included.
+type historyFilter struct {
+	LeagueIDs  []int
+	UserID     int
+	Restricted bool
+	ViewerID   int
+}
+
+// where returns a WHERE clause (with the given table alias) and its args.
+func (f historyFilter) where(alias string) (string, []interface{}) {
+	clauses := []string{"1=1"}
+	var args []interface{}
+	if len(f.LeagueIDs) > 0 {
+		clauses = append(clauses, alias+".league_id IN (?"+strings.Repeat(", ?", len(f.LeagueIDs)-1)+")")
+		for _, id := range f.LeagueIDs {
+			args = append(args, id)
+		}
+	}
+	if f.UserID > 0 {
+		clauses = append(clauses, alias+".user_id = ?")
+		args = append(args, f.UserID)
+	}
+	if f.Restricted {
+		clauses = append(clauses, alias+`.league_id IN (SELECT id FROM leagues WHERE visibility = 'public' OR owner_id = ?
+			OR id IN (SELECT league_id FROM league_results WHERE user_id = ?)
+			OR id IN (SELECT league_id FROM teams WHERE user_id = ?)
+			OR id IN (SELECT league_id FROM league_commissioners WHERE user_id = ?))`)
+		args = append(args, f.ViewerID, f.ViewerID, f.ViewerID, f.ViewerID)
+	}
+	return strings.Join(clauses, " AND "), args
+}
+
+func historyWinners(f historyFilter) []fiber.Map {
+	where, args := f.where("r")
+	rows, err := db.Query(`SELECT r.league_id, l.name, r.season_year, r.team_name, r.owner_name, r.user_id, r.total_points
+		FROM league_results r JOIN leagues l ON l.id = r.league_id
+		WHERE r.champion = 1 AND `+where+` ORDER BY r.season_year DESC, r.league_id DESC`, args...)
+	if err != nil {
+		return []fiber.Map{}
+	}
+	defer rows.Close()
+	winners := []fiber.Map{}
+	for rows.Next() {
+		var leagueID, year, userID int
+		var leagueName, teamName, owner string
+		var points float64
+		rows.Scan(&leagueID, &leagueName, &year, &teamName, &owner, &userID, &points)
+		winners = append(winners, fiber.Map{
+			"league_id": leagueID, "league_name": leagueName, "season_year": year,
+			"team_name": teamName, "owner": owner, "user_id": userID, "total_points": points,
+		})
+	}
+	return winners
+}
+
+func historyRecords(f historyFilter) []fiber.Map {
+	records := []fiber.Map{}
+	add := func(kind, label, value, holder string, year, leagueID int) {
+		records = append(records, fiber.Map{
+			"type": kind, "label": label, "value": value, "holder": holder,
+			"season_year": year, "league_id": leagueID,
+		})
+	}
+	holder := func(team, owner string) string { return fmt.Sprintf("%s (%s)", team, owner) }
+
+	where, args := f.where("r")
+	var leagueID, year int
+	var team, owner, title string
+	var points, budget, gross float64
+	if db.QueryRow(`SELECT r.league_id, r.season_year, r.team_name, r.owner_name, r.total_points FROM league_results r
+		WHERE `+where+` ORDER BY r.total_points DESC LIMIT 1`, args...).
+		Scan(&leagueID, &year, &team, &owner, &points) == nil {
+		add("highest_team_score", "Highest Team Score", fmt.Sprintf("%.1f pts", points), holder(team, owner), year, leagueID)
+	}
+
+	where, args = f.where("p")
+	var round, pick int
+	if db.QueryRow(`SELECT p.league_id, p.season_year, p.team_name, p.owner_name, p.movie_title, p.points, p.draft_round, p.pick_number
+		FROM league_result_picks p WHERE `+where+` ORDER BY p.points DESC LIMIT 1`, args...).
+		Scan(&leagueID, &year, &team, &owner, &title, &points, &round, &pick) == nil {
+		add("best_pick", "Best Single Pick", fmt.Sprintf("%s (%.1f pts, round %d pick %d)", title, points, round, pick),
+			holder(team, owner), year, leagueID)
+	}
+
+	// The biggest flop earned back the smallest share of its budget.
+	if db.QueryRow(`SELECT p.league_id, p.season_year, p.team_name, p.owner_name, p.movie_title, p.budget, p.worldwide_gross
+		FROM league_result_picks p WHERE p.budget > 0 AND p.worldwide_gross > 0 AND `+where+`
+		ORDER BY p.worldwide_gross / p.budget LIMIT 1`, args...).
+		Scan(&leagueID, &year, &team, &owner, &title, &budget, &gross) == nil {
+		add("biggest_flop", "Biggest Flop", fmt.Sprintf("%s ($%.0fM on a $%.0fM budget)", title, gross/1e6, budget/1e6),
+			holder(team, owner), year, leagueID)
+	}
+	return records
+}
+
+func historyCareers(f historyFilter) []fiber.Map {
+	where, args := f.where("r")
+	rows, err := db.Query(`SELECT r.user_id, u.display_name, COUNT(*), SUM(r.champion), AVG(r.final_rank), MIN(r.final_rank),
+			SUM(r.total_points), SUM(r.wins), SUM(r.losses), SUM(r.ties)
+		FROM league_results r JOIN users u ON u.id = r.user_id WHERE `+where+`
+		GROUP BY r.user_id ORDER BY SUM(r.champion) DESC, AVG(r.final_rank), SUM(r.total_points) DESC`, args...)
+	if err != nil {
+		return []fiber.Map{}
+	}
+	defer rows.Close()
+	careers := []fiber.Map{}
+	for rows.Next() {
+		var userID, seasons, titles, best, wins, losses, ties int
+		var name string
+		var avgFinish, points float64
+		rows.Scan(&userID, &name, &seasons, &titles, &avgFinish, &best, &points, &wins, &losses, &ties)
+		careers = append(careers, fiber.Map{
+			"user_id": userID, "display_name": name, "seasons": seasons, "titles": titles,
+			"average_finish": avgFinish, "best_finish": best, "total_points": points,
+			"wins": wins, "losses": losses, "ties": ties,
+		})
+	}
+	return careers
+}
+
+// historySeasons lists each archived league's final standings. With a user
+// filter it lists the leagues that user played in.
+func historySeasons(f historyFilter) []fiber.Map {
+	where, args := f.where("r")
+	rows, err := db.Query(`SELECT DISTINCT r.league_id, l.name, r.season_year, l.previous_league_id, l.completed_at
+		FROM league_results r JOIN leagues l ON l.id = r.league_id WHERE `+where+`
+		ORDER BY r.season_year DESC, r.league_id DESC`, args...)
+	if err != nil {
+		return []fiber.Map{}
+	}
+	seasons := []fiber.Map{}
+	var leagueIDs []int
+	for rows.Next() {
+		var leagueID, year int
+		var name string
+		var prev sql.NullInt64
+		var completedAt sql.NullTime
+		rows.Scan(&leagueID, &name, &year, &prev, &completedAt)
+		season := fiber.Map{
+			"league_id": leagueID, "league_name": name, "season_year": year,
+			"previous_league_id": nil, "completed_at": nil,
+		}
+		if prev.Valid {
+			season["previous_league_id"] = prev.Int64
+		}
+		if completedAt.Valid {
+			season["completed_at"] = completedAt.Time.UTC().Format(time.RFC3339)
+		}
+		seasons = append(seasons, season)
+		leagueIDs = append(leagueIDs, leagueID)
+	}
+	rows.Close()
+
+	for i, leagueID := range leagueIDs {
+		rows, err := db.Query(`SELECT team_id, user_id, team_name, owner_name, final_rank, total_points, wins, losses, ties, champion
+			FROM league_results WHERE league_id = ? ORDER BY final_rank`, leagueID)
+		if err != nil {
+			continue
+		}
+		standings := []fiber.Map{}
+		for rows.Next() {
+			var teamID, userID, rank, wins, losses, ties int
+			var team, owner string
+			var points float64
+			var champion bool
+			rows.Scan(&teamID, &userID, &team, &owner, &rank, &points, &wins, &losses, &ties, &champion)
+			standings = append(standings, fiber.Map{
+				"team_id": teamID, "user_id": userID, "team_name": team, "owner": owner, "final_rank": rank,
+				"total_points": points, "wins": wins, "losses": losses, "ties": ties, "champion": champion,
+			})
+		}
+		rows.Close()
+		seasons[i]["standings"] = standings
+	}
+	return seasons
+}
+
+// getSeasonHistory returns champions, all-time records, career stats and
+// archived standings, optionally filtered by ?league_id= (the league's
+// whole lineage, if the caller can see that league) and ?user_id=.
+// Without a league filter only leagues the caller can see are included.
+func getSeasonHistory(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user_id").(int)
+	f := historyFilter{LeagueIDs: []int{}, Restricted: true, ViewerID: userID}
+	if v := c.Query("league_id"); v != "" {
+		leagueID, _ := strconv.Atoi(v)
+		a, err := resolveLeagueAccess(leagueID, userID)
+		if err != nil {
+			return err
+		}
+		if err := a.allow(false, fiber.MethodGet); err != nil {
+			return err
+		}
+		f.LeagueIDs = leagueLineage(leagueID)
+		f.Restricted = false
+	}
+	if v := c.Query("user_id"); v != "" {
+		f.UserID, _ = strconv.Atoi(v)
+	}
+
+	return c.JSON(fiber.Map{
+		"lineage": f.LeagueIDs,
+		"winners": historyWinners(f),
+		"records": historyRecords(f),
+		"careers": historyCareers(f),
+		"seasons": historySeasons(f),
+	})
+}
+
+// validatePreviousLeague checks a new league can continue an earlier one:
+// the creator must run it, it must be finished, and it can only be
+// continued once.
+func validatePreviousLeague(userID, previousID int) error {
+	var status string
+	if err := db.QueryRow("SELECT status FROM leagues WHERE id = ?", previousID).Scan(&status); err != nil {
+		return newAPIError(404, errLeagueNotFound, "Previous league not found").with("previous_league_id", previousID)
+	}
+	if !isCommissioner(previousID, userID) {
+		return newAPIError(403, errNotCommissioner, "Only the previous league's commissioner can continue it")
+	}
+	if status != "completed" {
+		return newAPIError(400, "LEAGUE_NOT_COMPLETED", "The previous league hasn't finished yet").with("status", status)
+	}
+	var next int
+	db.QueryRow("SELECT COUNT(*) FROM leagues WHERE previous_league_id = ?", previousID).Scan(&next)
+	if next > 0 {
+		return newAPIError(409, "LEAGUE_ALREADY_CONTINUED", "The previous league already has a next season").with("previous_league_id", previousID)
+	}
+	return nil
+}
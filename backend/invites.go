@@ -0,0 +1,472 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// --- League Invites ---
+//
+// A league can have any number of invite codes. Commissioners create them
+// with an optional expiry and use limit, and can revoke them at any time.
+// An invite can also be addressed to an email: it is mailed to that
+// address, can be used once, and only by the account with that email.
+// Every use is recorded in league_invite_uses, so the commissioner can see
+// who joined through which invite and which addressed invites are still
+// pending.
+//
+// leagues.invite_code is the code the league was created with; it lives on
+// as an ordinary invite in league_invites.
+
+const (
+	errInviteNotFound     = "INVITE_NOT_FOUND"
+	errInviteInvalid      = "INVITE_INVALID"
+	errInviteWrongAccount = "INVITE_WRONG_ACCOUNT"
+	errInviteRevoked      = "INVITE_REVOKED"
+)
+
+// maxInviteHours caps how far out an invite can expire.
+const maxInviteHours = 24 * 180
+
+type leagueInvite struct {
+	ID, LeagueID, CreatedBy int
+	Code, Email             string
+	MaxUses, Uses           int // MaxUses 0 = unlimited
+	ExpiresAt, RevokedAt    sql.NullTime
+	EmailSentAt             sql.NullTime
+	EmailError              string
+	CreatedAt               time.Time
+}
+
+const inviteColumns = `i.id, i.league_id, i.created_by, i.code, COALESCE(i.email, ''), i.max_uses,
+	(SELECT COUNT(*) FROM league_invite_uses u WHERE u.invite_id = i.id), i.expires_at, i.revoked_at,
+	i.email_sent_at, i.email_error, i.created_at`
+
+func scanInvite(row interface{ Scan(...interface{}) error }) (*leagueInvite, error) {
+	var inv leagueInvite
+	err := row.Scan(&inv.ID, &inv.LeagueID, &inv.CreatedBy, &inv.Code, &inv.Email, &inv.MaxUses, &inv.Uses,
+		&inv.ExpiresAt, &inv.RevokedAt, &inv.EmailSentAt, &inv.EmailError, &inv.CreatedAt)
+	return &inv, err
+}
+
+// state is "revoked", "expired", "used" (no uses left) or "active".
+func (inv *leagueInvite) state(now time.Time) string {
+	switch {
+	case inv.RevokedAt.Valid:
+		return "revoked"
+	case inv.ExpiresAt.Valid && !now.Before(inv.ExpiresAt.Time):
+		return "expired"
+	case inv.MaxUses > 0 && inv.Uses >= inv.MaxUses:
+		return "used"
+	}
+	return "active"
+}
+
+func (inv *leagueInvite) toMap(now time.Time) fiber.Map {
+	m := fiber.Map{
+		"id": inv.ID, "league_id": inv.LeagueID, "code": inv.Code, "link": appURL + "/join/" + inv.Code,
+		"created_by": inv.CreatedBy, "created_at": inv.CreatedAt, "email": nil, "max_uses": nil, "uses": inv.Uses,
+		"expires_at": nil, "revoked_at": nil, "status": inv.state(now),
+	}
+	if inv.Email != "" {
+		m["email"] = inv.Email
+		m["email_sent_at"] = nil
+		if inv.EmailSentAt.Valid {
+			m["email_sent_at"] = inv.EmailSentAt.Time
+		}
+		m["email_error"] = inv.EmailError
+	}
+	if inv.MaxUses > 0 {
+		m["max_uses"] = inv.MaxUses
+	}
+	if inv.ExpiresAt.Valid {
+		m["expires_at"] = inv.ExpiresAt.Time
+	}
+	if inv.RevokedAt.Valid {
+		m["revoked_at"] = inv.RevokedAt.Time
+	}
+	return m
+}
+
+// usable explains why an invite can't be used right now, if it can't.
+func (inv *leagueInvite) usable(now time.Time) error {
+	switch inv.state(now) {
+	case "revoked":
+		return newAPIError(410, errInviteInvalid, "This invite has been revoked").with("status", "revoked")
+	case "expired":
+		return newAPIError(410, errInviteInvalid, "This invite has expired").with("status", "expired")
+	case "used":
+		return newAPIError(410, errInviteInvalid, "This invite has already been used").with("status", "used")
+	}
+	return nil
+}
+
+func loadInviteByCode(q queryer, code string) (*leagueInvite, error) {
+	inv, err := scanInvite(q.QueryRow("SELECT "+inviteColumns+" FROM league_invites i WHERE i.code = ?", code))
+	if err != nil {
+		return nil, newAPIError(404, errInviteNotFound, "Invalid invite code")
+	}
+	return inv, nil
+}
+
+// createInvite stores a new invite code for a league.
+func createInvite(ex execer, leagueID, createdBy int, email string, maxUses int, expiresAt interface{}) (int, string, error) {
+	code := uuid.New().String()
+	var addressed interface{}
+	if email != "" {
+		addressed = email
+	}
+	res, err := ex.Exec("INSERT INTO league_invites (league_id, code, created_by, email, max_uses, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		leagueID, code, createdBy, addressed, maxUses, expiresAt)
+	if err != nil {
+		return 0, "", err
+	}
+	id, _ := res.LastInsertId()
+	return int(id), code, nil
+}
+
+// getLeagueInvite returns a shareable invite for the league, creating one
+// if every open invite has been revoked, expired or used up.
+func getLeagueInvite(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	if _, err := requireCommissioner(c, leagueID); err != nil {
+		return err
+	}
+	rows, err := db.Query("SELECT "+inviteColumns+" FROM league_invites i WHERE i.league_id = ? AND i.email IS NULL ORDER BY i.id DESC", leagueID)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	now := time.Now()
+	var code string
+	for rows.Next() {
+		inv, err := scanInvite(rows)
+		if err == nil && inv.state(now) == "active" {
+			code = inv.Code
+			break
+		}
+	}
+	rows.Close()
+	if code == "" {
+		if _, code, err = createInvite(db, leagueID, getUserID(c), "", 0, nil); err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+	}
+	return c.JSON(fiber.Map{"invite_code": code})
+}
+
+// getLeagueInvites lists a league's invites, newest first, with who joined
+// through each. ?status= narrows it to active, pending (addressed invites
+// nobody has accepted yet), expired, revoked or used.
+func getLeagueInvites(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	if _, err := requireCommissioner(c, leagueID); err != nil {
+		return err
+	}
+	filter := c.Query("status", "all")
+	switch filter {
+	case "all", "active", "pending", "expired", "revoked", "used":
+	default:
+		return newAPIError(400, "INVALID_FILTER", "status must be active, pending, expired, revoked, used or all")
+	}
+
+	rows, err := db.Query("SELECT "+inviteColumns+" FROM league_invites i WHERE i.league_id = ? ORDER BY i.created_at DESC, i.id DESC", leagueID)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	now := time.Now()
+	var invites []*leagueInvite
+	for rows.Next() {
+		inv, err := scanInvite(rows)
+		if err != nil {
+			continue
+		}
+		state := inv.state(now)
+		pending := inv.Email != "" && state == "active"
+		if filter == "all" || filter == state || (filter == "pending" && pending) {
+			invites = append(invites, inv)
+		}
+	}
+	rows.Close()
+
+	uses := make(map[int][]fiber.Map)
+	rows, err = db.Query(`SELECT u.invite_id, u.user_id, usr.display_name, u.team_id, u.accepted_at
+		FROM league_invite_uses u JOIN league_invites i ON i.id = u.invite_id JOIN users usr ON usr.id = u.user_id
+		WHERE i.league_id = ? ORDER BY u.accepted_at, u.id`, leagueID)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	for rows.Next() {
+		var inviteID, userID int
+		var teamID sql.NullInt64
+		var name string
+		var acceptedAt time.Time
+		rows.Scan(&inviteID, &userID, &name, &teamID, &acceptedAt)
+		use := fiber.Map{"user_id": userID, "display_name": name, "team_id": nil, "accepted_at": acceptedAt}
+		if teamID.Valid {
+			use["team_id"] = teamID.Int64
+		}
+		uses[inviteID] = append(uses[inviteID], use)
+	}
+	rows.Close()
+
+	result := []fiber.Map{}
+	for _, inv := range invites {
+		accepted := uses[inv.ID]
+		if accepted == nil {
+			accepted = []fiber.Map{}
+		}
+		m := inv.toMap(now)
+		m["accepted_by"] = accepted
+		result = append(result, m)
+	}
+	return c.JSON(result)
+}
+
+// createLeagueInvites makes a shareable invite, or with emails, one
+// single-use invite per address and mails each of them.
+func createLeagueInvites(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	if _, err := requireCommissioner(c, leagueID); err != nil {
+		return err
+	}
+	userID := getUserID(c)
+	var body struct {
+		MaxUses        int      `json:"max_uses"`
+		ExpiresInHours int      `json:"expires_in_hours"`
+		ExpiresAt      string   `json:"expires_at"`
+		Emails         []string `json:"emails"`
+		Message        string   `json:"message"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return newAPIError(400, "INVALID_REQUEST", "Invalid request")
+	}
+	if err := leagueOpenForTeams(db, leagueID); err != nil {
+		return err
+	}
+	if body.MaxUses < 0 {
+		return newAPIError(400, "INVALID_REQUEST", "max_uses can't be negative")
+	}
+
+	now := time.Now()
+	var expiresAt interface{}
+	switch {
+	case body.ExpiresAt != "":
+		t, ok := parseDraftDate(body.ExpiresAt)
+		if !ok {
+			return newAPIError(400, "INVALID_REQUEST", "expires_at must be a date and time")
+		}
+		if !t.After(now) || t.After(now.Add(maxInviteHours*time.Hour)) {
+			return newAPIError(400, "INVALID_REQUEST", fmt.Sprintf("expires_at must be in the next %d days", maxInviteHours/24))
+		}
+		expiresAt = t.UTC()
+	case body.ExpiresInHours < 0 || body.ExpiresInHours > maxInviteHours:
+		return newAPIError(400, "INVALID_REQUEST", fmt.Sprintf("expires_in_hours must be between 0 and %d", maxInviteHours))
+	case body.ExpiresInHours > 0:
+		expiresAt = now.Add(time.Duration(body.ExpiresInHours) * time.Hour).UTC()
+	}
+
+	var emails []string
+	seen := make(map[string]bool)
+	for _, raw := range body.Emails {
+		addr, err := mail.ParseAddress(strings.TrimSpace(raw))
+		if err != nil {
+			return newAPIError(400, "INVALID_EMAIL", "Not a valid email address: "+raw).with("email", raw)
+		}
+		email := strings.ToLower(addr.Address)
+		if seen[email] {
+			continue
+		}
+		seen[email] = true
+		var inLeague int
+		db.QueryRow("SELECT COUNT(*) FROM teams t JOIN users u ON u.id = t.user_id WHERE t.league_id = ? AND LOWER(u.email) = ?", leagueID, email).Scan(&inLeague)
+		if inLeague > 0 {
+			return newAPIError(409, errAlreadyInLeague, email+" is already in this league").with("email", email)
+		}
+		emails = append(emails, email)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	defer tx.Rollback()
+	var ids []int
+	if len(emails) == 0 {
+		id, _, err := createInvite(tx, leagueID, userID, "", body.MaxUses, expiresAt)
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+		ids = append(ids, id)
+		logLeagueAction(tx, leagueID, userID, "invite_created", 0, "Created an invite link")
+	}
+	for _, email := range emails {
+		id, _, err := createInvite(tx, leagueID, userID, email, 1, expiresAt)
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+		ids = append(ids, id)
+		logLeagueAction(tx, leagueID, userID, "invite_created", 0, "Invited "+email)
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+
+	invites := []fiber.Map{}
+	for _, id := range ids {
+		inv, err := scanInvite(db.QueryRow("SELECT "+inviteColumns+" FROM league_invites i WHERE i.id = ?", id))
+		if err != nil {
+			continue
+		}
+		if inv.Email != "" {
+			go sendInviteEmail(inv, userID, strings.TrimSpace(body.Message))
+		}
+		invites = append(invites, inv.toMap(now))
+	}
+	return c.Status(201).JSON(invites)
+}
+
+// sendInviteEmail mails an addressed invite and records how it went. A user
+// who already has an account with that email also gets a notification.
+func sendInviteEmail(inv *leagueInvite, fromUserID int, note string) {
+	var leagueName, inviter string
+	db.QueryRow("SELECT name FROM leagues WHERE id = ?", inv.LeagueID).Scan(&leagueName)
+	db.QueryRow("SELECT display_name FROM users WHERE id = ?", fromUserID).Scan(&inviter)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s invited you to join %s on Fantasy Box Office.\n\n", inviter, leagueName)
+	if note != "" {
+		fmt.Fprintf(&body, "%q\n\n", note)
+	}
+	fmt.Fprintf(&body, "Join here: %s/join/%s\n", appURL, inv.Code)
+	if inv.ExpiresAt.Valid {
+		fmt.Fprintf(&body, "\nThe invite expires %s.\n", inv.ExpiresAt.Time.UTC().Format("Jan 2, 2006 15:04 MST"))
+	}
+	err := outbox.Send(mailMessage{To: inv.Email, Subject: "You're invited to " + leagueName, Body: body.String()})
+	if err != nil {
+		log.Printf("Failed to send invite %d to %s: %v", inv.ID, inv.Email, err)
+		db.Exec("UPDATE league_invites SET email_error = ? WHERE id = ?", err.Error(), inv.ID)
+		return
+	}
+	db.Exec("UPDATE league_invites SET email_sent_at = CURRENT_TIMESTAMP, email_error = '' WHERE id = ?", inv.ID)
+
+	var userID int
+	if db.QueryRow("SELECT id FROM users WHERE LOWER(email) = ? AND is_system = 0", inv.Email).Scan(&userID) == nil {
+		createNotification(userID, "league_invite", "League Invite",
+			inviter+" invited you to join "+leagueName+".", inv.LeagueID)
+	}
+}
+
+// revokeLeagueInvite stops an invite from being used.
+func revokeLeagueInvite(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	inviteID, _ := strconv.Atoi(c.Params("inviteId"))
+	if _, err := requireCommissioner(c, leagueID); err != nil {
+		return err
+	}
+	inv, err := scanInvite(db.QueryRow("SELECT "+inviteColumns+" FROM league_invites i WHERE i.id = ? AND i.league_id = ?", inviteID, leagueID))
+	if err != nil {
+		return newAPIError(404, errInviteNotFound, "Invite not found")
+	}
+	if inv.RevokedAt.Valid {
+		return newAPIError(400, errInviteRevoked, "This invite has already been revoked")
+	}
+	userID := getUserID(c)
+	db.Exec("UPDATE league_invites SET revoked_at = CURRENT_TIMESTAMP, revoked_by = ? WHERE id = ?", userID, inviteID)
+	what := "an invite link"
+	if inv.Email != "" {
+		what = "the invite for " + inv.Email
+	}
+	logLeagueAction(db, leagueID, userID, "invite_revoked", 0, "Revoked "+what)
+	return c.JSON(fiber.Map{"message": "Invite revoked"})
+}
+
+// previewInvite shows what an invite code is for before it is used.
+func previewInvite(c *fiber.Ctx) error {
+	inv, err := loadInviteByCode(db, c.Params("code"))
+	if err != nil {
+		return err
+	}
+	var name, status string
+	var year, maxTeams, teams int
+	db.QueryRow("SELECT name, season_year, max_teams, status FROM leagues WHERE id = ?", inv.LeagueID).Scan(&name, &year, &maxTeams, &status)
+	db.QueryRow("SELECT COUNT(*) FROM teams WHERE league_id = ?", inv.LeagueID).Scan(&teams)
+	m := inv.toMap(time.Now())
+	for _, key := range []string{"id", "link", "created_by", "uses", "max_uses", "revoked_at", "email_sent_at", "email_error"} {
+		delete(m, key)
+	}
+	m["league_name"], m["season_year"], m["league_status"] = name, year, status
+	m["team_count"], m["max_teams"] = teams, maxTeams
+	return c.JSON(m)
+}
+
+func joinLeagueByInvite(c *fiber.Ctx) error {
+	code := c.Params("code")
+	userIDVal := c.Locals("user_id")
+	if userIDVal == nil {
+		return fiber.NewError(401, "Authentication required")
+	}
+	userID := userIDVal.(int)
+
+	var body struct {
+		TeamName string `json:"team_name"`
+	}
+	c.BodyParser(&body)
+	if body.TeamName == "" {
+		body.TeamName = "My Team"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	defer tx.Rollback()
+	inv, err := loadInviteByCode(tx, code)
+	if err != nil {
+		return err
+	}
+	if err := inv.usable(time.Now()); err != nil {
+		return err
+	}
+	if inv.Email != "" {
+		var email string
+		tx.QueryRow("SELECT email FROM users WHERE id = ?", userID).Scan(&email)
+		if !strings.EqualFold(email, inv.Email) {
+			return newAPIError(403, errInviteWrongAccount, "This invite was sent to a different email address")
+		}
+	}
+	if err := leagueOpenForTeams(tx, inv.LeagueID); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec("INSERT INTO teams (league_id, user_id, name) VALUES (?, ?, ?)", inv.LeagueID, userID, body.TeamName)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return fiber.NewError(409, "Already in this league")
+		}
+		return fiber.NewError(500, err.Error())
+	}
+	teamID, _ := res.LastInsertId()
+	tx.Exec("INSERT INTO league_invite_uses (invite_id, user_id, team_id) VALUES (?, ?, ?)", inv.ID, userID, teamID)
+	// A pending join request is moot once the user is in.
+	tx.Exec("UPDATE league_join_requests SET status = 'withdrawn', decided_at = CURRENT_TIMESTAMP WHERE league_id = ? AND user_id = ? AND status = 'pending'",
+		inv.LeagueID, userID)
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+
+	if inv.Email != "" {
+		var name string
+		db.QueryRow("SELECT display_name FROM users WHERE id = ?", userID).Scan(&name)
+		createNotification(inv.CreatedBy, "invite_accepted", "Invite Accepted",
+			name+" accepted your invite and joined as "+body.TeamName+".", inv.LeagueID)
+	}
+	return c.JSON(fiber.Map{"message": "Joined league", "league_id": inv.LeagueID})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openTestDB points db at a fresh database with the full schema.
+func openTestDB(t *testing.T) {
+	t.Helper()
+	var err error
+	db, err = sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	schema, err := os.ReadFile("schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatal(err)
+	}
+	runMigrations()
+}
+
+func TestPreviewInviteSignedOut(t *testing.T) {
+	openTestDB(t)
+	db.Exec("INSERT INTO users (id, email, password_hash, display_name) VALUES (1, 'owner@example.com', 'x', 'Owner')")
+	db.Exec(`INSERT INTO leagues (id, name, owner_id, season_year, max_teams, invite_code, season_start, season_end)
+		VALUES (1, 'Summer League', 1, 2025, 8, 'abc123', '2025-01-01', '2025-12-31')`)
+	db.Exec("INSERT INTO league_invites (league_id, code, created_by) VALUES (1, 'abc123', 1)")
+	app := newApp()
+
+	tests := []struct {
+		code       string
+		wantStatus int
+		wantLeague string
+	}{
+		{"abc123", 200, "Summer League"},
+		{"nope", 404, ""},
+	}
+	for _, tt := range tests {
+		resp, err := app.Test(httptest.NewRequest("GET", "/api/leagues/join/"+tt.code, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("GET /api/leagues/join/%s: status %d, want %d", tt.code, resp.StatusCode, tt.wantStatus)
+			continue
+		}
+		var body map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		if tt.wantLeague != "" && body["league_name"] != tt.wantLeague {
+			t.Errorf("GET /api/leagues/join/%s: league_name %v, want %q", tt.code, body["league_name"], tt.wantLeague)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// --- League Updates ---
+//
+// The commissioner can change a league's basics and settings with
+// PATCH /leagues/:id. What can change depends on how far the league has
+// got: anything that shapes the draft or the schedule is fixed once the
+// draft starts, bracket options are fixed once the playoffs are seeded, and
+// a completed league can't change at all. Every change is logged in
+// league_setting_changes and members are notified.
+
+const (
+	errSettingLocked   = "SETTING_LOCKED"
+	errLeagueCompleted = "LEAGUE_COMPLETED"
+	errNotCommissioner = "NOT_COMMISSIONER"
+)
+
+// leagueFieldDefs are the basic league columns that can be edited alongside
+// the settings in leagueSettingDefs.
+var leagueFieldDefs = []leagueSetting{
+	{Key: "name", Kind: "string"},
+	{Key: "max_teams", Kind: "int", Min: 2, Max: 32},
+	{Key: "draft_date", Kind: "string"},
+	{Key: "season_start", Kind: "date"},
+	{Key: "season_end", Kind: "date"},
+	{Key: "draft_rounds", Kind: "int", Min: 1, Max: 50},
+}
+
+// settingLocks says when a field stops being editable: "draft" fields only
+// change while the league is pending, "playoffs" fields until the bracket
+// is seeded. Everything else can change until the league completes.
+var settingLocks = map[string]string{
+	"max_teams":                "draft",
+	"draft_date":               "draft",
+	"season_start":             "draft",
+	"season_end":               "draft",
+	"draft_rounds":             "draft",
+	"auto_start_draft":         "draft",
+	"scoring_mode":             "draft",
+	"league_format":            "draft",
+	"waiver_mode":              "draft",
+	"summer_slots":             "draft",
+	"awards_slots":             "draft",
+	"flex_slots":               "draft",
+	"playoff_teams":            "draft",
+	"playoff_weeks_per_round":  "draft",
+	"division_matchups":        "draft",
+	"playoff_seeding":          "playoffs",
+	"playoff_consolation":      "playoffs",
+	"playoff_division_winners": "playoffs",
+}
+
+// settingString renders a field value for the change log and notifications.
+func settingString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case []string:
+		return strings.Join(v, ",")
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprint(v)
+}
+
+// currentLeagueFields reads a league's editable basics and settings.
+func currentLeagueFields(leagueID int) (map[string]interface{}, error) {
+	var name, start, end string
+	var maxTeams, rounds int
+	var draftDate interface{}
+	err := db.QueryRow("SELECT name, max_teams, draft_date, season_start, season_end, draft_rounds FROM leagues WHERE id = ?", leagueID).
+		Scan(&name, &maxTeams, &draftDate, &start, &end, &rounds)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{
+		"name": name, "max_teams": maxTeams, "draft_date": settingString(draftDate),
+		"season_start": start, "season_end": end, "draft_rounds": rounds,
+	}
+	for key, v := range getLeagueSettings(leagueID) {
+		// validateRosterSettings and friends expect ints.
+		if n, ok := v.(int64); ok {
+			v = int(n)
+		}
+		fields[key] = v
+	}
+	return fields, nil
+}
+
+// updateLeague applies the commissioner's changes to a league.
+func updateLeague(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	userID := getUserID(c)
+
+	var status string
+	if err := db.QueryRow("SELECT status FROM leagues WHERE id = ?", leagueID).Scan(&status); err != nil {
+		return newAPIError(404, errLeagueNotFound, "League not found")
+	}
+	if !isCommissioner(leagueID, userID) {
+		return newAPIError(403, errNotCommissioner, "Only the commissioner can change league settings")
+	}
+	if status == "completed" {
+		return newAPIError(400, errLeagueCompleted, "A completed league's settings are final")
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(c.Body(), &raw); err != nil {
+		return newAPIError(400, "INVALID_REQUEST", "Invalid request")
+	}
+	changes, err := parseLeagueSettings(c.Body())
+	if err != nil {
+		return err
+	}
+	for _, f := range leagueFieldDefs {
+		v, ok := raw[f.Key]
+		if !ok {
+			continue
+		}
+		parsed, err := f.parse(v)
+		if err != nil {
+			return newAPIError(400, "INVALID_SETTING", err.Error()).with("setting", f.Key)
+		}
+		if d, ok := parsed.(string); ok && f.Key == "draft_date" && d != "" {
+			// Store the draft date the way the column reads it back.
+			t, ok := parseDraftDate(d)
+			if !ok {
+				return newAPIError(400, "INVALID_SETTING", "draft_date must be a date and time").with("setting", f.Key)
+			}
+			parsed = t.UTC().Format(time.RFC3339)
+		}
+		changes[f.Key] = parsed
+	}
+
+	current, err := currentLeagueFields(leagueID)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	merged := make(map[string]interface{}, len(current))
+	for key, v := range current {
+		merged[key] = v
+	}
+	for key, v := range changes {
+		if settingString(v) == settingString(current[key]) {
+			delete(changes, key)
+			continue
+		}
+		merged[key] = v
+	}
+
+	var playoffGames int
+	db.QueryRow("SELECT COUNT(*) FROM playoff_games WHERE league_id = ?", leagueID).Scan(&playoffGames)
+	for key := range changes {
+		switch settingLocks[key] {
+		case "draft":
+			if status != "pending" {
+				return newAPIError(400, errSettingLocked, key+" can't change after the draft has started").
+					with("setting", key).with("league_status", status)
+			}
+		case "playoffs":
+			if playoffGames > 0 {
+				return newAPIError(400, errSettingLocked, key+" can't change once the playoffs have started").
+					with("setting", key).with("league_status", status)
+			}
+		}
+	}
+
+	if err := validateLeagueFields(leagueID, changes, merged); err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return getLeague(c)
+	}
+
+	keys := make([]string, 0, len(changes))
+	for key := range changes {
+		keys = append(keys, key)
+	}
+	sortByFieldOrder(keys)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	if err := applyLeagueSettings(tx, leagueID, changes); err != nil {
+		tx.Rollback()
+		return fiber.NewError(500, err.Error())
+	}
+	var summary []string
+	for _, key := range keys {
+		from, to := settingString(current[key]), settingString(changes[key])
+		tx.Exec("INSERT INTO league_setting_changes (league_id, user_id, setting, old_value, new_value) VALUES (?, ?, ?, ?, ?)",
+			leagueID, userID, key, from, to)
+		summary = append(summary, fmt.Sprintf("%s from %q to %q", key, from, to))
+	}
+	logLeagueAction(tx, leagueID, userID, "settings_changed", 0, "Changed "+strings.Join(summary, ", "))
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+
+	notifyLeague(leagueID, "league_settings_changed", "League Settings Changed",
+		"The commissioner changed "+strings.Join(summary, ", ")+".", userID)
+	broadcastLeagueEvent(leagueID, fiber.Map{"type": "league_updated", "league_id": leagueID, "changed": keys})
+	return getLeague(c)
+}
+
+// validateLeagueFields checks the league as it would be after the changes.
+func validateLeagueFields(leagueID int, changes, merged map[string]interface{}) error {
+	if name, ok := changes["name"].(string); ok && strings.TrimSpace(name) == "" {
+		return newAPIError(400, "INVALID_SETTING", "League name required").with("setting", "name")
+	}
+	if _, ok := changes["max_teams"]; ok {
+		var teams int
+		db.QueryRow("SELECT COUNT(*) FROM teams WHERE league_id = ?", leagueID).Scan(&teams)
+		if merged["max_teams"].(int) < teams {
+			return newAPIError(400, "INVALID_SETTING", fmt.Sprintf("max_teams can't be less than the %d teams already in the league", teams)).
+				with("setting", "max_teams")
+		}
+	}
+	start, _ := merged["season_start"].(string)
+	end, _ := merged["season_end"].(string)
+	if start != "" && end != "" && start > end {
+		return newAPIError(400, "INVALID_SETTING", "season_start must be on or before season_end").with("setting", "season_start")
+	}
+	rounds, _ := merged["draft_rounds"].(int)
+	if err := validateRosterSettings(rounds, merged); err != nil {
+		return err
+	}
+	maxTeams, _ := merged["max_teams"].(int)
+	return validatePlayoffSettings(maxTeams, merged)
+}
+
+// sortByFieldOrder puts keys in the order fields are declared, basics
+// first, so change logs read the same way every time.
+func sortByFieldOrder(keys []string) {
+	order := make(map[string]int)
+	for i, f := range append(append([]leagueSetting{}, leagueFieldDefs...), leagueSettingDefs...) {
+		order[f.Key] = i
+	}
+	sort.Slice(keys, func(i, j int) bool { return order[keys[i]] < order[keys[j]] })
+}
+
+// getLeagueSettingChanges lists a league's settings changes, newest first.
+func getLeagueSettingChanges(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	rows, err := db.Query(`SELECT c.id, c.user_id, u.display_name, c.setting, c.old_value, c.new_value, c.changed_at
+		FROM league_setting_changes c JOIN users u ON u.id = c.user_id
+		WHERE c.league_id = ? ORDER BY c.changed_at DESC, c.id DESC`, leagueID)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	defer rows.Close()
+	changes := []fiber.Map{}
+	for rows.Next() {
+		var id, uid int
+		var name, setting, from, to string
+		var changedAt time.Time
+		rows.Scan(&id, &uid, &name, &setting, &from, &to, &changedAt)
+		changes = append(changes, fiber.Map{
+			"id": id, "user_id": uid, "changed_by": name, "setting": setting,
+			"old_value": from, "new_value": to, "changed_at": changedAt,
+		})
+	}
+	return c.JSON(changes)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// --- League Lifecycle ---
+//
+// A league moves pending -> drafting -> active -> completed. The draft
+// starts by hand (startDraft) or, when the commissioner turns on
+// auto_start_draft, at draft_date. The draft's last pick makes the league
+// active. A league completes season_grace_days after season_end, leaving
+// time for late grosses to come in.
+//
+// Completing a league freezes its final standings into league_results and
+// its draft into league_result_picks (see history.go). Those rows can't be
+// changed or deleted (triggers reject it), so history survives later roster
+// or scoring changes.
+
+// draftDateLayouts are the formats draft_date is accepted in; the DATETIME
+// column may also hand it back as RFC 3339.
+var draftDateLayouts = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+func parseDraftDate(s string) (time.Time, bool) {
+	for _, layout := range draftDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func scheduledLifecycle() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+	for {
+		<-ticker.C
+		runLifecycle(time.Now())
+	}
+}
+
+// runLifecycle makes every transition that is due at now.
+func runLifecycle(now time.Time) {
+	startDueDrafts(now)
+	completeDueLeagues(now)
+}
+
+func startDueDrafts(now time.Time) {
+	rows, err := db.Query("SELECT id, owner_id, draft_date FROM leagues WHERE status = 'pending' AND auto_start_draft = 1 AND draft_date IS NOT NULL")
+	if err != nil {
+		return
+	}
+	type due struct {
+		leagueID, ownerID int
+	}
+	var leagues []due
+	for rows.Next() {
+		var d due
+		var draftDate sql.NullString
+		rows.Scan(&d.leagueID, &d.ownerID, &draftDate)
+		if t, ok := parseDraftDate(draftDate.String); ok && !t.After(now) {
+			leagues = append(leagues, d)
+		}
+	}
+	rows.Close()
+
+	for _, d := range leagues {
+		if _, err := beginDraft(d.leagueID); err != nil {
+			// Don't retry every few minutes; the commissioner can start it
+			// by hand or turn auto start back on.
+			db.Exec("UPDATE leagues SET auto_start_draft = 0 WHERE id = ?", d.leagueID)
+			createNotification(d.ownerID, "draft_not_started", "Draft Didn't Start",
+				"The draft couldn't start automatically: "+err.Error(), d.leagueID)
+			continue
+		}
+		log.Printf("Auto-started draft for league %d", d.leagueID)
+	}
+}
+
+func completeDueLeagues(now time.Time) {
+	rows, err := db.Query("SELECT id, season_end, season_grace_days FROM leagues WHERE status = 'active' AND season_end != ''")
+	if err != nil {
+		return
+	}
+	var leagues []int
+	for rows.Next() {
+		var id, grace int
+		var seasonEnd string
+		rows.Scan(&id, &seasonEnd, &grace)
+		end, err := time.Parse("2006-01-02", seasonEnd)
+		if err != nil {
+			continue
+		}
+		// season_end is inclusive, so the grace period starts the day after.
+		if !now.Before(end.AddDate(0, 0, 1+grace)) {
+			leagues = append(leagues, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range leagues {
+		// Settle any playoff games the calendar has already decided.
+		advancePlayoffs(id)
+		finalizeLeague(id)
+	}
+}
+
+// finalStanding is a team's place in a league's final standings.
+type finalStanding struct {
+	TeamID, UserID      int
+	TeamName, OwnerName string
+	Points              float64
+	Record              teamRecord
+}
+
+// finalStandings orders a league's teams the way the season ended: the
+// playoff champion and runner-up first, then everyone else by the regular
+// standings (record in h2h leagues, total points otherwise).
+func finalStandings(leagueID int) []finalStanding {
+	var format string
+	var champion sql.NullInt64
+	db.QueryRow("SELECT league_format, champion_team_id FROM leagues WHERE id = ?", leagueID).Scan(&format, &champion)
+
+	rows, err := db.Query(`SELECT t.id, t.user_id, t.name, u.display_name, t.total_points
+		FROM teams t JOIN users u ON u.id = t.user_id WHERE t.league_id = ? ORDER BY t.total_points DESC, t.id`, leagueID)
+	if err != nil {
+		return nil
+	}
+	records := leagueRecords(leagueID)
+	byTeam := make(map[int]finalStanding)
+	var order []int
+	for rows.Next() {
+		var s finalStanding
+		rows.Scan(&s.TeamID, &s.UserID, &s.TeamName, &s.OwnerName, &s.Points)
+		if rec := records[s.TeamID]; rec != nil {
+			s.Record = *rec
+		}
+		byTeam[s.TeamID] = s
+		order = append(order, s.TeamID)
+	}
+	rows.Close()
+
+	if format == "h2h" {
+		order = order[:0]
+		for _, rec := range rankByRecord(records) {
+			order = append(order, rec.TeamID)
+		}
+	}
+
+	var top []int
+	if champion.Valid {
+		top = append(top, int(champion.Int64))
+		var runnerUp sql.NullInt64
+		db.QueryRow(`SELECT CASE WHEN winner_team_id = team1_id THEN team2_id ELSE team1_id END FROM playoff_games
+			WHERE league_id = ? AND bracket = 'championship' AND status = 'final' ORDER BY round DESC LIMIT 1`, leagueID).Scan(&runnerUp)
+		if runnerUp.Valid {
+			top = append(top, int(runnerUp.Int64))
+		}
+	}
+	placed := make(map[int]bool)
+	var standings []finalStanding
+	for _, id := range append(top, order...) {
+		if s, ok := byTeam[id]; ok && !placed[id] {
+			placed[id] = true
+			standings = append(standings, s)
+		}
+	}
+	return standings
+}
+
+// finalizeLeague completes an active league and freezes its results.
+func finalizeLeague(leagueID int) {
+	standings := finalStandings(leagueID)
+	if len(standings) == 0 {
+		return
+	}
+	champion := standings[0]
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	res, err := tx.Exec(`UPDATE leagues SET status = 'completed', completed_at = CURRENT_TIMESTAMP,
+		champion_team_id = COALESCE(champion_team_id, ?) WHERE id = ? AND status = 'active'`, champion.TeamID, leagueID)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return
+	}
+	// The league only completes with its results archived.
+	if err := archiveLeague(tx, leagueID, standings); err != nil {
+		tx.Rollback()
+		log.Printf("Failed to archive league %d: %v", leagueID, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Failed to finalize league %d: %v", leagueID, err)
+		return
+	}
+
+	log.Printf("Finalized league %d", leagueID)
+	notifyLeague(leagueID, "league_completed", "Season Complete",
+		fmt.Sprintf("The season is over. %s finished first; final standings are locked in.", champion.TeamName))
+	broadcastLeagueEvent(leagueID, fiber.Map{"type": "league_completed", "league_id": leagueID, "champion_team_id": champion.TeamID, "champion_team_name": champion.TeamName})
+}
+
+// getLeagueResults returns a completed league's frozen final standings.
+func getLeagueResults(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	var status string
+	if err := db.QueryRow("SELECT status FROM leagues WHERE id = ?", leagueID).Scan(&status); err != nil {
+		return newAPIError(404, errLeagueNotFound, "League not found")
+	}
+	if status != "completed" {
+		return newAPIError(400, "LEAGUE_NOT_COMPLETED", "Results are available once the league completes").with("status", status)
+	}
+
+	rows, err := db.Query(`SELECT team_id, user_id, team_name, owner_name, final_rank, total_points,
+		wins, losses, ties, points_for, points_against, champion, finalized_at
+		FROM league_results WHERE league_id = ? ORDER BY final_rank`, leagueID)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	defer rows.Close()
+	results := []fiber.Map{}
+	for rows.Next() {
+		var teamID, userID, rank, wins, losses, ties int
+		var teamName, ownerName string
+		var points, pf, pa float64
+		var champion bool
+		var finalizedAt time.Time
+		rows.Scan(&teamID, &userID, &teamName, &ownerName, &rank, &points, &wins, &losses, &ties, &pf, &pa, &champion, &finalizedAt)
+		results = append(results, fiber.Map{
+			"team_id": teamID, "user_id": userID, "team_name": teamName, "owner": ownerName,
+			"final_rank": rank, "total_points": points, "wins": wins, "losses": losses, "ties": ties,
+			"points_for": pf, "points_against": pa, "champion": champion, "finalized_at": finalizedAt,
+		})
+	}
+	return c.JSON(fiber.Map{"league_id": leagueID, "results": results})
+}
@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestFinalizeLeagueArchive(t *testing.T) {
+	tests := []struct {
+		name         string
+		breakArchive bool
+		wantStatus   string
+		wantResults  int
+	}{
+		{"archives and completes", false, "completed", 2},
+		{"a failed archive leaves the league active", true, "active", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDB(t)
+			db.Exec(`INSERT INTO users (id, email, password_hash, display_name) VALUES
+				(1, 'a@example.com', 'x', 'A'), (2, 'b@example.com', 'x', 'B')`)
+			db.Exec(`INSERT INTO leagues (id, name, owner_id, season_year, max_teams, invite_code, season_start, season_end, status)
+				VALUES (1, 'League', 1, 2025, 8, 'code', '2025-01-01', '2025-12-31', 'active')`)
+			db.Exec("INSERT INTO teams (id, league_id, user_id, name, total_points) VALUES (1, 1, 1, 'A', 50), (2, 1, 2, 'B', 40)")
+			if tt.breakArchive {
+				db.Exec(`CREATE TRIGGER fail_archive BEFORE INSERT ON league_results WHEN NEW.final_rank = 2
+					BEGIN SELECT RAISE(ABORT, 'archive failed'); END`)
+			}
+
+			finalizeLeague(1)
+
+			var status string
+			var results int
+			db.QueryRow("SELECT status FROM leagues WHERE id = 1").Scan(&status)
+			db.QueryRow("SELECT COUNT(*) FROM league_results WHERE league_id = 1").Scan(&results)
+			if status != tt.wantStatus || results != tt.wantResults {
+				t.Errorf("status %q with %d results, want %q with %d", status, results, tt.wantStatus, tt.wantResults)
+			}
+		})
+	}
+}
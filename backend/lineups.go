@@ -0,0 +1,526 @@
+package main
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+	_ "time/tzdata" // lineup_timezone must resolve even without system zoneinfo
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// --- Lineups ---
+//
+// In leagues with scoring_mode "lineup" each team starts up to lineup_size
+// movies a week, and only starters score. A week begins at the league's
+// weekly lock (lineup_lock_day and lineup_lock_hour in lineup_timezone);
+// week 1 begins at the first lock on or after season_start. Lineups can be
+// changed until their week locks and are fixed after that, even if a
+// starter is dropped or traded mid-week. A team that never set a lineup for
+// a week keeps the previous week's starters that are still on its roster,
+// or starts its best projected movies if it has never set one.
+//
+// Head-to-head leagues and playoffs play on the same weekly schedule.
+// Without lineups, a team's whole roster at the lock starts for the week.
+//
+// Weekly scores come from movie_daily_stats, a snapshot of every movie's
+// grosses and points taken each time scores are recalculated. A starter's
+// score for a week is how much its points grew between the last snapshot
+// before the week and the last snapshot in it. Snapshots are per UTC day,
+// so a week counts from the UTC day it locks.
+
+const (
+	errLineupDisabled  = "LINEUP_MODE_DISABLED"
+	errLineupLocked    = "LINEUP_LOCKED"
+	errLineupTooLarge  = "LINEUP_TOO_LARGE"
+	errLineupForbidden = "LINEUP_FORBIDDEN"
+	errInvalidWeek     = "INVALID_WEEK"
+)
+
+type lineupRules struct {
+	LeagueID                int
+	Mode, Format            string
+	Size, LockDay, LockHour int
+	PlayoffTeams            int
+	Loc                     *time.Location
+	SeasonStart, SeasonEnd  string
+}
+
+func loadLineupRules(q queryer, leagueID int) (lineupRules, error) {
+	r := lineupRules{LeagueID: leagueID}
+	var tz string
+	err := q.QueryRow(`SELECT scoring_mode, league_format, lineup_size, lineup_lock_day, lineup_lock_hour, lineup_timezone,
+		season_start, season_end, playoff_teams FROM leagues WHERE id = ?`, leagueID).
+		Scan(&r.Mode, &r.Format, &r.Size, &r.LockDay, &r.LockHour, &tz, &r.SeasonStart, &r.SeasonEnd, &r.PlayoffTeams)
+	if err != nil {
+		return r, newAPIError(404, errLeagueNotFound, "League not found")
+	}
+	if r.Loc, err = time.LoadLocation(tz); err != nil {
+		r.Loc = time.UTC
+	}
+	return r, nil
+}
+
+func (r lineupRules) enabled() bool { return r.Mode == "lineup" }
+
+// weekly reports whether the league keeps weekly scores at all.
+func (r lineupRules) weekly() bool { return r.enabled() || r.Format == "h2h" || r.PlayoffTeams >= 2 }
+
+// weekStart is when week n (1-based) begins and locks. Dates are built in
+// the league's timezone so the lock stays at the same local time across
+// daylight saving changes.
+func (r lineupRules) weekStart(n int) time.Time {
+	start, err := time.ParseInLocation("2006-01-02", r.SeasonStart, r.Loc)
+	if err != nil {
+		start = time.Now().In(r.Loc)
+	}
+	offset := (r.LockDay - int(start.Weekday()) + 7) % 7
+	return time.Date(start.Year(), start.Month(), start.Day()+offset+7*(n-1), r.LockHour, 0, 0, 0, r.Loc)
+}
+
+// weekAt is the week in progress at t, or 0 before week 1 locks.
+func (r lineupRules) weekAt(t time.Time) int {
+	first := r.weekStart(1)
+	if t.Before(first) {
+		return 0
+	}
+	n := int(t.Sub(first).Hours()/(24*7)) + 1
+	for !r.weekStart(n + 1).After(t) {
+		n++
+	}
+	for n > 1 && r.weekStart(n).After(t) {
+		n--
+	}
+	return n
+}
+
+// lastWeek is the final week of the season, or 0 if the season has no end.
+func (r lineupRules) lastWeek() int {
+	end, err := time.ParseInLocation("2006-01-02", r.SeasonEnd, r.Loc)
+	if err != nil {
+		return 0
+	}
+	return r.weekAt(end.AddDate(0, 0, 1).Add(-time.Second))
+}
+
+func (r lineupRules) currentWeek() int { return r.weekAt(time.Now()) }
+
+func (r lineupRules) weekJSON(n int) fiber.Map {
+	current := r.currentWeek()
+	status := "upcoming"
+	switch {
+	case n < current:
+		status = "complete"
+	case n == current:
+		status = "in_progress"
+	}
+	return fiber.Map{
+		"week": n, "status": status,
+		"starts_at": r.weekStart(n).UTC().Format(time.RFC3339),
+		"ends_at":   r.weekStart(n + 1).UTC().Format(time.RFC3339),
+	}
+}
+
+func lineupMovieIDs(q queryer, teamID, week int) []int {
+	rows, err := q.Query("SELECT movie_id FROM team_lineups WHERE team_id = ? AND week = ? ORDER BY id", teamID, week)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// defaultLineup is who would start in a week nobody set a lineup for: the
+// latest earlier lineup's movies still on the roster, or the team's best
+// projected movies.
+func defaultLineup(q queryer, teamID, week, size int) []int {
+	var prev sql.NullInt64
+	q.QueryRow("SELECT MAX(week) FROM team_lineups WHERE team_id = ? AND week < ?", teamID, week).Scan(&prev)
+	query := `SELECT r.movie_id FROM roster r JOIN movies m ON m.id = r.movie_id
+		WHERE r.team_id = ? ORDER BY MAX(m.points, m.projected_points) DESC, r.movie_id LIMIT ?`
+	args := []interface{}{teamID, size}
+	if prev.Valid {
+		query = `SELECT l.movie_id FROM team_lineups l JOIN roster r ON r.team_id = l.team_id AND r.movie_id = l.movie_id
+			WHERE l.team_id = ? AND l.week = ? ORDER BY l.id LIMIT ?`
+		args = []interface{}{teamID, prev.Int64, size}
+	}
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return []int{}
+	}
+	defer rows.Close()
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func weekLocked(q queryer, teamID, week int) bool {
+	var n int
+	q.QueryRow("SELECT COUNT(*) FROM team_week_scores WHERE team_id = ? AND week = ?", teamID, week).Scan(&n)
+	return n > 0
+}
+
+// lockLineups fixes every team's lineup for each week of an active weekly
+// league that has started but not been locked yet. A team_week_scores row
+// marks the week as locked.
+func lockLineups(leagueID int) {
+	r, err := loadLineupRules(db, leagueID)
+	if err != nil || !r.weekly() || requireActiveLeague(db, leagueID) != nil {
+		return
+	}
+	current := r.currentWeek()
+	if last := r.lastWeek(); last > 0 && current > last {
+		current = last
+	}
+	teams := leagueTeamIDs(leagueID)
+	for week := 1; week <= current; week++ {
+		for _, teamID := range teams {
+			if weekLocked(db, teamID, week) {
+				continue
+			}
+			tx, err := db.Begin()
+			if err != nil {
+				return
+			}
+			starters := lineupMovieIDs(tx, teamID, week)
+			if !r.enabled() {
+				tx.Exec("INSERT OR IGNORE INTO team_lineups (team_id, week, movie_id) SELECT team_id, ?, movie_id FROM roster WHERE team_id = ?", week, teamID)
+			} else if len(starters) == 0 {
+				for _, movieID := range defaultLineup(tx, teamID, week, r.Size) {
+					tx.Exec("INSERT OR IGNORE INTO team_lineups (team_id, week, movie_id) VALUES (?, ?, ?)", teamID, week, movieID)
+				}
+			} else {
+				// Starters dropped before the lock don't start.
+				tx.Exec("DELETE FROM team_lineups WHERE team_id = ? AND week = ? AND movie_id NOT IN (SELECT movie_id FROM roster WHERE team_id = ?)", teamID, week, teamID)
+			}
+			tx.Exec("INSERT OR IGNORE INTO team_week_scores (team_id, week, points) VALUES (?, ?, 0)", teamID, week)
+			tx.Commit()
+		}
+	}
+}
+
+func leagueTeamIDs(leagueID int) []int {
+	rows, err := db.Query("SELECT id FROM teams WHERE league_id = ? ORDER BY id", leagueID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// lockAllLineups locks due lineups in every weekly league.
+func lockAllLineups() {
+	rows, err := db.Query("SELECT id FROM leagues WHERE (scoring_mode = 'lineup' OR league_format = 'h2h' OR playoff_teams >= 2) AND status = 'active'")
+	if err != nil {
+		return
+	}
+	var leagues []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		leagues = append(leagues, id)
+	}
+	rows.Close()
+	for _, id := range leagues {
+		lockLineups(id)
+	}
+}
+
+func scheduledLineupLocks() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+	for {
+		<-ticker.C
+		lockAllLineups()
+		advanceAllPlayoffs()
+	}
+}
+
+// recordDailyStats snapshots a movie's grosses and points for today.
+func recordDailyStats(ex execer, m movieData, points float64) {
+	ex.Exec(`INSERT INTO movie_daily_stats (movie_id, stat_date, domestic_gross, worldwide_gross, points) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(movie_id, stat_date) DO UPDATE SET domestic_gross = excluded.domestic_gross,
+			worldwide_gross = excluded.worldwide_gross, points = excluded.points`,
+		m.ID, today(), m.DomesticGross, m.WorldwideGross, points)
+}
+
+// movieWeekPoints is how many points a movie gained between the UTC days
+// from (inclusive) and to (exclusive). A movie with no snapshot before the
+// week counts from its first snapshot, or from zero if it hadn't released.
+func movieWeekPoints(q queryer, movieID int, from, to string) float64 {
+	var end, start sql.NullFloat64
+	q.QueryRow("SELECT points FROM movie_daily_stats WHERE movie_id = ? AND stat_date < ? ORDER BY stat_date DESC LIMIT 1", movieID, to).Scan(&end)
+	if !end.Valid {
+		return 0
+	}
+	err := q.QueryRow("SELECT points FROM movie_daily_stats WHERE movie_id = ? AND stat_date < ? ORDER BY stat_date DESC LIMIT 1", movieID, from).Scan(&start)
+	if err == sql.ErrNoRows {
+		var released int
+		q.QueryRow("SELECT COUNT(*) FROM movies WHERE id = ? AND release_date < ?", movieID, from).Scan(&released)
+		if released > 0 {
+			q.QueryRow("SELECT points FROM movie_daily_stats WHERE movie_id = ? ORDER BY stat_date LIMIT 1", movieID).Scan(&start)
+		}
+	}
+	return end.Float64 - start.Float64
+}
+
+// updateLineupScores recomputes each locked week's score in weekly leagues
+// and sets lineup league teams' total_points to the sum of their weeks.
+func updateLineupScores(tx *sql.Tx) {
+	rows, err := tx.Query(`SELECT s.id, s.team_id, s.week, t.league_id FROM team_week_scores s
+		JOIN teams t ON t.id = s.team_id JOIN leagues l ON l.id = t.league_id
+		WHERE l.scoring_mode = 'lineup' OR l.league_format = 'h2h' OR l.playoff_teams >= 2`)
+	if err != nil {
+		return
+	}
+	type weekScore struct{ id, teamID, week, leagueID int }
+	var scores []weekScore
+	for rows.Next() {
+		var s weekScore
+		rows.Scan(&s.id, &s.teamID, &s.week, &s.leagueID)
+		scores = append(scores, s)
+	}
+	rows.Close()
+
+	rules := make(map[int]lineupRules)
+	for _, s := range scores {
+		r, ok := rules[s.leagueID]
+		if !ok {
+			r, _ = loadLineupRules(tx, s.leagueID)
+			rules[s.leagueID] = r
+		}
+		from := r.weekStart(s.week).UTC().Format("2006-01-02")
+		to := r.weekStart(s.week + 1).UTC().Format("2006-01-02")
+		total := 0.0
+		for _, movieID := range lineupMovieIDs(tx, s.teamID, s.week) {
+			total += movieWeekPoints(tx, movieID, from, to)
+		}
+		tx.Exec("UPDATE team_week_scores SET points = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", total, s.id)
+	}
+
+	tx.Exec(`UPDATE teams SET total_points = COALESCE((SELECT SUM(points) FROM team_week_scores WHERE team_id = teams.id), 0)
+		WHERE league_id IN (SELECT id FROM leagues WHERE scoring_mode = 'lineup')`)
+}
+
+// lineupJSON describes a team's lineup for a week, splitting its roster
+// into starters and bench.
+func lineupJSON(r lineupRules, teamID, week int) fiber.Map {
+	locked := weekLocked(db, teamID, week)
+	starters := lineupMovieIDs(db, teamID, week)
+	carriedOver := false
+	if !locked && len(starters) == 0 {
+		starters = defaultLineup(db, teamID, week, r.Size)
+		carriedOver = true
+	}
+	active := make(map[int]bool)
+	for _, id := range starters {
+		active[id] = true
+	}
+
+	from := r.weekStart(week).UTC().Format("2006-01-02")
+	to := r.weekStart(week + 1).UTC().Format("2006-01-02")
+	movie := func(id int) fiber.Map {
+		var title, releaseDate, poster, status string
+		var points, projected float64
+		db.QueryRow("SELECT title, COALESCE(release_date, ''), poster_url, status, points, projected_points FROM movies WHERE id = ?", id).
+			Scan(&title, &releaseDate, &poster, &status, &points, &projected)
+		return fiber.Map{
+			"movie_id": id, "title": title, "release_date": releaseDate, "poster_url": poster,
+			"status": status, "points": points, "projected_points": projected,
+			"week_points": movieWeekPoints(db, id, from, to),
+		}
+	}
+
+	starting, bench := []fiber.Map{}, []fiber.Map{}
+	for _, id := range starters {
+		starting = append(starting, movie(id))
+	}
+	for _, id := range rosterMovieIDs(db, teamID) {
+		if !active[id] {
+			bench = append(bench, movie(id))
+		}
+	}
+
+	out := r.weekJSON(week)
+	out["team_id"] = teamID
+	out["team_name"] = teamName(teamID)
+	out["league_id"] = r.LeagueID
+	out["lineup_size"] = r.Size
+	out["locked"] = locked
+	out["carried_over"] = carriedOver
+	out["active"] = starting
+	out["bench"] = bench
+	out["points"] = nil
+	if locked {
+		var points float64
+		db.QueryRow("SELECT points FROM team_week_scores WHERE team_id = ? AND week = ?", teamID, week).Scan(&points)
+		out["points"] = points
+	}
+	return out
+}
+
+// lineupWeek reads the ?week= query, defaulting to fallback, and checks it
+// falls inside the season.
+func lineupWeek(c *fiber.Ctx, r lineupRules, fallback int) (int, error) {
+	week := fallback
+	if v := c.Query("week"); v != "" {
+		week, _ = strconv.Atoi(v)
+	}
+	if week < 1 || (r.lastWeek() > 0 && week > r.lastWeek()) {
+		return 0, newAPIError(400, errInvalidWeek, "Week is outside the season").with("week", week).with("last_week", r.lastWeek())
+	}
+	return week, nil
+}
+
+func loadTeamLineupRules(teamID int) (lineupRules, int, error) {
+	var leagueID, ownerID int
+	if err := db.QueryRow("SELECT league_id, user_id FROM teams WHERE id = ?", teamID).Scan(&leagueID, &ownerID); err != nil {
+		return lineupRules{}, 0, newAPIError(404, errTeamNotFound, "Team not found")
+	}
+	r, err := loadLineupRules(db, leagueID)
+	if err != nil {
+		return r, 0, err
+	}
+	if !r.enabled() {
+		return r, 0, newAPIError(400, errLineupDisabled, "This league doesn't use lineups")
+	}
+	lockLineups(leagueID)
+	return r, ownerID, nil
+}
+
+// getTeamLineup returns a team's lineup for ?week=, defaulting to the next
+// week that can still be changed. Other teams' lineups are hidden until
+// they lock.
+func getTeamLineup(c *fiber.Ctx) error {
+	teamID, _ := strconv.Atoi(c.Params("id"))
+	r, ownerID, err := loadTeamLineupRules(teamID)
+	if err != nil {
+		return err
+	}
+	week, err := lineupWeek(c, r, r.currentWeek()+1)
+	if err != nil {
+		return err
+	}
+	if ownerID != getUserID(c) && !weekLocked(db, teamID, week) {
+		return newAPIError(403, errLineupForbidden, "Other teams' lineups are hidden until they lock").with("week", week)
+	}
+	return c.JSON(lineupJSON(r, teamID, week))
+}
+
+// setTeamLineup replaces a team's starters for a week that hasn't locked.
+func setTeamLineup(c *fiber.Ctx) error {
+	teamID, _ := strconv.Atoi(c.Params("id"))
+	var body struct {
+		Week     int   `json:"week"`
+		MovieIDs []int `json:"movie_ids"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return newAPIError(400, "INVALID_REQUEST", "Invalid request")
+	}
+	r, ownerID, err := loadTeamLineupRules(teamID)
+	if err != nil {
+		return err
+	}
+	if ownerID != getUserID(c) {
+		return newAPIError(403, errLineupForbidden, "You can only set your own team's lineup")
+	}
+	if body.Week == 0 {
+		body.Week = r.currentWeek() + 1
+	}
+	if body.Week <= r.currentWeek() || weekLocked(db, teamID, body.Week) {
+		return newAPIError(400, errLineupLocked, "This week's lineup is locked").
+			with("week", body.Week).with("locked_at", r.weekStart(body.Week).UTC().Format(time.RFC3339))
+	}
+	if last := r.lastWeek(); last > 0 && body.Week > last {
+		return newAPIError(400, errInvalidWeek, "Week is outside the season").with("week", body.Week).with("last_week", last)
+	}
+	if len(body.MovieIDs) > r.Size {
+		return newAPIError(400, errLineupTooLarge, "Too many starters").with("lineup_size", r.Size)
+	}
+
+	owned := make(map[int]bool)
+	for _, id := range rosterMovieIDs(db, teamID) {
+		owned[id] = true
+	}
+	seen := make(map[int]bool)
+	for _, id := range body.MovieIDs {
+		if !owned[id] {
+			return newAPIError(400, errMovieNotOwned, "Movie is not on this roster").with("movie_id", id)
+		}
+		if seen[id] {
+			return newAPIError(400, "INVALID_REQUEST", "A movie can only start once").with("movie_id", id)
+		}
+		seen[id] = true
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	tx.Exec("DELETE FROM team_lineups WHERE team_id = ? AND week = ?", teamID, body.Week)
+	for _, id := range body.MovieIDs {
+		tx.Exec("INSERT INTO team_lineups (team_id, week, movie_id) VALUES (?, ?, ?)", teamID, body.Week, id)
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	return c.JSON(lineupJSON(r, teamID, body.Week))
+}
+
+// getLeagueLineups lists every team's lineup and score for ?week=,
+// defaulting to the week in progress. Lineups that haven't locked are only
+// shown to their owner.
+func getLeagueLineups(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	r, err := loadLineupRules(db, leagueID)
+	if err != nil {
+		return err
+	}
+	if !r.enabled() {
+		return newAPIError(400, errLineupDisabled, "This league doesn't use lineups")
+	}
+	lockLineups(leagueID)
+	current := r.currentWeek()
+	if current == 0 {
+		current = 1
+	}
+	week, err := lineupWeek(c, r, current)
+	if err != nil {
+		return err
+	}
+
+	userID := getUserID(c)
+	teams := []fiber.Map{}
+	for _, teamID := range leagueTeamIDs(leagueID) {
+		var ownerID int
+		db.QueryRow("SELECT user_id FROM teams WHERE id = ?", teamID).Scan(&ownerID)
+		if ownerID != userID && !weekLocked(db, teamID, week) {
+			teams = append(teams, fiber.Map{"team_id": teamID, "team_name": teamName(teamID), "locked": false, "hidden": true})
+			continue
+		}
+		teams = append(teams, lineupJSON(r, teamID, week))
+	}
+
+	out := r.weekJSON(week)
+	out["league_id"] = leagueID
+	out["current_week"] = r.currentWeek()
+	out["last_week"] = r.lastWeek()
+	out["teams"] = teams
+	return c.JSON(out)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// --- Mail ---
+//
+// Outgoing mail goes through outbox. With SMTP_ADDR set it is sent over
+// SMTP (SMTP_USERNAME/SMTP_PASSWORD for auth, MAIL_FROM as the sender);
+// otherwise it is only logged. Setting MAIL_SINK (e.g. 127.0.0.1:2525)
+// starts a local SMTP stand-in that accepts everything and writes each
+// message to MAIL_SINK_DIR (default "mail") as a .eml file, and points the
+// outbox at it. Use it in development and tests instead of a real server.
+
+type mailMessage struct {
+	To, Subject, Body string
+}
+
+type mailer interface {
+	Send(m mailMessage) error
+}
+
+var outbox mailer = logMailer{}
+
+// appURL is where links in emails point.
+var appURL = "http://localhost:5173"
+
+type logMailer struct{}
+
+func (logMailer) Send(m mailMessage) error {
+	log.Printf("Mail to %s (not sent, SMTP_ADDR unset): %s", m.To, m.Subject)
+	return nil
+}
+
+type smtpMailer struct {
+	addr, from string
+	auth       smtp.Auth
+}
+
+func (s smtpMailer) Send(m mailMessage) error {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", m.To)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", m.Subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{m.To}, []byte(msg.String()))
+}
+
+func initMail() {
+	if v := os.Getenv("APP_URL"); v != "" {
+		appURL = strings.TrimRight(v, "/")
+	}
+	addr := os.Getenv("SMTP_ADDR")
+	if sink := os.Getenv("MAIL_SINK"); sink != "" {
+		dir := os.Getenv("MAIL_SINK_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		if err := startMailSink(sink, dir); err != nil {
+			log.Printf("Mail sink failed to start: %v", err)
+			return
+		}
+		log.Printf("Mail sink listening on %s, writing to %s", sink, dir)
+		addr = sink
+	}
+	if addr == "" {
+		return
+	}
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "noreply@fantasyboxoffice.local"
+	}
+	var auth smtp.Auth
+	if user := os.Getenv("SMTP_USERNAME"); user != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	outbox = smtpMailer{addr: addr, from: from, auth: auth}
+}
+
+// --- Mail Sink ---
+
+var sinkSeq int64
+
+// startMailSink runs a minimal SMTP server that saves what it receives.
+func startMailSink(addr, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveMailSink(conn, dir)
+		}
+	}()
+	return nil
+}
+
+func serveMailSink(conn net.Conn, dir string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(s string) { fmt.Fprintf(conn, "%s\r\n", s) }
+	var from string
+	var to []string
+
+	reply("220 fantasy-box-office mail sink")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 mail sink")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			from, to = strings.TrimSpace(line[len("MAIL FROM:"):]), nil
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			to = append(to, strings.TrimSpace(line[len("RCPT TO:"):]))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			fmt.Fprintf(&data, "X-Envelope-From: %s\r\nX-Envelope-To: %s\r\n", from, strings.Join(to, ", "))
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" || l == ".\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			name := fmt.Sprintf("%s-%d.eml", time.Now().UTC().Format("20060102T150405"), atomic.AddInt64(&sinkSeq, 1))
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(data.String()), 0644); err != nil {
+				reply("451 " + err.Error())
+				continue
+			}
+			from, to = "", nil
+			reply("250 OK")
+		case cmd == "RSET":
+			from, to = "", nil
+			reply("250 OK")
+		case cmd == "NOOP":
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -39,13 +40,40 @@ func main() {
 	}
 
 	initTMDB()
+	initMail()
 	runMigrations()
 	seedMovies()
+	updateProjections()
 	go fixSeedPosters()
 	go scheduledSync()
+	go scheduledTradeJobs()
+	go scheduledWaiverRuns()
+	go scheduledLineupLocks()
+	go scheduledLifecycle()
+	go oddsWorker()
+	go scheduledRecaps()
+
+	app := newApp()
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8090"
+	}
+	log.Printf("Fantasy Box Office API running on :%s", port)
+	log.Fatal(app.Listen(":" + port))
+}
 
+// newApp builds the HTTP server with every route registered.
+func newApp() *fiber.App {
 	app := fiber.New(fiber.Config{ErrorHandler: func(c *fiber.Ctx, err error) error {
 		code := fiber.StatusInternalServerError
+		if e, ok := err.(*apiError); ok {
+			resp := fiber.Map{"error": e.Message, "code": e.Code}
+			if len(e.Details) > 0 {
+				resp["details"] = e.Details
+			}
+			return c.Status(e.Status).JSON(resp)
+		}
 		if e, ok := err.(*fiber.Error); ok {
 			code = e.Code
 		}
@@ -61,6 +89,11 @@ func main() {
 	api.Post("/auth/register", register)
 	api.Post("/auth/login", login)
 
+	// Invite links work signed out, so they go ahead of the /leagues auth
+	// middleware.
+	app.Get("/api/leagues/join/:code", authMiddlewareOptional, previewInvite)
+	app.Post("/api/leagues/join/:code", authMiddlewareOptional, joinLeagueByInvite)
+
 	// Protected routes
 	api.Use("/leagues", authMiddleware)
 	api.Use("/teams", authMiddleware)
@@ -70,19 +103,56 @@ func main() {
 	// Leagues
 	api.Get("/leagues", getLeagues)
 	api.Post("/leagues", createLeague)
-	api.Get("/leagues/:id", getLeague)
+	api.Get("/leagues/directory", getLeagueDirectory)
+	api.Get("/leagues/join-requests", getMyJoinRequests)
+	api.Get("/leagues/:id", leagueViewer, getLeague)
+	api.Patch("/leagues/:id", leagueMember, updateLeague)
+	api.Get("/leagues/:id/settings/changes", leagueViewer, getLeagueSettingChanges)
+	api.Get("/leagues/:id/audit", leagueViewer, getLeagueAuditLog)
+	api.Get("/leagues/:id/commissioners", leagueViewer, getCommissioners)
+	api.Post("/leagues/:id/commissioners", leagueMember, addCommissioner)
+	api.Delete("/leagues/:id/commissioners/:userId", leagueMember, removeCommissioner)
+	api.Post("/leagues/:id/owner", leagueMember, transferLeague)
+	api.Post("/leagues/:id/transactions/:txId/reverse", leagueMember, reverseTransaction)
 	api.Post("/leagues/:id/join", joinLeague)
-	api.Get("/leagues/:id/standings", getStandings)
-	api.Get("/leagues/:id/transactions", getTransactions)
-	api.Get("/leagues/:id/movies", getLeagueMovies)
-	api.Post("/leagues/:id/draft/start", startDraft)
-	api.Post("/leagues/:id/draft/pick", makeDraftPick)
-	api.Get("/leagues/:id/draft/status", getDraftStatus)
-	api.Get("/leagues/:id/waivers", getLeagueWaivers)
+	api.Delete("/leagues/:id/join", withdrawJoinRequest)
+	api.Get("/leagues/:id/join-requests", leagueMember, getJoinRequests)
+	api.Post("/leagues/:id/join-requests/:requestId/approve", leagueMember, approveJoinRequest)
+	api.Post("/leagues/:id/join-requests/:requestId/deny", leagueMember, denyJoinRequest)
+	api.Get("/leagues/:id/standings", leagueViewer, getStandings)
+	api.Get("/leagues/:id/odds", leagueViewer, getLeagueOdds)
+	api.Get("/leagues/:id/power-rankings", leagueViewer, getPowerRankings)
+	api.Get("/leagues/:id/articles", leagueViewer, getLeagueArticles)
+	api.Get("/leagues/:id/articles/:articleId", leagueViewer, getLeagueArticle)
+	api.Post("/leagues/:id/articles/recap", leagueMember, publishRecapNow)
+	api.Get("/leagues/:id/divisions", leagueViewer, getDivisions)
+	api.Post("/leagues/:id/divisions", leagueMember, createDivision)
+	api.Patch("/leagues/:id/divisions/:divisionId", leagueMember, updateDivision)
+	api.Delete("/leagues/:id/divisions/:divisionId", leagueMember, deleteDivision)
+	api.Get("/leagues/:id/transactions", leagueViewer, getTransactions)
+	api.Get("/leagues/:id/movies", leagueViewer, getLeagueMovies)
+	api.Post("/leagues/:id/draft/start", leagueMember, startDraft)
+	api.Post("/leagues/:id/draft/pick", leagueMember, makeDraftPick)
+	api.Get("/leagues/:id/draft/status", leagueViewer, getDraftStatus)
+	api.Get("/leagues/:id/waivers", leagueViewer, getLeagueWaivers)
+	api.Get("/leagues/:id/waivers/priority", leagueViewer, getWaiverPriority)
+	api.Get("/leagues/:id/free-agents", leagueViewer, getFreeAgents)
+	api.Get("/leagues/:id/calendar", leagueViewer, getLeagueCalendar)
+	api.Get("/leagues/:id/lineups", leagueViewer, getLeagueLineups)
+	api.Get("/leagues/:id/matchups", leagueViewer, getMatchups)
+	api.Get("/leagues/:id/playoffs", leagueViewer, getPlayoffs)
+	api.Get("/leagues/:id/results", leagueViewer, getLeagueResults)
 
 	// Teams
-	api.Get("/teams/:id", getTeam)
-	api.Get("/teams/:id/roster", getTeamRoster)
+	api.Get("/teams/:id", teamViewer, getTeam)
+	api.Get("/teams/:id/roster", teamViewer, getTeamRoster)
+	api.Post("/teams/:id/roster", teamViewer, commissionerAddMovie)
+	api.Delete("/teams/:id/roster/:movieId", teamViewer, dropMovie)
+	api.Delete("/teams/:id/owner", teamViewer, removeTeamOwner)
+	api.Put("/teams/:id/owner", teamViewer, assignTeamOwner)
+	api.Put("/teams/:id/division", teamViewer, assignDivision)
+	api.Get("/teams/:id/lineup", teamViewer, getTeamLineup)
+	api.Put("/teams/:id/lineup", teamViewer, setTeamLineup)
 
 	// Movies (public)
 	app.Get("/api/movies", getMovies)
@@ -97,20 +167,34 @@ func main() {
 	api.Post("/trades", createTrade)
 	api.Put("/trades/:id/accept", acceptTrade)
 	api.Put("/trades/:id/reject", rejectTrade)
+	api.Put("/trades/:id/cancel", cancelTrade)
+	api.Put("/trades/:id/approve", approveTrade)
+	api.Put("/trades/:id/veto", commissionerVetoTrade)
+	api.Post("/trades/:id/force", forceTrade)
+	api.Post("/trades/:id/vote", voteOnTrade)
+	api.Post("/trades/:id/counter", counterTrade)
+	api.Get("/trades/:id", getTrade)
+	api.Get("/trades/:id/messages", getTradeMessages)
+	api.Post("/trades/:id/messages", sendTradeMessage)
+	api.Get("/leagues/:id/trades", leagueMember, getLeagueTrades)
 
 	// Waivers
 	api.Post("/waivers/claim", claimWaiver)
+	api.Delete("/waivers/:id", cancelWaiverClaim)
+	api.Post("/leagues/:id/waivers/process", leagueMember, processWaiversHandler)
 
 	// Scoring
 	app.Post("/api/scoring/recalculate", recalculateHandler)
 
 	// League invite
-	api.Get("/leagues/:id/invite", getLeagueInvite)
-	app.Post("/api/leagues/join/:code", authMiddlewareOptional, joinLeagueByInvite)
+	api.Get("/leagues/:id/invite", leagueMember, getLeagueInvite)
+	api.Get("/leagues/:id/invites", leagueMember, getLeagueInvites)
+	api.Post("/leagues/:id/invites", leagueMember, createLeagueInvites)
+	api.Delete("/leagues/:id/invites/:inviteId", leagueMember, revokeLeagueInvite)
 
 	// Chat
-	api.Get("/leagues/:id/chat", getChatMessages)
-	api.Post("/leagues/:id/chat", sendChatMessage)
+	api.Get("/leagues/:id/chat", leagueMember, getChatMessages)
+	api.Post("/leagues/:id/chat", leagueMember, sendChatMessage)
 
 	// Notifications
 	api.Use("/notifications", authMiddleware)
@@ -119,70 +203,18 @@ func main() {
 
 	// Projections
 	app.Get("/api/movies/:id/projection", getMovieProjection)
+	app.Get("/api/projections/model", getProjectionModel)
 
 	// Trade analyzer
 	api.Post("/trades/analyze", analyzeTrade)
 
 	// Season history
-	app.Get("/api/seasons/history", func(c *fiber.Ctx) error {
-		// For now return current season standings as "history"
-		// In future, completed seasons would be stored separately
-		type Winner struct {
-			Year     int     `json:"year"`
-			Team     string  `json:"team_name"`
-			Owner    string  `json:"owner"`
-			Points   float64 `json:"points"`
-			LeagueID int     `json:"league_id"`
-		}
-		type Record struct {
-			Title string  `json:"title"`
-			Value string  `json:"value"`
-			Year  int     `json:"year"`
-			Team  string  `json:"team"`
-		}
-		// Get top scoring team from completed leagues
-		var winners []Winner
-		rows, err := db.Query(`SELECT l.season_year, t.name, u.display_name, t.total_points, l.id 
-			FROM teams t JOIN leagues l ON t.league_id = l.id JOIN users u ON t.user_id = u.id
-			WHERE l.status = 'completed' ORDER BY l.season_year DESC, t.total_points DESC`)
-		if err == nil {
-			defer rows.Close()
-			seen := map[int]bool{}
-			for rows.Next() {
-				var w Winner
-				rows.Scan(&w.Year, &w.Team, &w.Owner, &w.Points, &w.LeagueID)
-				if !seen[w.Year] {
-					winners = append(winners, w)
-					seen[w.Year] = true
-				}
-			}
-		}
-		// Get some records from current data
-		var records []Record
-		var topMovie struct{ title string; points float64 }
-		db.QueryRow("SELECT title, points FROM movies ORDER BY points DESC LIMIT 1").Scan(&topMovie.title, &topMovie.points)
-		if topMovie.title != "" {
-			records = append(records, Record{Title: "Highest Scoring Movie", Value: fmt.Sprintf("%s (%.1f pts)", topMovie.title, topMovie.points), Year: 2025})
-		}
-		var topBudget struct{ title string; budget float64 }
-		db.QueryRow("SELECT title, budget FROM movies ORDER BY budget DESC LIMIT 1").Scan(&topBudget.title, &topBudget.budget)
-		if topBudget.title != "" {
-			records = append(records, Record{Title: "Biggest Budget", Value: fmt.Sprintf("%s ($%.0fM)", topBudget.title, topBudget.budget/1e6), Year: 2025})
-		}
-		if winners == nil { winners = []Winner{} }
-		if records == nil { records = []Record{} }
-		return c.JSON(fiber.Map{"winners": winners, "records": records})
-	})
+	app.Get("/api/seasons/history", authMiddlewareOptional, getSeasonHistory)
 
 	// WebSocket routes
 	setupWebSocketRoutes(app)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8090"
-	}
-	log.Printf("Fantasy Box Office API running on :%s", port)
-	log.Fatal(app.Listen(":" + port))
+	return app
 }
 
 // --- Auth ---
@@ -292,6 +324,30 @@ func getUserID(c *fiber.Ctx) int {
 	return c.Locals("user_id").(int)
 }
 
+// apiError is an error response that carries a machine-readable code
+// alongside the human-readable message.
+type apiError struct {
+	Status  int
+	Code    string
+	Message string
+	Details fiber.Map
+}
+
+func newAPIError(status int, code, message string) *apiError {
+	return &apiError{Status: status, Code: code, Message: message}
+}
+
+func (e *apiError) Error() string { return e.Message }
+
+// with attaches a detail field to the error response.
+func (e *apiError) with(key string, value interface{}) *apiError {
+	if e.Details == nil {
+		e.Details = fiber.Map{}
+	}
+	e.Details[key] = value
+	return e
+}
+
 // --- Leagues ---
 
 func getLeagues(c *fiber.Ctx) error {
@@ -339,6 +395,8 @@ func createLeague(c *fiber.Ctx) error {
 		SeasonStart string `json:"season_start"`
 		SeasonEnd   string `json:"season_end"`
 		DraftRounds int    `json:"draft_rounds"`
+		// PreviousLeagueID makes this league the next season of a completed one.
+		PreviousLeagueID int `json:"previous_league_id"`
 	}
 	if err := c.BodyParser(&body); err != nil {
 		return fiber.NewError(400, "Invalid request")
@@ -346,6 +404,13 @@ func createLeague(c *fiber.Ctx) error {
 	if body.Name == "" {
 		return fiber.NewError(400, "League name required")
 	}
+	var previousLeague interface{}
+	if body.PreviousLeagueID != 0 {
+		if err := validatePreviousLeague(userID, body.PreviousLeagueID); err != nil {
+			return err
+		}
+		previousLeague = body.PreviousLeagueID
+	}
 	if body.SeasonYear == 0 {
 		body.SeasonYear = time.Now().Year()
 	}
@@ -365,22 +430,41 @@ func createLeague(c *fiber.Ctx) error {
 	if body.DraftRounds == 0 {
 		body.DraftRounds = 15
 	}
+	settings, err := parseLeagueSettings(c.Body())
+	if err != nil {
+		return err
+	}
+	if err := validateRosterSettings(body.DraftRounds, settings); err != nil {
+		return err
+	}
+	if err := validatePlayoffSettings(body.MaxTeams, settings); err != nil {
+		return err
+	}
 
 	inviteCode := uuid.New().String()
 	tx, _ := db.Begin()
-	res, err := tx.Exec("INSERT INTO leagues (name, owner_id, season_year, draft_date, max_teams, invite_code, season_start, season_end, draft_rounds) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
-		body.Name, userID, body.SeasonYear, body.DraftDate, body.MaxTeams, inviteCode, body.SeasonStart, body.SeasonEnd, body.DraftRounds)
+	res, err := tx.Exec("INSERT INTO leagues (name, owner_id, season_year, draft_date, max_teams, invite_code, season_start, season_end, draft_rounds, previous_league_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		body.Name, userID, body.SeasonYear, body.DraftDate, body.MaxTeams, inviteCode, body.SeasonStart, body.SeasonEnd, body.DraftRounds, previousLeague)
 	if err != nil {
 		tx.Rollback()
 		return fiber.NewError(500, err.Error())
 	}
 	leagueID, _ := res.LastInsertId()
+	if err := applyLeagueSettings(tx, int(leagueID), settings); err != nil {
+		tx.Rollback()
+		return fiber.NewError(500, err.Error())
+	}
 
 	_, err = tx.Exec("INSERT INTO teams (league_id, user_id, name) VALUES (?, ?, ?)", leagueID, userID, body.TeamName)
 	if err != nil {
 		tx.Rollback()
 		return fiber.NewError(500, err.Error())
 	}
+	_, err = tx.Exec("INSERT INTO league_invites (league_id, code, created_by) VALUES (?, ?, ?)", leagueID, inviteCode, userID)
+	if err != nil {
+		tx.Rollback()
+		return fiber.NewError(500, err.Error())
+	}
 	tx.Commit()
 
 	return c.Status(201).JSON(fiber.Map{"id": leagueID, "name": body.Name, "status": "pending", "invite_code": inviteCode})
@@ -393,42 +477,67 @@ func getLeague(c *fiber.Ctx) error {
 		Name, Status                                   string
 		DraftDate                                      sql.NullString
 		SeasonStart, SeasonEnd                         string
+		PreviousLeagueID                               sql.NullInt64
 	}
-	err := db.QueryRow("SELECT id, name, owner_id, season_year, draft_date, max_teams, status, season_start, season_end, draft_rounds FROM leagues WHERE id = ?", id).
-		Scan(&l.ID, &l.Name, &l.OwnerID, &l.SeasonYear, &l.DraftDate, &l.MaxTeams, &l.Status, &l.SeasonStart, &l.SeasonEnd, &l.DraftRounds)
+	err := db.QueryRow("SELECT id, name, owner_id, season_year, draft_date, max_teams, status, season_start, season_end, draft_rounds, previous_league_id FROM leagues WHERE id = ?", id).
+		Scan(&l.ID, &l.Name, &l.OwnerID, &l.SeasonYear, &l.DraftDate, &l.MaxTeams, &l.Status, &l.SeasonStart, &l.SeasonEnd, &l.DraftRounds, &l.PreviousLeagueID)
 	if err != nil {
 		return fiber.NewError(404, "League not found")
 	}
 
 	// Get teams
-	rows, _ := db.Query("SELECT t.id, t.name, t.total_points, u.display_name FROM teams t JOIN users u ON u.id = t.user_id WHERE t.league_id = ?", id)
+	rows, _ := db.Query(`SELECT t.id, t.name, t.total_points, u.display_name, MAX(l.faab_budget - t.faab_spent, 0), u.is_system, t.division_id
+		FROM teams t JOIN users u ON u.id = t.user_id JOIN leagues l ON l.id = t.league_id WHERE t.league_id = ?`, id)
 	defer rows.Close()
 	var teams []fiber.Map
 	for rows.Next() {
-		var tid int
+		var tid, faab int
 		var tname string
 		var pts float64
 		var uname string
-		rows.Scan(&tid, &tname, &pts, &uname)
-		teams = append(teams, fiber.Map{"id": tid, "name": tname, "total_points": pts, "owner": uname})
+		var orphaned bool
+		var division sql.NullInt64
+		rows.Scan(&tid, &tname, &pts, &uname, &faab, &orphaned, &division)
+		team := fiber.Map{"id": tid, "name": tname, "total_points": pts, "owner": uname, "faab_remaining": faab, "orphaned": orphaned, "division_id": nil}
+		if division.Valid {
+			team["division_id"] = division.Int64
+		}
+		teams = append(teams, team)
 	}
 
 	dd := ""
 	if l.DraftDate.Valid {
 		dd = l.DraftDate.String
 	}
+	var previous interface{}
+	if l.PreviousLeagueID.Valid {
+		previous = l.PreviousLeagueID.Int64
+	}
 	return c.JSON(fiber.Map{
 		"id": l.ID, "name": l.Name, "owner_id": l.OwnerID, "season_year": l.SeasonYear,
 		"draft_date": dd, "max_teams": l.MaxTeams, "status": l.Status, "teams": teams,
 		"season_start": l.SeasonStart, "season_end": l.SeasonEnd, "draft_rounds": l.DraftRounds,
+		"previous_league_id": previous, "settings": getLeagueSettings(l.ID),
 	})
 }
 
+// isCommissioner reports whether the user owns the league or is one of its
+// co-commissioners (see commissioner.go).
+func isCommissioner(leagueID, userID int) bool {
+	if isLeagueOwner(leagueID, userID) {
+		return true
+	}
+	var n int
+	db.QueryRow("SELECT COUNT(*) FROM league_commissioners WHERE league_id = ? AND user_id = ?", leagueID, userID).Scan(&n)
+	return n > 0
+}
+
 func joinLeague(c *fiber.Ctx) error {
 	userID := getUserID(c)
 	leagueID, _ := strconv.Atoi(c.Params("id"))
 	var body struct {
 		TeamName string `json:"team_name"`
+		Message  string `json:"message"`
 	}
 	c.BodyParser(&body)
 	if body.TeamName == "" {
@@ -439,7 +548,15 @@ func joinLeague(c *fiber.Ctx) error {
 	var maxTeams int
 	var status string
 	var count int
-	db.QueryRow("SELECT max_teams, status FROM leagues WHERE id = ?", leagueID).Scan(&maxTeams, &status)
+	var visibility string
+	var approval bool
+	if err := db.QueryRow("SELECT max_teams, status, visibility, join_approval FROM leagues WHERE id = ?", leagueID).Scan(&maxTeams, &status, &visibility, &approval); err != nil {
+		return newAPIError(404, errLeagueNotFound, "League not found")
+	}
+	// Private leagues are joined through their invite link.
+	if visibility != "public" {
+		return newAPIError(403, errLeaguePrivate, "This league is private; join it with an invite link")
+	}
 	if status != "pending" {
 		return fiber.NewError(400, "League is not accepting new teams")
 	}
@@ -447,6 +564,9 @@ func joinLeague(c *fiber.Ctx) error {
 	if count >= maxTeams {
 		return fiber.NewError(400, "League is full")
 	}
+	if approval {
+		return requestToJoin(c, leagueID, userID, body.TeamName, body.Message)
+	}
 
 	_, err := db.Exec("INSERT INTO teams (league_id, user_id, name) VALUES (?, ?, ?)", leagueID, userID, body.TeamName)
 	if err != nil {
@@ -516,27 +636,37 @@ func startDraft(c *fiber.Ctx) error {
 	userID := getUserID(c)
 	leagueID, _ := strconv.Atoi(c.Params("id"))
 
-	var ownerID int
 	var status string
-	db.QueryRow("SELECT owner_id, status FROM leagues WHERE id = ?", leagueID).Scan(&ownerID, &status)
-	if ownerID != userID {
-		return fiber.NewError(403, "Only the league owner can start the draft")
+	db.QueryRow("SELECT status FROM leagues WHERE id = ?", leagueID).Scan(&status)
+	if !isCommissioner(leagueID, userID) {
+		return fiber.NewError(403, "Only a commissioner can start the draft")
 	}
 	if status != "pending" {
 		return fiber.NewError(400, "Draft already started or league completed")
 	}
 
+	totalPicks, err := beginDraft(leagueID)
+	if err != nil {
+		return err
+	}
+	logLeagueAction(db, leagueID, userID, "draft_started", 0, "The draft was started")
+	return c.JSON(fiber.Map{"message": "Draft started", "total_picks": totalPicks})
+}
+
+// beginDraft sets a random snake draft order and moves the league to
+// drafting. It is used by startDraft and the lifecycle manager.
+func beginDraft(leagueID int) (int, error) {
 	// Get teams, create draft order
 	rows, _ := db.Query("SELECT id FROM teams WHERE league_id = ? ORDER BY RANDOM()", leagueID)
-	defer rows.Close()
 	var teamIDs []int
 	for rows.Next() {
 		var tid int
 		rows.Scan(&tid)
 		teamIDs = append(teamIDs, tid)
 	}
+	rows.Close()
 	if len(teamIDs) < 2 {
-		return fiber.NewError(400, "Need at least 2 teams to draft")
+		return 0, fiber.NewError(400, "Need at least 2 teams to draft")
 	}
 
 	// Create snake draft picks
@@ -565,7 +695,8 @@ func startDraft(c *fiber.Ctx) error {
 	tx.Exec("UPDATE leagues SET status = 'drafting' WHERE id = ?", leagueID)
 	tx.Commit()
 
-	return c.JSON(fiber.Map{"message": "Draft started", "total_picks": pickNum - 1})
+	notifyLeague(leagueID, "draft_started", "Draft Has Started", "The draft is open. Head to the draft room to make your picks.")
+	return pickNum - 1, nil
 }
 
 func makeDraftPick(c *fiber.Ctx) error {
@@ -613,6 +744,9 @@ func makeDraftPick(c *fiber.Ctx) error {
 	if exists > 0 {
 		return fiber.NewError(400, "Movie already drafted")
 	}
+	if err := checkRosterChange(db, teamID, []int{body.MovieID}, nil); err != nil {
+		return err
+	}
 
 	tx, _ := db.Begin()
 	tx.Exec("UPDATE draft_picks SET movie_id = ? WHERE id = ?", body.MovieID, pickID)
@@ -626,10 +760,20 @@ func makeDraftPick(c *fiber.Ctx) error {
 		tx.Exec("UPDATE leagues SET status = 'active' WHERE id = ?", leagueID)
 	}
 	tx.Commit()
+	if remaining == 0 {
+		finishDraft(leagueID)
+	}
 
 	return c.JSON(fiber.Map{"message": "Pick made", "remaining": remaining})
 }
 
+// finishDraft sets up the season once the last pick is in.
+func finishDraft(leagueID int) {
+	initWaiverPriority(leagueID)
+	generateSchedule(leagueID)
+	notifyLeague(leagueID, "season_started", "Draft Complete", "The draft is over and the season is underway.")
+}
+
 func getDraftStatus(c *fiber.Ctx) error {
 	leagueID, _ := strconv.Atoi(c.Params("id"))
 
@@ -696,15 +840,19 @@ func getTeamRoster(c *fiber.Ctx) error {
 	teamID, _ := strconv.Atoi(c.Params("id"))
 	rows, _ := db.Query(`SELECT r.id, r.movie_id, r.acquired_at, r.acquisition_type,
 		m.title, m.release_date, m.poster_url, m.budget, m.domestic_gross, m.worldwide_gross, m.rt_score, m.status
-		FROM roster r JOIN movies m ON m.id = r.movie_id WHERE r.team_id = ?`, teamID)
+		FROM roster r JOIN movies m ON m.id = r.movie_id WHERE r.team_id = ? ORDER BY r.acquired_at, r.id`, teamID)
 	defer rows.Close()
 
 	var roster []fiber.Map
+	var movieIDs []int
+	dates := make(map[int]string)
 	for rows.Next() {
 		var rid, mid int
 		var acqAt, acqType, title, relDate, poster, mstatus string
 		var budget, domGross, wwGross, rt float64
 		rows.Scan(&rid, &mid, &acqAt, &acqType, &title, &relDate, &poster, &budget, &domGross, &wwGross, &rt, &mstatus)
+		movieIDs = append(movieIDs, mid)
+		dates[mid] = relDate
 		roster = append(roster, fiber.Map{
 			"id": rid, "movie_id": mid, "acquired_at": acqAt, "acquisition_type": acqType,
 			"movie": fiber.Map{
@@ -717,6 +865,16 @@ func getTeamRoster(c *fiber.Ctx) error {
 	if roster == nil {
 		roster = []fiber.Map{}
 	}
+
+	// Show which typed slot each movie fills, if the league uses them.
+	var leagueID int
+	db.QueryRow("SELECT league_id FROM teams WHERE id = ?", teamID).Scan(&leagueID)
+	if rules := loadRosterRules(db, leagueID); rules.typed() {
+		slots, _ := rules.assignSlots(movieIDs, dates)
+		for i, mid := range movieIDs {
+			roster[i]["slot"] = slots[mid]
+		}
+	}
 	return c.JSON(roster)
 }
 
@@ -727,6 +885,12 @@ func atoi(s string) int {
 	return n
 }
 
+// sqlTime formats t the way SQLite's CURRENT_TIMESTAMP does, so stored
+// times compare correctly against datetime('now').
+func sqlTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
 func getMovies(c *fiber.Ctx) error {
 	status := c.Query("status")
 	search := c.Query("search")
@@ -821,6 +985,34 @@ func getStandings(c *fiber.Ctx) error {
 	if standings == nil {
 		standings = []fiber.Map{}
 	}
+
+	// Head-to-head leagues rank by record, with points for as the tiebreaker.
+	var format string
+	db.QueryRow("SELECT league_format FROM leagues WHERE id = ?", leagueID).Scan(&format)
+	if format == "h2h" {
+		records := leagueRecords(leagueID)
+		byTeam := make(map[int]fiber.Map)
+		for _, s := range standings {
+			byTeam[s["team_id"].(int)] = s
+		}
+		ranked := []fiber.Map{}
+		for i, rec := range rankByRecord(records) {
+			s := byTeam[rec.TeamID]
+			if s == nil {
+				continue
+			}
+			s["rank"] = i + 1
+			s["wins"], s["losses"], s["ties"] = rec.Wins, rec.Losses, rec.Ties
+			s["record"] = rec.String()
+			s["points_for"], s["points_against"] = rec.PointsFor, rec.PointsAg
+			ranked = append(ranked, s)
+		}
+		standings = ranked
+	}
+	addDivisionRanks(leagueID, standings)
+	if c.Query("group") == "division" {
+		return c.JSON(groupStandingsByDivision(leagueID, standings))
+	}
 	return c.JSON(standings)
 }
 
@@ -829,7 +1021,7 @@ func getStandings(c *fiber.Ctx) error {
 func getTransactions(c *fiber.Ctx) error {
 	leagueID, _ := strconv.Atoi(c.Params("id"))
 	rows, _ := db.Query(`SELECT tx.id, tx.team_id, tx.movie_id, tx.type, tx.created_at,
-		t.name as team_name, m.title as movie_title
+		t.name as team_name, m.title as movie_title, tx.trade_id
 		FROM transactions tx
 		JOIN teams t ON t.id = tx.team_id
 		JOIN movies m ON m.id = tx.movie_id
@@ -840,11 +1032,16 @@ func getTransactions(c *fiber.Ctx) error {
 	for rows.Next() {
 		var id, teamID, movieID int
 		var txType, createdAt, teamName, movieTitle string
-		rows.Scan(&id, &teamID, &movieID, &txType, &createdAt, &teamName, &movieTitle)
-		txns = append(txns, fiber.Map{
+		var tradeID sql.NullInt64
+		rows.Scan(&id, &teamID, &movieID, &txType, &createdAt, &teamName, &movieTitle, &tradeID)
+		txn := fiber.Map{
 			"id": id, "team_id": teamID, "movie_id": movieID, "type": txType,
 			"created_at": createdAt, "team_name": teamName, "movie_title": movieTitle,
-		})
+		}
+		if tradeID.Valid {
+			txn["trade_id"] = tradeID.Int64
+		}
+		txns = append(txns, txn)
 	}
 	if txns == nil {
 		txns = []fiber.Map{}
@@ -852,151 +1049,19 @@ func getTransactions(c *fiber.Ctx) error {
 	return c.JSON(txns)
 }
 
-// --- Trades ---
-
-func createTrade(c *fiber.Ctx) error {
-	userID := getUserID(c)
-	var body struct {
-		LeagueID       int   `json:"league_id"`
-		ReceiverTeamID int   `json:"receiver_team_id"`
-		OfferMovieIDs  []int `json:"offer_movie_ids"`
-		RequestMovieIDs []int `json:"request_movie_ids"`
-	}
-	if err := c.BodyParser(&body); err != nil {
-		return fiber.NewError(400, "Invalid request")
-	}
-
-	// Find proposer team
-	var proposerTeamID int
-	err := db.QueryRow("SELECT id FROM teams WHERE league_id = ? AND user_id = ?", body.LeagueID, userID).Scan(&proposerTeamID)
-	if err != nil {
-		return fiber.NewError(403, "You don't have a team in this league")
-	}
-
-	tx, _ := db.Begin()
-	res, _ := tx.Exec("INSERT INTO trades (league_id, proposer_team_id, receiver_team_id) VALUES (?, ?, ?)",
-		body.LeagueID, proposerTeamID, body.ReceiverTeamID)
-	tradeID, _ := res.LastInsertId()
-
-	for _, mid := range body.OfferMovieIDs {
-		tx.Exec("INSERT INTO trade_items (trade_id, team_id, movie_id) VALUES (?, ?, ?)", tradeID, proposerTeamID, mid)
-	}
-	for _, mid := range body.RequestMovieIDs {
-		tx.Exec("INSERT INTO trade_items (trade_id, team_id, movie_id) VALUES (?, ?, ?)", tradeID, body.ReceiverTeamID, mid)
-	}
-	tx.Commit()
-
-	return c.Status(201).JSON(fiber.Map{"id": tradeID, "status": "pending"})
-}
-
-func acceptTrade(c *fiber.Ctx) error {
-	tradeID, _ := strconv.Atoi(c.Params("id"))
-	userID := getUserID(c)
-
-	var receiverTeamID, leagueID, proposerTeamID int
-	db.QueryRow("SELECT receiver_team_id, league_id, proposer_team_id FROM trades WHERE id = ? AND status = 'pending'", tradeID).
-		Scan(&receiverTeamID, &leagueID, &proposerTeamID)
-
-	var teamUserID int
-	db.QueryRow("SELECT user_id FROM teams WHERE id = ?", receiverTeamID).Scan(&teamUserID)
-	if teamUserID != userID {
-		return fiber.NewError(403, "Only the receiving team can accept")
-	}
-
-	// Swap movies
-	tx, _ := db.Begin()
-	rows, _ := tx.Query("SELECT team_id, movie_id FROM trade_items WHERE trade_id = ?", tradeID)
-	type item struct{ teamID, movieID int }
-	var items []item
-	for rows.Next() {
-		var i item
-		rows.Scan(&i.teamID, &i.movieID)
-		items = append(items, i)
-	}
-	rows.Close()
-
-	for _, it := range items {
-		otherTeam := proposerTeamID
-		if it.teamID == proposerTeamID {
-			otherTeam = receiverTeamID
-		}
-		tx.Exec("DELETE FROM roster WHERE team_id = ? AND movie_id = ?", it.teamID, it.movieID)
-		tx.Exec("INSERT OR IGNORE INTO roster (team_id, movie_id, acquisition_type) VALUES (?, ?, 'trade')", otherTeam, it.movieID)
-		tx.Exec("INSERT INTO transactions (league_id, team_id, movie_id, type) VALUES (?, ?, ?, 'trade')", leagueID, otherTeam, it.movieID)
-	}
-	tx.Exec("UPDATE trades SET status = 'accepted' WHERE id = ?", tradeID)
-	tx.Commit()
-
-	return c.JSON(fiber.Map{"message": "Trade accepted"})
-}
-
-func rejectTrade(c *fiber.Ctx) error {
-	tradeID, _ := strconv.Atoi(c.Params("id"))
-	db.Exec("UPDATE trades SET status = 'rejected' WHERE id = ? AND status = 'pending'", tradeID)
-	return c.JSON(fiber.Map{"message": "Trade rejected"})
-}
-
-// --- Waivers ---
-
-func claimWaiver(c *fiber.Ctx) error {
-	userID := getUserID(c)
-	var body struct {
-		LeagueID int `json:"league_id"`
-		MovieID  int `json:"movie_id"`
-		DropMovieID int `json:"drop_movie_id"`
-	}
-	if err := c.BodyParser(&body); err != nil {
-		return fiber.NewError(400, "Invalid request")
-	}
-
-	var teamID int
-	err := db.QueryRow("SELECT id FROM teams WHERE league_id = ? AND user_id = ?", body.LeagueID, userID).Scan(&teamID)
-	if err != nil {
-		return fiber.NewError(403, "No team in this league")
-	}
-
-	tx, _ := db.Begin()
-	tx.Exec("INSERT INTO roster (team_id, movie_id, acquisition_type) VALUES (?, ?, 'waiver')", teamID, body.MovieID)
-	tx.Exec("INSERT INTO transactions (league_id, team_id, movie_id, type) VALUES (?, ?, ?, 'waiver')", body.LeagueID, teamID, body.MovieID)
-	if body.DropMovieID > 0 {
-		tx.Exec("DELETE FROM roster WHERE team_id = ? AND movie_id = ?", teamID, body.DropMovieID)
-		tx.Exec("INSERT INTO transactions (league_id, team_id, movie_id, type) VALUES (?, ?, ?, 'drop')", body.LeagueID, teamID, body.DropMovieID)
-	}
-	tx.Exec("INSERT INTO waiver_claims (league_id, team_id, movie_id, status) VALUES (?, ?, ?, 'claimed')", body.LeagueID, teamID, body.MovieID)
-	tx.Commit()
-
-	return c.JSON(fiber.Map{"message": "Waiver claim processed"})
-}
-
-func getLeagueWaivers(c *fiber.Ctx) error {
-	leagueID, _ := strconv.Atoi(c.Params("id"))
-	rows, _ := db.Query(`SELECT w.id, w.team_id, w.movie_id, w.status, w.claimed_at,
-		t.name as team_name, m.title as movie_title
-		FROM waiver_claims w
-		JOIN teams t ON t.id = w.team_id
-		JOIN movies m ON m.id = w.movie_id
-		WHERE w.league_id = ? ORDER BY w.claimed_at DESC`, leagueID)
-	defer rows.Close()
-
-	var waivers []fiber.Map
-	for rows.Next() {
-		var id, teamID, movieID int
-		var status, claimedAt, teamName, movieTitle string
-		rows.Scan(&id, &teamID, &movieID, &status, &claimedAt, &teamName, &movieTitle)
-		waivers = append(waivers, fiber.Map{
-			"id": id, "team_id": teamID, "movie_id": movieID, "status": status,
-			"claimed_at": claimedAt, "team_name": teamName, "movie_title": movieTitle,
-		})
-	}
-	if waivers == nil {
-		waivers = []fiber.Map{}
-	}
-	return c.JSON(waivers)
-}
-
 // --- Migrations ---
 
 func runMigrations() {
+	// Widen CHECK constraints first: rebuilding a table drops its indexes,
+	// which are recreated further down.
+	widenCheck("trades", "status", []string{"pending", "accepted", "rejected", "invalid", "countered", "cancelled", "expired", "in_review", "vetoed", "reversed"})
+	widenCheck("transactions", "type", []string{"draft", "waiver", "trade", "drop", "trade_veto", "commissioner_add", "commissioner_drop", "reversal"})
+	widenCheck("roster", "acquisition_type", []string{"draft", "waiver", "trade", "commissioner"})
+	// Availability is per league now (see getFreeAgents), so a movie's own
+	// status only says whether it is out yet.
+	db.Exec("UPDATE movies SET status = CASE WHEN release_date <= date('now') THEN 'released' ELSE 'upcoming' END WHERE status = 'free_agent'")
+	widenCheck("movies", "status", []string{"upcoming", "released"})
+
 	migrations := []string{
 		"ALTER TABLE movies ADD COLUMN points REAL NOT NULL DEFAULT 0",
 		"ALTER TABLE movies ADD COLUMN projected_points REAL NOT NULL DEFAULT 0",
@@ -1005,6 +1070,61 @@ func runMigrations() {
 		"ALTER TABLE leagues ADD COLUMN season_start TEXT NOT NULL DEFAULT ''",
 		"ALTER TABLE leagues ADD COLUMN season_end TEXT NOT NULL DEFAULT ''",
 		"ALTER TABLE leagues ADD COLUMN draft_rounds INTEGER NOT NULL DEFAULT 15",
+		"ALTER TABLE leagues ADD COLUMN trade_expiry_hours INTEGER NOT NULL DEFAULT 48",
+		"ALTER TABLE trades ADD COLUMN parent_trade_id INTEGER REFERENCES trades(id)",
+		"ALTER TABLE trades ADD COLUMN note TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE trades ADD COLUMN expires_at DATETIME",
+		"ALTER TABLE trades ADD COLUMN responded_at DATETIME",
+		"ALTER TABLE leagues ADD COLUMN trade_review_mode TEXT NOT NULL DEFAULT 'none'",
+		"ALTER TABLE leagues ADD COLUMN trade_veto_threshold REAL NOT NULL DEFAULT 0.5",
+		"ALTER TABLE leagues ADD COLUMN trade_review_hours INTEGER NOT NULL DEFAULT 48",
+		"ALTER TABLE trades ADD COLUMN review_ends_at DATETIME",
+		"ALTER TABLE transactions ADD COLUMN trade_id INTEGER REFERENCES trades(id)",
+		"ALTER TABLE trade_items ADD COLUMN to_team_id INTEGER REFERENCES teams(id)",
+		"ALTER TABLE leagues ADD COLUMN trade_deadline TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE leagues ADD COLUMN waiver_cutoff TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE leagues ADD COLUMN roster_lock_dates TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE leagues ADD COLUMN waiver_mode TEXT NOT NULL DEFAULT 'faab'",
+		"ALTER TABLE leagues ADD COLUMN faab_budget INTEGER NOT NULL DEFAULT 100",
+		"ALTER TABLE leagues ADD COLUMN waiver_run_day INTEGER NOT NULL DEFAULT 3",
+		"ALTER TABLE leagues ADD COLUMN waiver_run_hour INTEGER NOT NULL DEFAULT 8",
+		"ALTER TABLE teams ADD COLUMN faab_spent INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE waiver_claims ADD COLUMN bid INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE waiver_claims ADD COLUMN drop_movie_id INTEGER REFERENCES movies(id)",
+		"ALTER TABLE waiver_claims ADD COLUMN result TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE waiver_claims ADD COLUMN processed_at DATETIME",
+		"ALTER TABLE leagues ADD COLUMN waiver_period_hours INTEGER NOT NULL DEFAULT 48",
+		"ALTER TABLE teams ADD COLUMN waiver_priority INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE leagues ADD COLUMN max_roster_size INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE leagues ADD COLUMN summer_slots INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE leagues ADD COLUMN awards_slots INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE leagues ADD COLUMN flex_slots INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE leagues ADD COLUMN scoring_mode TEXT NOT NULL DEFAULT 'season'",
+		"ALTER TABLE leagues ADD COLUMN lineup_size INTEGER NOT NULL DEFAULT 5",
+		"ALTER TABLE leagues ADD COLUMN lineup_lock_day INTEGER NOT NULL DEFAULT 5",
+		"ALTER TABLE leagues ADD COLUMN lineup_lock_hour INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE leagues ADD COLUMN lineup_timezone TEXT NOT NULL DEFAULT 'America/New_York'",
+		"ALTER TABLE leagues ADD COLUMN league_format TEXT NOT NULL DEFAULT 'points'",
+		"ALTER TABLE leagues ADD COLUMN playoff_teams INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE leagues ADD COLUMN playoff_seeding TEXT NOT NULL DEFAULT 'standings'",
+		"ALTER TABLE leagues ADD COLUMN playoff_weeks_per_round INTEGER NOT NULL DEFAULT 1",
+		"ALTER TABLE leagues ADD COLUMN playoff_consolation BOOLEAN NOT NULL DEFAULT 0",
+		"ALTER TABLE leagues ADD COLUMN champion_team_id INTEGER REFERENCES teams(id)",
+		"ALTER TABLE leagues ADD COLUMN auto_start_draft BOOLEAN NOT NULL DEFAULT 0",
+		"ALTER TABLE leagues ADD COLUMN season_grace_days INTEGER NOT NULL DEFAULT 7",
+		"ALTER TABLE leagues ADD COLUMN completed_at DATETIME",
+		"ALTER TABLE leagues ADD COLUMN previous_league_id INTEGER REFERENCES leagues(id)",
+		"ALTER TABLE users ADD COLUMN is_system BOOLEAN NOT NULL DEFAULT 0",
+		"ALTER TABLE transactions ADD COLUMN reverses_id INTEGER REFERENCES transactions(id)",
+		"ALTER TABLE leagues ADD COLUMN visibility TEXT NOT NULL DEFAULT 'private'",
+		"ALTER TABLE leagues ADD COLUMN join_approval BOOLEAN NOT NULL DEFAULT 0",
+		"ALTER TABLE leagues ADD COLUMN division_matchups INTEGER NOT NULL DEFAULT 2",
+		"ALTER TABLE leagues ADD COLUMN playoff_division_winners BOOLEAN NOT NULL DEFAULT 1",
+		"ALTER TABLE teams ADD COLUMN division_id INTEGER REFERENCES league_divisions(id)",
+		"ALTER TABLE movies ADD COLUMN genres TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE movies ADD COLUMN runtime INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE movies ADD COLUMN collection_id INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE movies ADD COLUMN projection_version TEXT NOT NULL DEFAULT ''",
 	}
 	for _, m := range migrations {
 		db.Exec(m) // ignore errors (column already exists)
@@ -1021,6 +1141,147 @@ func runMigrations() {
 		message TEXT NOT NULL,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	)`)
+	db.Exec(`CREATE TABLE IF NOT EXISTS trade_messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		trade_id INTEGER NOT NULL REFERENCES trades(id),
+		user_id INTEGER NOT NULL REFERENCES users(id),
+		message TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	db.Exec(`CREATE TABLE IF NOT EXISTS trade_votes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		trade_id INTEGER NOT NULL REFERENCES trades(id),
+		team_id INTEGER NOT NULL REFERENCES teams(id),
+		veto BOOLEAN NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(trade_id, team_id)
+	)`)
+	db.Exec(`CREATE TABLE IF NOT EXISTS trade_teams (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		trade_id INTEGER NOT NULL REFERENCES trades(id),
+		team_id INTEGER NOT NULL REFERENCES teams(id),
+		status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending','accepted','rejected')),
+		responded_at DATETIME,
+		UNIQUE(trade_id, team_id)
+	)`)
+	// Backfill two-team trades from before multi-team support: items go to
+	// the other side, and both teams become participants.
+	db.Exec(`UPDATE trade_items SET to_team_id = (
+		SELECT CASE WHEN trade_items.team_id = t.proposer_team_id THEN t.receiver_team_id ELSE t.proposer_team_id END
+		FROM trades t WHERE t.id = trade_items.trade_id) WHERE to_team_id IS NULL`)
+	db.Exec(`INSERT OR IGNORE INTO trade_teams (trade_id, team_id, status, responded_at)
+		SELECT id, proposer_team_id, 'accepted', proposed_at FROM trades`)
+	db.Exec(`INSERT OR IGNORE INTO trade_teams (trade_id, team_id, status, responded_at)
+		SELECT id, receiver_team_id,
+			CASE WHEN status IN ('accepted', 'in_review', 'vetoed') THEN 'accepted' WHEN status = 'rejected' THEN 'rejected' ELSE 'pending' END,
+			responded_at FROM trades`)
+	db.Exec(`CREATE TABLE IF NOT EXISTS waiver_wire (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		league_id INTEGER NOT NULL REFERENCES leagues(id),
+		movie_id INTEGER NOT NULL REFERENCES movies(id),
+		dropped_by_team_id INTEGER REFERENCES teams(id),
+		dropped_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		available_at DATETIME NOT NULL
+	)`)
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_waiver_wire_league_movie ON waiver_wire(league_id, movie_id)")
+	db.Exec(`CREATE TABLE IF NOT EXISTS movie_daily_stats (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		movie_id INTEGER NOT NULL REFERENCES movies(id),
+		stat_date TEXT NOT NULL,
+		domestic_gross REAL NOT NULL DEFAULT 0,
+		worldwide_gross REAL NOT NULL DEFAULT 0,
+		points REAL NOT NULL DEFAULT 0,
+		UNIQUE(movie_id, stat_date)
+	)`)
+	db.Exec(`CREATE TABLE IF NOT EXISTS team_lineups (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		team_id INTEGER NOT NULL REFERENCES teams(id),
+		week INTEGER NOT NULL,
+		movie_id INTEGER NOT NULL REFERENCES movies(id),
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(team_id, week, movie_id)
+	)`)
+	db.Exec(`CREATE TABLE IF NOT EXISTS team_week_scores (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		team_id INTEGER NOT NULL REFERENCES teams(id),
+		week INTEGER NOT NULL,
+		points REAL NOT NULL DEFAULT 0,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(team_id, week)
+	)`)
+	db.Exec(`CREATE TABLE IF NOT EXISTS matchups (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		league_id INTEGER NOT NULL REFERENCES leagues(id),
+		week INTEGER NOT NULL,
+		home_team_id INTEGER NOT NULL REFERENCES teams(id),
+		away_team_id INTEGER REFERENCES teams(id),
+		home_points REAL NOT NULL DEFAULT 0,
+		away_points REAL NOT NULL DEFAULT 0,
+		UNIQUE(league_id, week, home_team_id)
+	)`)
+	db.Exec(`CREATE TABLE IF NOT EXISTS playoff_games (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		league_id INTEGER NOT NULL REFERENCES leagues(id),
+		bracket TEXT NOT NULL DEFAULT 'championship' CHECK(bracket IN ('championship','consolation')),
+		round INTEGER NOT NULL,
+		slot INTEGER NOT NULL,
+		start_week INTEGER NOT NULL,
+		end_week INTEGER NOT NULL,
+		team1_id INTEGER REFERENCES teams(id),
+		team2_id INTEGER REFERENCES teams(id),
+		seed1 INTEGER,
+		seed2 INTEGER,
+		team1_points REAL NOT NULL DEFAULT 0,
+		team2_points REAL NOT NULL DEFAULT 0,
+		winner_team_id INTEGER REFERENCES teams(id),
+		status TEXT NOT NULL DEFAULT 'scheduled' CHECK(status IN ('scheduled','in_progress','final','bye')),
+		UNIQUE(league_id, bracket, round, slot)
+	)`)
+	db.Exec(`CREATE TABLE IF NOT EXISTS league_results (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		league_id INTEGER NOT NULL REFERENCES leagues(id),
+		season_year INTEGER NOT NULL,
+		team_id INTEGER NOT NULL REFERENCES teams(id),
+		user_id INTEGER NOT NULL REFERENCES users(id),
+		team_name TEXT NOT NULL,
+		owner_name TEXT NOT NULL,
+		final_rank INTEGER NOT NULL,
+		total_points REAL NOT NULL,
+		wins INTEGER NOT NULL DEFAULT 0,
+		losses INTEGER NOT NULL DEFAULT 0,
+		ties INTEGER NOT NULL DEFAULT 0,
+		points_for REAL NOT NULL DEFAULT 0,
+		points_against REAL NOT NULL DEFAULT 0,
+		champion BOOLEAN NOT NULL DEFAULT 0,
+		finalized_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(league_id, team_id)
+	)`)
+	// Final results are a permanent record.
+	db.Exec(`CREATE TRIGGER IF NOT EXISTS league_results_no_update BEFORE UPDATE ON league_results
+		BEGIN SELECT RAISE(ABORT, 'league_results is immutable'); END`)
+	db.Exec(`CREATE TRIGGER IF NOT EXISTS league_results_no_delete BEFORE DELETE ON league_results
+		BEGIN SELECT RAISE(ABORT, 'league_results is immutable'); END`)
+	db.Exec(`CREATE TABLE IF NOT EXISTS league_result_picks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		league_id INTEGER NOT NULL REFERENCES leagues(id),
+		season_year INTEGER NOT NULL,
+		team_id INTEGER NOT NULL REFERENCES teams(id),
+		user_id INTEGER NOT NULL REFERENCES users(id),
+		team_name TEXT NOT NULL,
+		owner_name TEXT NOT NULL,
+		movie_id INTEGER NOT NULL REFERENCES movies(id),
+		movie_title TEXT NOT NULL,
+		draft_round INTEGER NOT NULL,
+		pick_number INTEGER NOT NULL,
+		points REAL NOT NULL DEFAULT 0,
+		budget REAL NOT NULL DEFAULT 0,
+		worldwide_gross REAL NOT NULL DEFAULT 0,
+		UNIQUE(league_id, pick_number)
+)`)
+	db.Exec(`CREATE TRIGGER IF NOT EXISTS league_result_picks_no_update BEFORE UPDATE ON league_result_picks
+		BEGIN SELECT RAISE(ABORT, 'league_result_picks is immutable'); END`)
+	db.Exec(`CREATE TRIGGER IF NOT EXISTS league_result_picks_no_delete BEFORE DELETE ON league_result_picks
+		BEGIN SELECT RAISE(ABORT, 'league_result_picks is immutable'); END`)
 	db.Exec(`CREATE TABLE IF NOT EXISTS notifications (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		user_id INTEGER NOT NULL REFERENCES users(id),
@@ -1031,6 +1292,173 @@ func runMigrations() {
 		read BOOLEAN NOT NULL DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	)`)
+	db.Exec(`CREATE TABLE IF NOT EXISTS league_setting_changes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		league_id INTEGER NOT NULL REFERENCES leagues(id),
+		user_id INTEGER NOT NULL REFERENCES users(id),
+		setting TEXT NOT NULL,
+		old_value TEXT NOT NULL DEFAULT '',
+		new_value TEXT NOT NULL DEFAULT '',
+		changed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+)`)
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_league_setting_changes_league ON league_setting_changes(league_id)")
+	db.Exec(`CREATE TABLE IF NOT EXISTS league_commissioners (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		league_id INTEGER NOT NULL REFERENCES leagues(id),
+		user_id INTEGER NOT NULL REFERENCES users(id),
+		appointed_by INTEGER NOT NULL REFERENCES users(id),
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(league_id, user_id)
+)`)
+	db.Exec(`CREATE TABLE IF NOT EXISTS league_audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		league_id INTEGER NOT NULL REFERENCES leagues(id),
+		user_id INTEGER NOT NULL REFERENCES users(id),
+		action TEXT NOT NULL,
+		team_id INTEGER REFERENCES teams(id),
+		details TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+)`)
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_league_audit_log_league ON league_audit_log(league_id)")
+	db.Exec(`CREATE TABLE IF NOT EXISTS league_join_requests (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		league_id INTEGER NOT NULL REFERENCES leagues(id),
+		user_id INTEGER NOT NULL REFERENCES users(id),
+		team_name TEXT NOT NULL,
+		message TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending','approved','denied','withdrawn')),
+		decided_by INTEGER REFERENCES users(id),
+		decided_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+)`)
+	// One open request per user and league
+	db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_league_join_requests_pending ON league_join_requests(league_id, user_id) WHERE status = 'pending'")
+	db.Exec(`CREATE TABLE IF NOT EXISTS league_invites (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		league_id INTEGER NOT NULL REFERENCES leagues(id),
+		code TEXT NOT NULL UNIQUE,
+		created_by INTEGER NOT NULL REFERENCES users(id),
+		email TEXT,
+		max_uses INTEGER NOT NULL DEFAULT 0,
+		expires_at DATETIME,
+		revoked_at DATETIME,
+		revoked_by INTEGER REFERENCES users(id),
+		email_sent_at DATETIME,
+		email_error TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+)`)
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_league_invites_league ON league_invites(league_id)")
+	db.Exec(`CREATE TABLE IF NOT EXISTS league_invite_uses (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		invite_id INTEGER NOT NULL REFERENCES league_invites(id),
+		user_id INTEGER NOT NULL REFERENCES users(id),
+		team_id INTEGER REFERENCES teams(id),
+		accepted_at DATETIME DEFAULT CURRENT_TIMESTAMP
+)`)
+	db.Exec(`CREATE TABLE IF NOT EXISTS league_divisions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		league_id INTEGER NOT NULL REFERENCES leagues(id),
+		name TEXT NOT NULL,
+		conference TEXT NOT NULL DEFAULT '',
+		position INTEGER NOT NULL DEFAULT 0,
+		UNIQUE(league_id, name)
+)`)
+	db.Exec(`CREATE TABLE IF NOT EXISTS movie_projections (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		movie_id INTEGER NOT NULL REFERENCES movies(id),
+		model TEXT NOT NULL,
+		version TEXT NOT NULL,
+		opening REAL NOT NULL DEFAULT 0,
+		domestic REAL NOT NULL DEFAULT 0,
+		worldwide REAL NOT NULL DEFAULT 0,
+		points REAL NOT NULL DEFAULT 0,
+		points_low REAL NOT NULL DEFAULT 0,
+		points_high REAL NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(movie_id, version)
+)`)
+	db.Exec(`CREATE TABLE IF NOT EXISTS league_articles (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		league_id INTEGER NOT NULL REFERENCES leagues(id),
+		kind TEXT NOT NULL,
+		week INTEGER NOT NULL DEFAULT 0,
+		title TEXT NOT NULL,
+		body TEXT NOT NULL DEFAULT '',
+		data TEXT NOT NULL DEFAULT '{}',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(league_id, kind, week)
+)`)
+	// Carry each league's original invite code over as an ordinary invite
+	db.Exec(`INSERT OR IGNORE INTO league_invites (league_id, code, created_by)
+		SELECT id, invite_code, owner_id FROM leagues WHERE invite_code IS NOT NULL AND invite_code != ''`)
+	// Archive leagues that completed before league_result_picks existed
+	archiveCompletedLeagues()
+}
+
+// widenCheck rewrites the CHECK(column IN (...)) constraint on table to allow
+// exactly values. SQLite can't alter a constraint in place, so the table is
+// recreated from its stored definition and the rows are copied across.
+func widenCheck(table, column string, values []string) {
+	var def string
+	if err := db.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&def); err != nil {
+		return
+	}
+	marker := "CHECK(" + column + " IN ("
+	start := strings.Index(def, marker)
+	if start < 0 {
+		return
+	}
+	end := strings.Index(def[start:], "))")
+	if end < 0 {
+		return
+	}
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "'" + v + "'"
+	}
+	check := marker + strings.Join(quoted, ",") + "))"
+	if def[start:start+end+2] == check {
+		return
+	}
+	newDef := def[:start] + check + def[start+end+2:]
+	newDef = strings.Replace(newDef, table, table+"_new", 1)
+
+	// foreign_keys can only be toggled outside a transaction and applies per
+	// connection, so pin one for the rebuild.
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		log.Printf("widenCheck %s: %v", table, err)
+		return
+	}
+	defer conn.Close()
+	conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF")
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("widenCheck %s: %v", table, err)
+		return
+	}
+	for _, stmt := range []string{
+		"DROP TABLE IF EXISTS " + table + "_new",
+		newDef,
+		"INSERT INTO " + table + "_new SELECT * FROM " + table,
+		"DROP TABLE " + table,
+		"ALTER TABLE " + table + "_new RENAME TO " + table,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			tx.Rollback()
+			log.Printf("widenCheck %s: %v", table, err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("widenCheck %s: %v", table, err)
+		return
+	}
+	log.Printf("Rebuilt %s with %s", table, check)
 }
 
 // --- Scheduled Sync ---
@@ -1099,14 +1527,14 @@ func runSyncAndScore() {
 			// Use vote_average from TMDB as RT proxy
 		}
 
-		res, _ := db.Exec(`UPDATE movies SET title=?, release_date=?, poster_url=?, budget=?, domestic_gross=?, worldwide_gross=?, status=?
-			WHERE tmdb_id=?`,
-			m.Title, m.ReleaseDate, poster, budget, revenue, revenue, status, m.ID)
+		res, _ := db.Exec(`UPDATE movies SET title=?, release_date=?, poster_url=?, budget=?, domestic_gross=?, worldwide_gross=?, status=?,
+			genres=?, runtime=?, collection_id=? WHERE tmdb_id=?`,
+			m.Title, m.ReleaseDate, poster, budget, revenue, revenue, status, details.genreList(), details.Runtime, details.collectionID(), m.ID)
 		rowsAff, _ := res.RowsAffected()
 		if rowsAff == 0 {
-			db.Exec(`INSERT INTO movies (tmdb_id, title, release_date, poster_url, budget, domestic_gross, worldwide_gross, status)
-				VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-				m.ID, m.Title, m.ReleaseDate, poster, budget, revenue, revenue, status)
+			db.Exec(`INSERT INTO movies (tmdb_id, title, release_date, poster_url, budget, domestic_gross, worldwide_gross, status, genres, runtime, collection_id)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				m.ID, m.Title, m.ReleaseDate, poster, budget, revenue, revenue, status, details.genreList(), details.Runtime, details.collectionID())
 		}
 
 		// Opening weekend detection
@@ -1123,12 +1551,12 @@ func runSyncAndScore() {
 	// Update RT scores using TMDB vote_average
 	updateRTScores()
 
-	// Update projections
-	updateProjections()
-
 	// Recalculate scores
 	recalculateAllScores()
 
+	// Update projections; released movies project from today's grosses
+	updateProjections()
+
 	log.Printf("Scheduled sync complete: %d movies synced", synced)
 }
 
@@ -1163,52 +1591,6 @@ func updateRTScores() {
 	}
 }
 
-func updateProjections() {
-	rows, err := db.Query("SELECT id, budget FROM movies WHERE status = 'upcoming'")
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var id int
-		var budget float64
-		rows.Scan(&id, &budget)
-
-		// Simple heuristic: projected gross = budget * 2.5
-		projectedGross := budget * 2.5
-		// Apply scoring: domestic ~ 40% of worldwide, opening ~ 35% of domestic
-		domestic := projectedGross * 0.4
-		opening := domestic * 0.35
-		worldwide := projectedGross
-
-		projected := opening/1_000_000 + domestic/1_000_000*0.5 + worldwide/1_000_000*0.25
-		if domestic >= 100_000_000 {
-			projected += 20
-		}
-		if worldwide >= 500_000_000 {
-			projected += 50
-		}
-
-		db.Exec("UPDATE movies SET projected_points = ? WHERE id = ?", projected, id)
-	}
-}
-
-// --- League Invites ---
-
-func getLeagueInvite(c *fiber.Ctx) error {
-	leagueID, _ := strconv.Atoi(c.Params("id"))
-
-	var code sql.NullString
-	db.QueryRow("SELECT invite_code FROM leagues WHERE id = ?", leagueID).Scan(&code)
-	if !code.Valid || code.String == "" {
-		newCode := uuid.New().String()
-		db.Exec("UPDATE leagues SET invite_code = ? WHERE id = ?", newCode, leagueID)
-		code.String = newCode
-	}
-	return c.JSON(fiber.Map{"invite_code": code.String})
-}
-
 func authMiddlewareOptional(c *fiber.Ctx) error {
 	auth := c.Get("Authorization")
 	if strings.HasPrefix(auth, "Bearer ") {
@@ -1224,133 +1606,8 @@ func authMiddlewareOptional(c *fiber.Ctx) error {
 	return c.Next()
 }
 
-func joinLeagueByInvite(c *fiber.Ctx) error {
-	code := c.Params("code")
-	userIDVal := c.Locals("user_id")
-	if userIDVal == nil {
-		return fiber.NewError(401, "Authentication required")
-	}
-	userID := userIDVal.(int)
-
-	var leagueID, maxTeams int
-	var status string
-	err := db.QueryRow("SELECT id, max_teams, status FROM leagues WHERE invite_code = ?", code).Scan(&leagueID, &maxTeams, &status)
-	if err != nil {
-		return fiber.NewError(404, "Invalid invite code")
-	}
-	if status != "pending" {
-		return fiber.NewError(400, "League is not accepting new teams")
-	}
-
-	var count int
-	db.QueryRow("SELECT COUNT(*) FROM teams WHERE league_id = ?", leagueID).Scan(&count)
-	if count >= maxTeams {
-		return fiber.NewError(400, "League is full")
-	}
-
-	var body struct {
-		TeamName string `json:"team_name"`
-	}
-	c.BodyParser(&body)
-	if body.TeamName == "" {
-		body.TeamName = "My Team"
-	}
-
-	_, err = db.Exec("INSERT INTO teams (league_id, user_id, name) VALUES (?, ?, ?)", leagueID, userID, body.TeamName)
-	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE") {
-			return fiber.NewError(409, "Already in this league")
-		}
-		return fiber.NewError(500, err.Error())
-	}
-	return c.JSON(fiber.Map{"message": "Joined league", "league_id": leagueID})
-}
-
 // --- Movie Projections ---
 
-func getMovieProjection(c *fiber.Ctx) error {
-	id, _ := strconv.Atoi(c.Params("id"))
-
-	var budget, domestic, worldwide, opening, points, projPoints float64
-	var title, status string
-	err := db.QueryRow("SELECT title, budget, domestic_gross, worldwide_gross, opening_weekend_gross, points, projected_points, status FROM movies WHERE id = ?", id).
-		Scan(&title, &budget, &domestic, &worldwide, &opening, &points, &projPoints, &status)
-	if err != nil {
-		return fiber.NewError(404, "Movie not found")
-	}
-
-	// Build projection breakdown
-	projGross := budget * 2.5
-	projDomestic := projGross * 0.4
-	projOpening := projDomestic * 0.35
-	projWorldwide := projGross
-
-	return c.JSON(fiber.Map{
-		"movie_id":             id,
-		"title":                title,
-		"status":               status,
-		"current_points":       points,
-		"projected_points":     projPoints,
-		"budget":               budget,
-		"projected_domestic":   projDomestic,
-		"projected_worldwide":  projWorldwide,
-		"projected_opening":    projOpening,
-		"actual_domestic":      domestic,
-		"actual_worldwide":     worldwide,
-		"actual_opening":       opening,
-	})
-}
-
-// --- Trade Analyzer ---
-
-func analyzeTrade(c *fiber.Ctx) error {
-	var body struct {
-		Give    []int `json:"give"`
-		Receive []int `json:"receive"`
-	}
-	if err := c.BodyParser(&body); err != nil {
-		return fiber.NewError(400, "Invalid request")
-	}
-
-	getPoints := func(ids []int) (float64, float64) {
-		var pts, proj float64
-		for _, id := range ids {
-			var p, pp float64
-			db.QueryRow("SELECT points, projected_points FROM movies WHERE id = ?", id).Scan(&p, &pp)
-			pts += p
-			proj += pp
-		}
-		return pts, proj
-	}
-
-	givePts, giveProj := getPoints(body.Give)
-	recvPts, recvProj := getPoints(body.Receive)
-
-	diff := recvPts - givePts
-	projDiff := recvProj - giveProj
-
-	rec := "neutral"
-	if projDiff > 10 {
-		rec = "strong_accept"
-	} else if projDiff > 0 {
-		rec = "lean_accept"
-	} else if projDiff < -10 {
-		rec = "strong_reject"
-	} else if projDiff < 0 {
-		rec = "lean_reject"
-	}
-
-	return c.JSON(fiber.Map{
-		"give_points":          givePts,
-		"receive_points":       recvPts,
-		"point_difference":     diff,
-		"give_projected":       giveProj,
-		"receive_projected":    recvProj,
-		"projected_difference": projDiff,
-		"recommendation":       rec,
-	})
-}
-
 // --- Seed Data ---
 
 func seedMovies() {
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// --- Head-to-Head ---
+//
+// In leagues with league_format "h2h" teams play one opponent a week. The
+// schedule is a round robin, repeated as often as the season allows,
+// generated when the draft completes; it starts with the first week that
+// locks after the draft and ends before the playoffs. With an odd number
+// of teams one team has a bye each week (away_team_id is NULL). Leagues
+// with divisions add extra rounds between division rivals (see
+// divisions.go). A matchup is decided once its week ends, by the two teams'
+// week scores (see lineups.go).
+
+type teamRecord struct {
+	TeamID              int
+	Wins, Losses, Ties  int
+	PointsFor, PointsAg float64
+}
+
+func (r teamRecord) String() string {
+	return fmt.Sprintf("%d-%d-%d", r.Wins, r.Losses, r.Ties)
+}
+
+func (r teamRecord) winPct() float64 {
+	games := r.Wins + r.Losses + r.Ties
+	if games == 0 {
+		return 0
+	}
+	return (float64(r.Wins) + 0.5*float64(r.Ties)) / float64(games)
+}
+
+// roundRobin pairs every team with every other once. Each round is a list
+// of [home, away] pairs; 0 stands for a bye.
+func roundRobin(teams []int) [][][2]int {
+	ids := append([]int{}, teams...)
+	if len(ids)%2 == 1 {
+		ids = append(ids, 0)
+	}
+	n := len(ids)
+	var rounds [][][2]int
+	for round := 0; round < n-1; round++ {
+		var pairs [][2]int
+		for i := 0; i < n/2; i++ {
+			home, away := ids[i], ids[n-1-i]
+			// Alternate home and away so nobody is always the home side.
+			if round%2 == 1 {
+				home, away = away, home
+			}
+			if home == 0 {
+				home, away = away, home
+			}
+			pairs = append(pairs, [2]int{home, away})
+		}
+		rounds = append(rounds, pairs)
+		// Rotate everyone but the first team.
+		ids = append([]int{ids[0], ids[n-1]}, ids[1:n-1]...)
+	}
+	return rounds
+}
+
+// generateSchedule creates an h2h league's matchups if it doesn't have any
+// yet.
+func generateSchedule(leagueID int) {
+	r, err := loadLineupRules(db, leagueID)
+	if err != nil || r.Format != "h2h" {
+		return
+	}
+	var existing int
+	db.QueryRow("SELECT COUNT(*) FROM matchups WHERE league_id = ?", leagueID).Scan(&existing)
+	teams := leagueTeamIDs(leagueID)
+	if existing > 0 || len(teams) < 2 {
+		return
+	}
+
+	rounds := divisionSchedule(leagueID, teams)
+	first := r.currentWeek() + 1
+	last := r.lastWeek()
+	if start := loadPlayoffRules(db, leagueID).startWeek(r); start > 0 {
+		last = start - 1
+	}
+	if last < first {
+		last = first + len(rounds) - 1
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	for week := first; week <= last; week++ {
+		for _, pair := range rounds[(week-first)%len(rounds)] {
+			var away interface{}
+			if pair[1] != 0 {
+				away = pair[1]
+			}
+			tx.Exec("INSERT OR IGNORE INTO matchups (league_id, week, home_team_id, away_team_id) VALUES (?, ?, ?, ?)",
+				leagueID, week, pair[0], away)
+		}
+	}
+	tx.Commit()
+}
+
+// updateMatchupScores copies week scores onto each matchup.
+func updateMatchupScores(tx *sql.Tx) {
+	tx.Exec(`UPDATE matchups SET
+		home_points = COALESCE((SELECT points FROM team_week_scores WHERE team_id = matchups.home_team_id AND week = matchups.week), 0),
+		away_points = COALESCE((SELECT points FROM team_week_scores WHERE team_id = matchups.away_team_id AND week = matchups.week), 0)`)
+}
+
+type matchup struct {
+	ID, Week, HomeTeamID   int
+	AwayTeamID             sql.NullInt64
+	HomePoints, AwayPoints float64
+}
+
+func loadMatchups(leagueID, week int) []matchup {
+	query := "SELECT id, week, home_team_id, away_team_id, home_points, away_points FROM matchups WHERE league_id = ?"
+	args := []interface{}{leagueID}
+	if week > 0 {
+		query += " AND week = ?"
+		args = append(args, week)
+	}
+	rows, err := db.Query(query+" ORDER BY week, id", args...)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var out []matchup
+	for rows.Next() {
+		var m matchup
+		rows.Scan(&m.ID, &m.Week, &m.HomeTeamID, &m.AwayTeamID, &m.HomePoints, &m.AwayPoints)
+		out = append(out, m)
+	}
+	return out
+}
+
+// winner is the team that won a decided matchup, or 0 for a tie or bye.
+func (m matchup) winner() int {
+	if !m.AwayTeamID.Valid {
+		return 0
+	}
+	home, away := math.Round(m.HomePoints*100), math.Round(m.AwayPoints*100)
+	switch {
+	case home > away:
+		return m.HomeTeamID
+	case away > home:
+		return int(m.AwayTeamID.Int64)
+	}
+	return 0
+}
+
+// leagueRecords tallies every team's record from matchups whose week has
+// ended.
+func leagueRecords(leagueID int) map[int]*teamRecord {
+	records := make(map[int]*teamRecord)
+	for _, id := range leagueTeamIDs(leagueID) {
+		records[id] = &teamRecord{TeamID: id}
+	}
+	r, err := loadLineupRules(db, leagueID)
+	if err != nil {
+		return records
+	}
+	current := r.currentWeek()
+	for _, m := range loadMatchups(leagueID, 0) {
+		if m.Week >= current || !m.AwayTeamID.Valid {
+			continue
+		}
+		home, away := records[m.HomeTeamID], records[int(m.AwayTeamID.Int64)]
+		if home == nil || away == nil {
+			continue
+		}
+		home.PointsFor += m.HomePoints
+		home.PointsAg += m.AwayPoints
+		away.PointsFor += m.AwayPoints
+		away.PointsAg += m.HomePoints
+		switch m.winner() {
+		case m.HomeTeamID:
+			home.Wins++
+			away.Losses++
+		case 0:
+			home.Ties++
+			away.Ties++
+		default:
+			away.Wins++
+			home.Losses++
+		}
+	}
+	return records
+}
+
+// rankByRecord orders teams by win percentage, then points for.
+func rankByRecord(records map[int]*teamRecord) []*teamRecord {
+	ranked := make([]*teamRecord, 0, len(records))
+	for _, rec := range records {
+		ranked = append(ranked, rec)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.winPct() != b.winPct() {
+			return a.winPct() > b.winPct()
+		}
+		if a.PointsFor != b.PointsFor {
+			return a.PointsFor > b.PointsFor
+		}
+		return a.TeamID < b.TeamID
+	})
+	return ranked
+}
+
+// getMatchups lists an h2h league's matchups for ?week=, defaulting to the
+// week in progress (or the first scheduled week before the season starts).
+func getMatchups(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	r, err := loadLineupRules(db, leagueID)
+	if err != nil {
+		return err
+	}
+	if r.Format != "h2h" {
+		return newAPIError(400, "NOT_HEAD_TO_HEAD", "This league doesn't play head-to-head matchups")
+	}
+	if requireActiveLeague(db, leagueID) == nil {
+		generateSchedule(leagueID)
+		lockLineups(leagueID)
+	}
+
+	var first, last sql.NullInt64
+	db.QueryRow("SELECT MIN(week), MAX(week) FROM matchups WHERE league_id = ?", leagueID).Scan(&first, &last)
+	current := r.currentWeek()
+	week := current
+	if first.Valid && int64(week) < first.Int64 {
+		week = int(first.Int64)
+	}
+	if last.Valid && int64(week) > last.Int64 {
+		week = int(last.Int64)
+	}
+	if v := c.Query("week"); v != "" {
+		week, _ = strconv.Atoi(v)
+		if week < 1 || (last.Valid && int64(week) > last.Int64) {
+			return newAPIError(400, errInvalidWeek, "Week is outside the schedule").with("week", week)
+		}
+	}
+
+	records := leagueRecords(leagueID)
+	side := func(teamID int, points float64) fiber.Map {
+		s := fiber.Map{"team_id": teamID, "team_name": teamName(teamID), "points": points}
+		if rec := records[teamID]; rec != nil {
+			s["record"] = rec.String()
+		}
+		return s
+	}
+
+	matchups := []fiber.Map{}
+	for _, m := range loadMatchups(leagueID, week) {
+		status := "scheduled"
+		switch {
+		case m.Week < current:
+			status = "final"
+		case m.Week == current:
+			status = "in_progress"
+		}
+		row := fiber.Map{
+			"id": m.ID, "week": m.Week, "status": status,
+			"home": side(m.HomeTeamID, m.HomePoints), "away": nil,
+			"bye": !m.AwayTeamID.Valid, "winner_team_id": nil,
+		}
+		if m.AwayTeamID.Valid {
+			row["away"] = side(int(m.AwayTeamID.Int64), m.AwayPoints)
+			if status == "final" {
+				if w := m.winner(); w != 0 {
+					row["winner_team_id"] = w
+				}
+			}
+		}
+		matchups = append(matchups, row)
+	}
+
+	out := r.weekJSON(week)
+	out["league_id"] = leagueID
+	out["current_week"] = current
+	out["matchups"] = matchups
+	return c.JSON(out)
+}
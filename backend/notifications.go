@@ -11,6 +11,52 @@ func createNotification(userID int, nType, title, body string, leagueID int) {
 		userID, nType, title, body, leagueID)
 }
 
+// notifyLeague sends a notification to every member of a league except the
+// listed users.
+func notifyLeague(leagueID int, nType, title, body string, exceptUserIDs ...int) {
+	rows, err := db.Query("SELECT user_id FROM teams WHERE league_id = ?", leagueID)
+	if err != nil {
+		return
+	}
+	var userIDs []int
+	for rows.Next() {
+		var uid int
+		rows.Scan(&uid)
+		userIDs = append(userIDs, uid)
+	}
+	rows.Close()
+
+	skip := make(map[int]bool)
+	for _, uid := range exceptUserIDs {
+		skip[uid] = true
+	}
+	for _, uid := range userIDs {
+		if !skip[uid] {
+			createNotification(uid, nType, title, body, leagueID)
+		}
+	}
+}
+
+// notifyCommissioners sends a notification to a league's owner and
+// co-commissioners.
+func notifyCommissioners(leagueID int, nType, title, body string) {
+	rows, err := db.Query(`SELECT owner_id FROM leagues WHERE id = ?
+		UNION SELECT user_id FROM league_commissioners WHERE league_id = ?`, leagueID, leagueID)
+	if err != nil {
+		return
+	}
+	var userIDs []int
+	for rows.Next() {
+		var uid int
+		rows.Scan(&uid)
+		userIDs = append(userIDs, uid)
+	}
+	rows.Close()
+	for _, uid := range userIDs {
+		createNotification(uid, nType, title, body, leagueID)
+	}
+}
+
 func getNotifications(c *fiber.Ctx) error {
 	userID := getUserID(c)
 	rows, err := db.Query(`SELECT id, type, title, body, league_id, read, created_at FROM notifications
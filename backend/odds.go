@@ -0,0 +1,434 @@
+package main
+
+import (
+	"database/sql"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// --- Season Odds ---
+//
+// GET /api/leagues/:id/odds plays out the rest of the season thousands of
+// times. In each simulation every rostered movie's final points are drawn
+// from its projection (normal around projected_points, with the spread of
+// the stored 80% interval), and a team finishes with its current points
+// plus what its movies have left to earn. Teams are ranked by those totals.
+// Head-to-head records and lineup choices aren't simulated, so in those
+// leagues the odds are for the points race.
+//
+// With playoffs, the top playoff_teams make the bracket (or the teams
+// already in it, once it is seeded) and each game goes to the team whose
+// movies earn more over the rest of the season, with per-game luck on top.
+// Games already decided keep their winner.
+//
+// Simulations run on a single worker goroutine. Results are cached per
+// league, simulation count and seed until scores are next recalculated or
+// projections updated. Every league's default run is kept; only the
+// oddsCustomLimit most recently used runs with another count or seed are.
+
+const (
+	defaultOddsSimulations = 5000
+	maxOddsSimulations     = 20000
+	// oddsWait is how long a request waits for the worker before being told
+	// to come back.
+	oddsWait = 10 * time.Second
+	// playoffGameLuck is the log-scale spread of a team's output in a single
+	// playoff game.
+	playoffGameLuck = 0.35
+	// oddsCustomLimit caps the cached runs that aren't a league's default.
+	oddsCustomLimit = 32
+)
+
+const (
+	errInvalidSimulations = "INVALID_SIMULATIONS"
+	errInvalidSeed        = "INVALID_SEED"
+	errOddsBusy           = "ODDS_BUSY"
+)
+
+type oddsKey struct {
+	LeagueID, Simulations int
+	Seed                  int64
+}
+
+// isDefault reports whether the key is the run a plain request asks for.
+func (k oddsKey) isDefault() bool {
+	return k.Simulations == defaultOddsSimulations && k.Seed == int64(k.LeagueID)
+}
+
+type oddsEntry struct {
+	done   chan struct{}
+	result fiber.Map
+	err    error
+}
+
+var (
+	oddsMu    sync.Mutex
+	oddsCache = map[oddsKey]*oddsEntry{}
+	// oddsCustom lists the cached non-default keys, least recently used
+	// first.
+	oddsCustom []oddsKey
+	oddsJobs   = make(chan oddsJob, 64)
+)
+
+type oddsJob struct {
+	key   oddsKey
+	entry *oddsEntry
+}
+
+// invalidateOdds drops every cached simulation. Runs still in flight finish
+// for whoever is waiting on them but aren't kept.
+func invalidateOdds() {
+	oddsMu.Lock()
+	oddsCache = map[oddsKey]*oddsEntry{}
+	oddsCustom = nil
+	oddsMu.Unlock()
+}
+
+// forgetOddsKey drops key from the custom list. Callers hold oddsMu.
+func forgetOddsKey(key oddsKey) {
+	for i, k := range oddsCustom {
+		if k == key {
+			oddsCustom = append(oddsCustom[:i], oddsCustom[i+1:]...)
+			return
+		}
+	}
+}
+
+// dropOdds removes e from the cache if it is still the entry for key.
+func dropOdds(key oddsKey, e *oddsEntry) {
+	oddsMu.Lock()
+	defer oddsMu.Unlock()
+	if oddsCache[key] == e {
+		delete(oddsCache, key)
+		forgetOddsKey(key)
+	}
+}
+
+// oddsFor returns the cached entry for key, queueing a simulation if there
+// isn't one.
+func oddsFor(key oddsKey) *oddsEntry {
+	oddsMu.Lock()
+	defer oddsMu.Unlock()
+	if e, ok := oddsCache[key]; ok {
+		if !key.isDefault() {
+			forgetOddsKey(key)
+			oddsCustom = append(oddsCustom, key)
+		}
+		return e
+	}
+	e := &oddsEntry{done: make(chan struct{})}
+	oddsCache[key] = e
+	if !key.isDefault() {
+		oddsCustom = append(oddsCustom, key)
+		if len(oddsCustom) > oddsCustomLimit {
+			delete(oddsCache, oddsCustom[0])
+			oddsCustom = oddsCustom[1:]
+		}
+	}
+	select {
+	case oddsJobs <- oddsJob{key, e}:
+	default:
+		delete(oddsCache, key)
+		forgetOddsKey(key)
+		e.err = newAPIError(503, errOddsBusy, "Too many simulations queued; try again shortly")
+		close(e.done)
+	}
+	return e
+}
+
+func oddsWorker() {
+	for job := range oddsJobs {
+		job.entry.result, job.entry.err = simulateLeague(job.key)
+		close(job.entry.done)
+	}
+}
+
+// --- Simulation ---
+
+type simMovie struct {
+	Points, Mean, SD float64
+}
+
+type simTeam struct {
+	ID     int
+	Name   string
+	Points float64
+	Movies []simMovie
+}
+
+// movieOutcomeSD is the spread of a movie's final points. The stored
+// interval is used when there is one; otherwise a share of its remaining
+// points, as in the trade analyzer.
+func movieOutcomeSD(status string, points, projected, low, high float64) float64 {
+	if high > low {
+		return (high - low) / (2 * projectionZ)
+	}
+	share := releasedRemainingStdDev
+	if status == "upcoming" {
+		share = upcomingRemainingStdDev
+	}
+	return share * math.Max(projected-points, 0)
+}
+
+func loadSimTeams(leagueID int) ([]simTeam, error) {
+	rows, err := db.Query("SELECT id, name, total_points FROM teams WHERE league_id = ? ORDER BY id", leagueID)
+	if err != nil {
+		return nil, err
+	}
+	var teams []simTeam
+	index := map[int]int{}
+	for rows.Next() {
+		var t simTeam
+		rows.Scan(&t.ID, &t.Name, &t.Points)
+		index[t.ID] = len(teams)
+		teams = append(teams, t)
+	}
+	rows.Close()
+
+	rows, err = db.Query(`SELECT r.team_id, m.status, m.points, m.projected_points,
+		COALESCE(p.points_low, 0), COALESCE(p.points_high, 0)
+		FROM roster r JOIN teams t ON t.id = r.team_id JOIN movies m ON m.id = r.movie_id
+		LEFT JOIN movie_projections p ON p.movie_id = m.id AND p.version = m.projection_version
+		WHERE t.league_id = ?`, leagueID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var teamID int
+		var status string
+		var points, projected, low, high float64
+		rows.Scan(&teamID, &status, &points, &projected, &low, &high)
+		if projected < points {
+			projected = points
+		}
+		i := index[teamID]
+		teams[i].Movies = append(teams[i].Movies, simMovie{
+			Points: points, Mean: projected, SD: movieOutcomeSD(status, points, projected, low, high),
+		})
+	}
+	return teams, nil
+}
+
+// playoffField is the teams already in the championship bracket in seed
+// order, and the winners of decided games keyed by the pair that played.
+func playoffField(leagueID int) ([]int, map[[2]int]int) {
+	seeds := map[int]int{}
+	decided := map[[2]int]int{}
+	for _, g := range loadPlayoffGames(leagueID) {
+		if g.Bracket != bracketChampionship {
+			continue
+		}
+		if g.Round == 1 {
+			seeds[int(g.Seed1.Int64)] = int(g.Team1.Int64)
+			if g.Team2.Valid {
+				seeds[int(g.Seed2.Int64)] = int(g.Team2.Int64)
+			}
+		}
+		if g.Team2.Valid && g.Winner.Valid && g.Status == "final" {
+			decided[pairKey(int(g.Team1.Int64), int(g.Team2.Int64))] = int(g.Winner.Int64)
+		}
+	}
+	field := make([]int, len(seeds))
+	for seed, team := range seeds {
+		if seed >= 1 && seed <= len(field) {
+			field[seed-1] = team
+		}
+	}
+	return field, decided
+}
+
+func pairKey(a, b int) [2]int {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]int{a, b}
+}
+
+// simulateBracket plays out a bracket for teams in seed order. strength is
+// each team's output over the rest of the season.
+func simulateBracket(rng *rand.Rand, field []int, strength map[int]float64, decided map[[2]int]int) int {
+	size := 1 << bracketRounds(len(field))
+	round := make([]int, 0, size)
+	for _, seed := range seedOrder(size) {
+		team := 0
+		if seed <= len(field) {
+			team = field[seed-1]
+		}
+		round = append(round, team)
+	}
+	for len(round) > 1 {
+		next := make([]int, 0, len(round)/2)
+		for i := 0; i+1 < len(round); i += 2 {
+			a, b := round[i], round[i+1]
+			switch {
+			case a == 0:
+				next = append(next, b)
+			case b == 0:
+				next = append(next, a)
+			default:
+				if w, ok := decided[pairKey(a, b)]; ok {
+					next = append(next, w)
+					continue
+				}
+				sa := strength[a] * math.Exp(playoffGameLuck*rng.NormFloat64())
+				sb := strength[b] * math.Exp(playoffGameLuck*rng.NormFloat64())
+				if sb > sa {
+					next = append(next, b)
+				} else {
+					next = append(next, a)
+				}
+			}
+		}
+		round = next
+	}
+	return round[0]
+}
+
+func simulateLeague(key oddsKey) (fiber.Map, error) {
+	var status string
+	var champion sql.NullInt64
+	if err := db.QueryRow("SELECT status, champion_team_id FROM leagues WHERE id = ?", key.LeagueID).Scan(&status, &champion); err != nil {
+		return nil, newAPIError(404, errLeagueNotFound, "League not found")
+	}
+	teams, err := loadSimTeams(key.LeagueID)
+	if err != nil {
+		return nil, err
+	}
+	p := loadPlayoffRules(db, key.LeagueID)
+	field, decided := playoffField(key.LeagueID)
+	playoffTeams := 0
+	if p.enabled() {
+		playoffTeams = p.Teams
+		if playoffTeams > len(teams) {
+			playoffTeams = len(teams)
+		}
+	}
+
+	n := len(teams)
+	rankCounts := make([][]int, n)
+	for i := range rankCounts {
+		rankCounts[i] = make([]int, n)
+	}
+	playoffCounts := make([]int, n)
+	titleCounts := make([]int, n)
+	totals := make([]float64, n)
+	index := map[int]int{}
+	for i, t := range teams {
+		index[t.ID] = i
+	}
+
+	rng := rand.New(rand.NewSource(key.Seed))
+	final := make([]float64, n)
+	order := make([]int, n)
+	strength := map[int]float64{}
+	for sim := 0; sim < key.Simulations; sim++ {
+		for i, t := range teams {
+			rest := 0.0
+			for _, m := range t.Movies {
+				rest += math.Max(m.Mean+m.SD*rng.NormFloat64()-m.Points, 0)
+			}
+			final[i] = t.Points + rest
+			strength[t.ID] = rest
+			totals[i] += final[i]
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			if final[order[a]] != final[order[b]] {
+				return final[order[a]] > final[order[b]]
+			}
+			return teams[order[a]].ID < teams[order[b]].ID
+		})
+		for rank, i := range order {
+			rankCounts[i][rank]++
+		}
+
+		switch {
+		case champion.Valid:
+			titleCounts[index[int(champion.Int64)]]++
+		case playoffTeams >= 2:
+			bracket := field
+			if len(bracket) == 0 {
+				bracket = make([]int, playoffTeams)
+				for s := range bracket {
+					bracket[s] = teams[order[s]].ID
+				}
+			}
+			for _, id := range bracket {
+				playoffCounts[index[id]]++
+			}
+			titleCounts[index[simulateBracket(rng, bracket, strength, decided)]]++
+		case n > 0:
+			titleCounts[order[0]]++
+		}
+	}
+
+	sims := float64(key.Simulations)
+	result := make([]fiber.Map, n)
+	for i, t := range teams {
+		probs := make([]float64, n)
+		avgRank := 0.0
+		for r, count := range rankCounts[i] {
+			probs[r] = float64(count) / sims
+			avgRank += float64(r+1) * probs[r]
+		}
+		row := fiber.Map{
+			"team_id": t.ID, "team_name": t.Name, "total_points": t.Points,
+			"projected_points": totals[i] / sims, "average_rank": avgRank,
+			"rank_probabilities": probs, "win_championship": float64(titleCounts[i]) / sims,
+			"make_playoffs": nil,
+		}
+		if playoffTeams >= 2 {
+			row["make_playoffs"] = float64(playoffCounts[i]) / sims
+		}
+		result[i] = row
+	}
+	sort.SliceStable(result, func(a, b int) bool {
+		return result[a]["average_rank"].(float64) < result[b]["average_rank"].(float64)
+	})
+
+	return fiber.Map{
+		"league_id": key.LeagueID, "status": status, "simulations": key.Simulations, "seed": key.Seed,
+		"playoff_teams": playoffTeams, "bracket_seeded": len(field) > 0,
+		"generated_at": time.Now().UTC(), "teams": result,
+	}, nil
+}
+
+// getLeagueOdds returns each team's chances of every final rank, making the
+// playoffs and winning it all. ?simulations= sets the number of runs and
+// ?seed= makes them reproducible; the default seed is the league ID.
+func getLeagueOdds(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	sims := c.QueryInt("simulations", defaultOddsSimulations)
+	if sims < 100 || sims > maxOddsSimulations {
+		return newAPIError(400, errInvalidSimulations, "simulations must be between 100 and 20000").
+			with("max", maxOddsSimulations)
+	}
+	seed := int64(leagueID)
+	if s := c.Query("seed"); s != "" {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return newAPIError(400, errInvalidSeed, "seed must be an integer")
+		}
+		seed = v
+	}
+
+	key := oddsKey{LeagueID: leagueID, Simulations: sims, Seed: seed}
+	e := oddsFor(key)
+	select {
+	case <-e.done:
+	case <-time.After(oddsWait):
+		return c.Status(202).JSON(fiber.Map{"status": "running", "message": "Simulations are still running; try again shortly"})
+	}
+	if e.err != nil {
+		dropOdds(key, e)
+		return e.err
+	}
+	return c.JSON(e.result)
+}
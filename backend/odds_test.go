@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestSimulateBracket(t *testing.T) {
+	tests := []struct {
+		name     string
+		field    []int
+		strength map[int]float64
+		decided  map[[2]int]int
+		// want is the champion every run must produce, or 0 when it is
+		// left to chance.
+		want int
+	}{
+		{
+			name:     "open bracket",
+			field:    []int{1, 2, 3, 4},
+			strength: map[int]float64{1: 40, 2: 35, 3: 30, 4: 25},
+		},
+		{
+			name:     "open bracket with byes",
+			field:    []int{1, 2, 3, 4, 5, 6},
+			strength: map[int]float64{1: 40, 2: 35, 3: 30, 4: 25, 5: 20, 6: 15},
+		},
+		{
+			name:     "decided games keep their winner",
+			field:    []int{1, 2, 3, 4},
+			strength: map[int]float64{1: 40, 2: 35, 3: 30, 4: 25},
+			decided:  map[[2]int]int{pairKey(1, 4): 4, pairKey(2, 3): 3, pairKey(3, 4): 3},
+			want:     3,
+		},
+		{
+			name:     "the top seed's bye takes it to the final",
+			field:    []int{1, 2, 3},
+			strength: map[int]float64{1: 10, 2: 50, 3: 50},
+			decided:  map[[2]int]int{pairKey(2, 3): 2, pairKey(1, 2): 1},
+			want:     1,
+		},
+		{
+			name:  "a lone team wins",
+			field: []int{7},
+			want:  7,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := func(seed int64) []int {
+				rng := rand.New(rand.NewSource(seed))
+				champions := make([]int, 200)
+				for i := range champions {
+					champions[i] = simulateBracket(rng, tt.field, tt.strength, tt.decided)
+				}
+				return champions
+			}
+			first := run(42)
+			if again := run(42); !reflect.DeepEqual(first, again) {
+				t.Fatalf("same seed gave different champions")
+			}
+			inField := map[int]bool{}
+			for _, id := range tt.field {
+				inField[id] = true
+			}
+			for _, id := range first {
+				if !inField[id] || (tt.want != 0 && id != tt.want) {
+					t.Fatalf("champion %d, want %d from field %v", id, tt.want, tt.field)
+				}
+			}
+		})
+	}
+}
+
+func TestOddsCacheLimit(t *testing.T) {
+	invalidateOdds()
+	t.Cleanup(func() {
+		invalidateOdds()
+		for len(oddsJobs) > 0 {
+			<-oddsJobs
+		}
+	})
+	custom := func(i int) oddsKey { return oddsKey{LeagueID: 1, Simulations: 1000, Seed: int64(i)} }
+	def := oddsKey{LeagueID: 1, Simulations: defaultOddsSimulations, Seed: 1}
+
+	oddsFor(def)
+	for i := 0; i < oddsCustomLimit; i++ {
+		oddsFor(custom(i))
+	}
+	// Using a run keeps it; the least recently used goes instead.
+	oddsFor(custom(0))
+	oddsFor(custom(oddsCustomLimit))
+
+	tests := []struct {
+		key  oddsKey
+		want bool
+	}{
+		{def, true},
+		{custom(0), true},
+		{custom(1), false},
+		{custom(2), true},
+		{custom(oddsCustomLimit), true},
+	}
+	for _, tt := range tests {
+		if _, ok := oddsCache[tt.key]; ok != tt.want {
+			t.Errorf("cached %+v = %v, want %v", tt.key, ok, tt.want)
+		}
+	}
+	if len(oddsCache) != oddsCustomLimit+1 {
+		t.Errorf("%d cached runs, want %d", len(oddsCache), oddsCustomLimit+1)
+	}
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// --- Playoffs ---
+//
+// Leagues with playoff_teams > 0 finish with a single-elimination bracket
+// over the last weeks of the season. Each round lasts
+// playoff_weeks_per_round weeks, so a six-team bracket with two-week rounds
+// takes the final six weeks. Seeds are set when the first round starts:
+// "standings" seeding uses the head-to-head record in h2h leagues and
+// total points otherwise; "points" seeding always uses total points. Division
+// winners can be seeded first (see divisions.go). When the field isn't a
+// power of two the top seeds get byes.
+//
+// A game is won by whichever team scores more over its round's weeks (see
+// lineups.go), with ties going to the better seed. Games are decided at the
+// first check after the round ends. When the championship game is decided
+// its winner is crowned; the league is completed by the lifecycle manager
+// once the season's grace period is over (see lifecycle.go).
+//
+// With playoff_consolation the best teams that missed the playoffs, up to
+// as many as made it, play a consolation bracket ending the same week.
+
+const (
+	bracketChampionship = "championship"
+	bracketConsolation  = "consolation"
+)
+
+type playoffRules struct {
+	Teams, WeeksPerRound int
+	Seeding              string
+	Consolation          bool
+}
+
+func loadPlayoffRules(q queryer, leagueID int) playoffRules {
+	var p playoffRules
+	q.QueryRow("SELECT playoff_teams, playoff_weeks_per_round, playoff_seeding, playoff_consolation FROM leagues WHERE id = ?", leagueID).
+		Scan(&p.Teams, &p.WeeksPerRound, &p.Seeding, &p.Consolation)
+	return p
+}
+
+func (p playoffRules) enabled() bool { return p.Teams >= 2 }
+
+// bracketRounds is how many rounds it takes to get n teams down to one.
+func bracketRounds(n int) int {
+	rounds := 0
+	for size := 1; size < n; size *= 2 {
+		rounds++
+	}
+	return rounds
+}
+
+func (p playoffRules) rounds() int { return bracketRounds(p.Teams) }
+
+// startWeek is the first playoff week, counting back from the season's
+// last week. It is 0 when the season has no end to count back from.
+func (p playoffRules) startWeek(r lineupRules) int {
+	last := r.lastWeek()
+	if !p.enabled() || last == 0 {
+		return 0
+	}
+	start := last - p.rounds()*p.WeeksPerRound + 1
+	if start < 1 {
+		start = 1
+	}
+	return start
+}
+
+// roundWeeks is the first and last week of a bracket round, counted so
+// every bracket's final round ends in the season's last week.
+func (p playoffRules) roundWeeks(r lineupRules, totalRounds, round int) (int, int) {
+	end := r.lastWeek() - (totalRounds-round)*p.WeeksPerRound
+	return end - p.WeeksPerRound + 1, end
+}
+
+// seedOrder lists seeds in bracket order for a bracket of the given size,
+// so that 1 and 2 can only meet in the final: 1,8,4,5,2,7,3,6 for eight.
+func seedOrder(size int) []int {
+	order := []int{1}
+	for n := 2; n <= size; n *= 2 {
+		next := make([]int, 0, n)
+		for _, s := range order {
+			next = append(next, s, n+1-s)
+		}
+		order = next
+	}
+	return order
+}
+
+// playoffSeeds ranks every team in the league for seeding.
+func playoffSeeds(leagueID int, rule, format string) []int {
+	if rule == "standings" && format == "h2h" {
+		var ids []int
+		for _, rec := range rankByRecord(leagueRecords(leagueID)) {
+			ids = append(ids, rec.TeamID)
+		}
+		return ids
+	}
+	rows, err := db.Query("SELECT id FROM teams WHERE league_id = ? ORDER BY total_points DESC, id", leagueID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// createBracket inserts the first round of a bracket for teams in seed
+// order. Byes are recorded as already-final games.
+func createBracket(tx *sql.Tx, leagueID int, bracket string, teams []int, p playoffRules, r lineupRules) {
+	rounds := bracketRounds(len(teams))
+	if rounds == 0 {
+		return
+	}
+	start, end := p.roundWeeks(r, rounds, 1)
+	for slot, pair := range firstRoundPairs(len(teams)) {
+		high, low := pair[0], pair[1]
+		if low == 0 {
+			tx.Exec(`INSERT INTO playoff_games (league_id, bracket, round, slot, start_week, end_week, team1_id, seed1, winner_team_id, status)
+				VALUES (?, ?, 1, ?, ?, ?, ?, ?, ?, 'bye')`, leagueID, bracket, slot+1, start, end, teams[high-1], high, teams[high-1])
+			continue
+		}
+		tx.Exec(`INSERT INTO playoff_games (league_id, bracket, round, slot, start_week, end_week, team1_id, team2_id, seed1, seed2)
+			VALUES (?, ?, 1, ?, ?, ?, ?, ?, ?, ?)`, leagueID, bracket, slot+1, start, end, teams[high-1], teams[low-1], high, low)
+	}
+}
+
+// firstRoundPairs lists the opening games of a bracket for n teams, as
+// pairs of seeds with the better seed first. The top seeds get byes when n
+// isn't a power of two; a bye's second seed is 0.
+func firstRoundPairs(n int) [][2]int {
+	order := seedOrder(1 << bracketRounds(n))
+	pairs := make([][2]int, 0, len(order)/2)
+	for i := 0; i+1 < len(order); i += 2 {
+		high, low := order[i], order[i+1]
+		if high > low {
+			high, low = low, high
+		}
+		if low > n {
+			low = 0
+		}
+		pairs = append(pairs, [2]int{high, low})
+	}
+	return pairs
+}
+
+// seedPlayoffs creates the opening round of each bracket.
+func seedPlayoffs(leagueID int, p playoffRules, r lineupRules) {
+	seeds := seedDivisionWinners(leagueID, playoffSeeds(leagueID, p.Seeding, r.Format))
+	if len(seeds) < 2 {
+		return
+	}
+	field := seeds
+	if len(field) > p.Teams {
+		field = seeds[:p.Teams]
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	createBracket(tx, leagueID, bracketChampionship, field, p, r)
+	if p.Consolation {
+		rest := seeds[len(field):]
+		if len(rest) > len(field) {
+			rest = rest[:len(field)]
+		}
+		if len(rest) >= 2 {
+			createBracket(tx, leagueID, bracketConsolation, rest, p, r)
+		}
+	}
+	if tx.Commit() == nil {
+		notifyLeague(leagueID, "playoffs_started", "Playoffs Have Started",
+			fmt.Sprintf("The top %d teams are in the playoff bracket", len(field)))
+		broadcastLeagueEvent(leagueID, fiber.Map{"type": "playoffs_started", "league_id": leagueID})
+	}
+}
+
+type playoffGame struct {
+	ID, Round, Slot, StartWeek, EndWeek int
+	Bracket, Status                     string
+	Team1, Team2, Seed1, Seed2          sql.NullInt64
+	Points1, Points2                    float64
+	Winner                              sql.NullInt64
+}
+
+func loadPlayoffGames(leagueID int) []playoffGame {
+	rows, err := db.Query(`SELECT id, bracket, round, slot, start_week, end_week, status,
+		team1_id, team2_id, seed1, seed2, team1_points, team2_points, winner_team_id
+		FROM playoff_games WHERE league_id = ? ORDER BY bracket, round, slot`, leagueID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var games []playoffGame
+	for rows.Next() {
+		var g playoffGame
+		rows.Scan(&g.ID, &g.Bracket, &g.Round, &g.Slot, &g.StartWeek, &g.EndWeek, &g.Status,
+			&g.Team1, &g.Team2, &g.Seed1, &g.Seed2, &g.Points1, &g.Points2, &g.Winner)
+		games = append(games, g)
+	}
+	return games
+}
+
+func teamWeeksPoints(q queryer, teamID, from, to int) float64 {
+	var pts float64
+	q.QueryRow("SELECT COALESCE(SUM(points), 0) FROM team_week_scores WHERE team_id = ? AND week BETWEEN ? AND ?", teamID, from, to).Scan(&pts)
+	return pts
+}
+
+// advancePlayoffs seeds, scores and advances a league's brackets as far as
+// the calendar allows.
+func advancePlayoffs(leagueID int) {
+	if requireActiveLeague(db, leagueID) != nil {
+		return
+	}
+	p := loadPlayoffRules(db, leagueID)
+	r, err := loadLineupRules(db, leagueID)
+	if err != nil || !p.enabled() {
+		return
+	}
+	start := p.startWeek(r)
+	current := r.currentWeek()
+	if start == 0 || current < start {
+		return
+	}
+	if len(loadPlayoffGames(leagueID)) == 0 {
+		seedPlayoffs(leagueID, p, r)
+	}
+
+	// Each pass can open the next round, which may already be over if the
+	// checks have fallen behind the calendar.
+	for pass := 0; pass <= p.rounds(); pass++ {
+		scorePlayoffGames(leagueID, current)
+		for _, bracket := range []string{bracketChampionship, bracketConsolation} {
+			advanceBracket(leagueID, bracket, p, r)
+		}
+	}
+}
+
+// scorePlayoffGames updates the points in every started game and decides
+// the ones whose round is over.
+func scorePlayoffGames(leagueID, current int) {
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	for _, g := range loadPlayoffGames(leagueID) {
+		if g.Status == "final" || g.Status == "bye" || !g.Team1.Valid || !g.Team2.Valid || current < g.StartWeek {
+			continue
+		}
+		p1 := teamWeeksPoints(tx, int(g.Team1.Int64), g.StartWeek, g.EndWeek)
+		p2 := teamWeeksPoints(tx, int(g.Team2.Int64), g.StartWeek, g.EndWeek)
+		if current <= g.EndWeek {
+			tx.Exec("UPDATE playoff_games SET team1_points = ?, team2_points = ?, status = 'in_progress' WHERE id = ?", p1, p2, g.ID)
+			continue
+		}
+		// Team 1 is always the better seed, so it keeps ties.
+		winner := g.Team1.Int64
+		if p2 > p1 {
+			winner = g.Team2.Int64
+		}
+		tx.Exec("UPDATE playoff_games SET team1_points = ?, team2_points = ?, winner_team_id = ?, status = 'final' WHERE id = ?", p1, p2, winner, g.ID)
+	}
+	tx.Commit()
+}
+
+// advanceBracket pairs a bracket's winners into the next round once every
+// game in the latest round is decided, or crowns the bracket's winner.
+func advanceBracket(leagueID int, bracket string, p playoffRules, r lineupRules) {
+	var games []playoffGame
+	latest := 0
+	for _, g := range loadPlayoffGames(leagueID) {
+		if g.Bracket != bracket {
+			continue
+		}
+		if g.Round > latest {
+			latest, games = g.Round, nil
+		}
+		if g.Round == latest {
+			games = append(games, g)
+		}
+	}
+	if len(games) == 0 {
+		return
+	}
+	for _, g := range games {
+		if !g.Winner.Valid {
+			return
+		}
+	}
+
+	if len(games) == 1 {
+		if bracket == bracketChampionship {
+			crownChampion(leagueID, int(games[0].Winner.Int64))
+		}
+		return
+	}
+
+	totalRounds := latest + bracketRounds(len(games))
+	start, end := p.roundWeeks(r, totalRounds, latest+1)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	for slot, pair := range nextRoundPairs(games) {
+		a, b := pair[0], pair[1]
+		tx.Exec(`INSERT OR IGNORE INTO playoff_games (league_id, bracket, round, slot, start_week, end_week, team1_id, team2_id, seed1, seed2)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, leagueID, bracket, latest+1, slot+1, start, end, a.Team, b.Team, a.Seed, b.Seed)
+	}
+	tx.Commit()
+}
+
+// bracketSpot is a team and the seed it entered the bracket with.
+type bracketSpot struct {
+	Team, Seed int64
+}
+
+// nextRoundPairs pairs the winners of a finished round, neighbouring slots
+// against each other, better seed first.
+func nextRoundPairs(games []playoffGame) [][2]bracketSpot {
+	var pairs [][2]bracketSpot
+	for i := 0; i+1 < len(games); i += 2 {
+		a := bracketSpot{games[i].Winner.Int64, winnerSeed(games[i])}
+		b := bracketSpot{games[i+1].Winner.Int64, winnerSeed(games[i+1])}
+		if b.Seed < a.Seed {
+			a, b = b, a
+		}
+		pairs = append(pairs, [2]bracketSpot{a, b})
+	}
+	return pairs
+}
+
+func winnerSeed(g playoffGame) int64 {
+	if g.Winner.Valid && g.Team2.Valid && g.Winner.Int64 == g.Team2.Int64 {
+		return g.Seed2.Int64
+	}
+	return g.Seed1.Int64
+}
+
+// crownChampion records the league champion.
+func crownChampion(leagueID, teamID int) {
+	res, err := db.Exec("UPDATE leagues SET champion_team_id = ? WHERE id = ? AND status = 'active' AND champion_team_id IS NULL", teamID, leagueID)
+	if err != nil {
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+	name := teamName(teamID)
+	notifyLeague(leagueID, "league_champion", "We Have a Champion",
+		fmt.Sprintf("%s won the championship", name))
+	broadcastLeagueEvent(leagueID, fiber.Map{"type": "champion_crowned", "league_id": leagueID, "champion_team_id": teamID, "champion_team_name": name})
+}
+
+// advanceAllPlayoffs runs advancePlayoffs for every active league with
+// playoffs.
+func advanceAllPlayoffs() {
+	rows, err := db.Query("SELECT id FROM leagues WHERE playoff_teams >= 2 AND status = 'active'")
+	if err != nil {
+		return
+	}
+	var leagues []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		leagues = append(leagues, id)
+	}
+	rows.Close()
+	for _, id := range leagues {
+		advancePlayoffs(id)
+	}
+}
+
+// validatePlayoffSettings makes sure the bracket fits the league.
+func validatePlayoffSettings(maxTeams int, settings map[string]interface{}) error {
+	if n, ok := settings["playoff_teams"].(int); ok && n > maxTeams {
+		return newAPIError(400, "INVALID_SETTING", fmt.Sprintf("playoff_teams can't be more than max_teams (%d)", maxTeams)).
+			with("setting", "playoff_teams")
+	}
+	if n, ok := settings["playoff_teams"].(int); ok && n == 1 {
+		return newAPIError(400, "INVALID_SETTING", "playoff_teams must be 0 (no playoffs) or at least 2").
+			with("setting", "playoff_teams")
+	}
+	return nil
+}
+
+// getPlayoffs returns a league's playoff settings, round dates and bracket.
+func getPlayoffs(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	r, err := loadLineupRules(db, leagueID)
+	if err != nil {
+		return err
+	}
+	p := loadPlayoffRules(db, leagueID)
+	if !p.enabled() {
+		return newAPIError(400, "NO_PLAYOFFS", "This league doesn't have playoffs")
+	}
+	lockLineups(leagueID)
+	advancePlayoffs(leagueID)
+
+	start := p.startWeek(r)
+	rounds := []fiber.Map{}
+	for round := 1; round <= p.rounds() && start > 0; round++ {
+		from, to := p.roundWeeks(r, p.rounds(), round)
+		rounds = append(rounds, fiber.Map{
+			"round": round, "start_week": from, "end_week": to,
+			"starts_at": r.weekStart(from).UTC().Format(time.RFC3339),
+			"ends_at":   r.weekStart(to + 1).UTC().Format(time.RFC3339),
+		})
+	}
+
+	side := func(team, seed sql.NullInt64, points float64) interface{} {
+		if !team.Valid {
+			return nil
+		}
+		return fiber.Map{"team_id": team.Int64, "team_name": teamName(int(team.Int64)), "seed": seed.Int64, "points": points}
+	}
+	brackets := fiber.Map{bracketChampionship: []fiber.Map{}}
+	if p.Consolation {
+		brackets[bracketConsolation] = []fiber.Map{}
+	}
+	for _, g := range loadPlayoffGames(leagueID) {
+		game := fiber.Map{
+			"id": g.ID, "round": g.Round, "slot": g.Slot, "status": g.Status,
+			"start_week": g.StartWeek, "end_week": g.EndWeek,
+			"starts_at":      r.weekStart(g.StartWeek).UTC().Format(time.RFC3339),
+			"ends_at":        r.weekStart(g.EndWeek + 1).UTC().Format(time.RFC3339),
+			"team1":          side(g.Team1, g.Seed1, g.Points1),
+			"team2":          side(g.Team2, g.Seed2, g.Points2),
+			"winner_team_id": nil,
+		}
+		if g.Winner.Valid {
+			game["winner_team_id"] = g.Winner.Int64
+		}
+		list, _ := brackets[g.Bracket].([]fiber.Map)
+		brackets[g.Bracket] = append(list, game)
+	}
+
+	var champion sql.NullInt64
+	db.QueryRow("SELECT champion_team_id FROM leagues WHERE id = ?", leagueID).Scan(&champion)
+	var championJSON interface{}
+	if champion.Valid {
+		championJSON = fiber.Map{"team_id": champion.Int64, "team_name": teamName(int(champion.Int64))}
+	}
+
+	return c.JSON(fiber.Map{
+		"league_id": leagueID, "playoff_teams": p.Teams, "seeding": p.Seeding,
+		"weeks_per_round": p.WeeksPerRound, "consolation": p.Consolation,
+		"start_week": start, "current_week": r.currentWeek(),
+		"rounds": rounds, "brackets": brackets, "champion": championJSON,
+	})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestFirstRoundPairs(t *testing.T) {
+	tests := []struct {
+		teams int
+		want  [][2]int
+	}{
+		{2, [][2]int{{1, 2}}},
+		{3, [][2]int{{1, 0}, {2, 3}}},
+		{4, [][2]int{{1, 4}, {2, 3}}},
+		{5, [][2]int{{1, 0}, {4, 5}, {2, 0}, {3, 0}}},
+		{6, [][2]int{{1, 0}, {4, 5}, {2, 0}, {3, 6}}},
+		{8, [][2]int{{1, 8}, {4, 5}, {2, 7}, {3, 6}}},
+	}
+	for _, tt := range tests {
+		if got := firstRoundPairs(tt.teams); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("firstRoundPairs(%d) = %v, want %v", tt.teams, got, tt.want)
+		}
+	}
+}
+
+// testGame is a decided playoff game. A team2 of 0 is a bye.
+func testGame(team1, seed1, team2, seed2, winner int64) playoffGame {
+	g := playoffGame{
+		Team1: sql.NullInt64{Int64: team1, Valid: true}, Seed1: sql.NullInt64{Int64: seed1, Valid: true},
+		Winner: sql.NullInt64{Int64: winner, Valid: true}, Status: "final",
+	}
+	if team2 == 0 {
+		g.Status = "bye"
+		return g
+	}
+	g.Team2 = sql.NullInt64{Int64: team2, Valid: true}
+	g.Seed2 = sql.NullInt64{Int64: seed2, Valid: true}
+	return g
+}
+
+func TestNextRoundPairs(t *testing.T) {
+	tests := []struct {
+		name  string
+		games []playoffGame
+		want  [][2]bracketSpot
+	}{
+		{
+			name: "bye winners meet the winners next to them",
+			games: []playoffGame{
+				testGame(11, 1, 0, 0, 11),
+				testGame(14, 4, 15, 5, 15),
+				testGame(12, 2, 0, 0, 12),
+				testGame(13, 3, 16, 6, 16),
+			},
+			want: [][2]bracketSpot{
+				{{11, 1}, {15, 5}},
+				{{12, 2}, {16, 6}},
+			},
+		},
+		{
+			name: "better remaining seed goes first",
+			games: []playoffGame{
+				testGame(11, 1, 14, 4, 14),
+				testGame(12, 2, 13, 3, 12),
+			},
+			want: [][2]bracketSpot{{{12, 2}, {14, 4}}},
+		},
+		{
+			name:  "a final has nothing to advance to",
+			games: []playoffGame{testGame(11, 1, 12, 2, 12)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextRoundPairs(tt.games); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("nextRoundPairs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdvancePlayoffsCatchesUp(t *testing.T) {
+	tests := []struct {
+		name string
+		// scores are each team's points in the first and second round.
+		scores       map[int][2]float64
+		wantChampion int64
+	}{
+		{
+			name:         "top seed wins after its bye",
+			scores:       map[int][2]float64{1: {0, 30}, 2: {10, 0}, 3: {5, 0}},
+			wantChampion: 1,
+		},
+		{
+			name:         "third seed wins through",
+			scores:       map[int][2]float64{1: {0, 15}, 2: {5, 0}, 3: {10, 20}},
+			wantChampion: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDB(t)
+			db.Exec(`INSERT INTO users (id, email, password_hash, display_name) VALUES
+				(1, 'a@example.com', 'x', 'A'), (2, 'b@example.com', 'x', 'B'), (3, 'c@example.com', 'x', 'C'), (4, 'd@example.com', 'x', 'D')`)
+			db.Exec(`INSERT INTO leagues (id, name, owner_id, season_year, max_teams, invite_code, season_start, season_end, status, playoff_teams)
+				VALUES (1, 'League', 1, 2025, 8, 'code', '2025-01-01', '2025-12-31', 'active', 3)`)
+			db.Exec(`INSERT INTO teams (id, league_id, user_id, name, total_points) VALUES
+				(1, 1, 1, 'A', 40), (2, 1, 2, 'B', 30), (3, 1, 3, 'C', 20), (4, 1, 4, 'D', 10)`)
+			r, _ := loadLineupRules(db, 1)
+			start := loadPlayoffRules(db, 1).startWeek(r)
+			for team, pts := range tt.scores {
+				db.Exec("INSERT INTO team_week_scores (team_id, week, points) VALUES (?, ?, ?), (?, ?, ?)",
+					team, start, pts[0], team, start+1, pts[1])
+			}
+
+			// The season is long over, so one check plays every round.
+			advancePlayoffs(1)
+
+			var status string
+			var champion sql.NullInt64
+			db.QueryRow("SELECT status, champion_team_id FROM leagues WHERE id = 1").Scan(&status, &champion)
+			if champion.Int64 != tt.wantChampion {
+				t.Errorf("champion %v, want %d", champion, tt.wantChampion)
+			}
+			// Crowning a champion leaves completing the league to the
+			// lifecycle manager.
+			if status != "active" {
+				t.Errorf("league status %q, want active", status)
+			}
+		})
+	}
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// --- Projections ---
+//
+// A projection model predicts a movie's opening weekend, domestic and
+// worldwide gross. Its points are then worked out with the real scoring
+// rules (calculateMoviePoints), so RT bonuses, gross thresholds and the flop
+// penalty all count. Each run stores every model's projection in
+// movie_projections, keyed by model version, with an 80% interval on
+// points. movies.projected_points is the active model's figure, which is
+// what the rest of the app reads.
+//
+// baselineModel is the original rule of thumb: worldwide = 2.5 × budget,
+// domestic = 40% of that, opening = 35% of domestic. ridgeModel is a ridge
+// regression on log worldwide gross, trained on the released movies in the
+// database; it becomes the active model once there are enough of them.
+
+// projectionZ is the normal quantile for an 80% interval.
+const projectionZ = 1.2816
+
+// movieFeatures is what a model knows about a movie before it opens.
+type movieFeatures struct {
+	ID          int
+	Budget      float64
+	ReleaseDate string
+	Genres      []string
+	Runtime     int
+	Franchise   bool
+	RTScore     float64
+}
+
+// month is the release month, or 0 when the date is unknown.
+func (f movieFeatures) month() int {
+	t, err := time.Parse("2006-01-02", f.ReleaseDate)
+	if err != nil {
+		return 0
+	}
+	return int(t.Month())
+}
+
+func (f movieFeatures) hasGenre(g string) bool {
+	for _, have := range f.Genres {
+		if strings.EqualFold(have, g) {
+			return true
+		}
+	}
+	return false
+}
+
+type grossProjection struct {
+	Opening, Domestic, Worldwide  float64
+	Points, PointsLow, PointsHigh float64
+}
+
+type projectionModel interface {
+	Name() string
+	Version() string
+	Project(f movieFeatures) grossProjection
+	// Info describes the model for GET /api/projections/model.
+	Info() fiber.Map
+}
+
+// projectGross turns a worldwide estimate into a full projection. logSD is
+// the model's typical error in log worldwide gross; the interval scales the
+// grosses by it and rescoring at each end.
+func projectGross(f movieFeatures, worldwide, domesticShare, openingShare, logSD float64) grossProjection {
+	points := func(ww float64) float64 {
+		domestic := ww * domesticShare
+		return calculateMoviePoints(movieData{
+			ID: f.ID, Budget: f.Budget, DomesticGross: domestic, WorldwideGross: ww,
+			RTScore: f.RTScore, OpeningWeekend: domestic * openingShare, Status: "released",
+		})
+	}
+	domestic := worldwide * domesticShare
+	return grossProjection{
+		Opening: domestic * openingShare, Domestic: domestic, Worldwide: worldwide,
+		Points:     points(worldwide),
+		PointsLow:  points(worldwide * math.Exp(-projectionZ*logSD)),
+		PointsHigh: points(worldwide * math.Exp(projectionZ*logSD)),
+	}
+}
+
+// --- Baseline ---
+
+// baselineLogSD is roughly how far budget × 2.5 misses in log gross.
+const baselineLogSD = 0.8
+
+type baselineModel struct{}
+
+func (baselineModel) Name() string    { return "baseline" }
+func (baselineModel) Version() string { return "baseline-1" }
+
+func (baselineModel) Project(f movieFeatures) grossProjection {
+	return projectGross(f, f.Budget*2.5, 0.4, 0.35, baselineLogSD)
+}
+
+func (m baselineModel) Info() fiber.Map {
+	return fiber.Map{"name": m.Name(), "version": m.Version(), "log_sd": baselineLogSD}
+}
+
+// --- Ridge Regression ---
+
+const (
+	// minTrainingMovies is how many released movies with grosses the
+	// regression needs before it replaces the baseline.
+	minTrainingMovies = 12
+	ridgeLambda       = 1.0
+)
+
+// projectionGenres are the TMDB genres the regression has a feature for.
+var projectionGenres = []string{"Action", "Adventure", "Animation", "Comedy", "Drama", "Family",
+	"Fantasy", "Horror", "Romance", "Science Fiction", "Thriller"}
+
+// ridgeFeatureNames labels ridgeFeatures' output, in order.
+func ridgeFeatureNames() []string {
+	names := []string{"log_budget", "no_budget", "summer", "holiday", "month_sin", "month_cos", "no_date"}
+	for _, g := range projectionGenres {
+		names = append(names, "genre_"+strings.ToLower(strings.ReplaceAll(g, " ", "_")))
+	}
+	return append(names, "runtime_hours", "no_runtime", "franchise")
+}
+
+func ridgeFeatures(f movieFeatures) []float64 {
+	flag := func(b bool) float64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	x := []float64{math.Log1p(f.Budget), flag(f.Budget <= 0)}
+	if m := f.month(); m > 0 {
+		angle := 2 * math.Pi * float64(m) / 12
+		x = append(x, flag(m >= 5 && m <= 7), flag(m >= 11), math.Sin(angle), math.Cos(angle), 0)
+	} else {
+		x = append(x, 0, 0, 0, 0, 1)
+	}
+	for _, g := range projectionGenres {
+		x = append(x, flag(f.hasGenre(g)))
+	}
+	return append(x, float64(f.Runtime)/60, flag(f.Runtime <= 0), flag(f.Franchise))
+}
+
+type ridgeModel struct {
+	version                     string
+	means, coef                 []float64
+	intercept, logSD, rmse      float64
+	domesticShare, openingShare float64
+	trainedOn                   int
+	trainedAt                   time.Time
+}
+
+func (m *ridgeModel) Name() string    { return "ridge" }
+func (m *ridgeModel) Version() string { return m.version }
+
+func (m *ridgeModel) predictLog(f movieFeatures) float64 {
+	y := m.intercept
+	for i, v := range ridgeFeatures(f) {
+		y += m.coef[i] * (v - m.means[i])
+	}
+	return y
+}
+
+func (m *ridgeModel) Project(f movieFeatures) grossProjection {
+	return projectGross(f, math.Expm1(m.predictLog(f)), m.domesticShare, m.openingShare, m.logSD)
+}
+
+func (m *ridgeModel) Info() fiber.Map {
+	coefficients := fiber.Map{}
+	for i, name := range ridgeFeatureNames() {
+		coefficients[name] = m.coef[i]
+	}
+	return fiber.Map{
+		"name": m.Name(), "version": m.version, "trained_on": m.trainedOn, "trained_at": m.trainedAt,
+		"lambda": ridgeLambda, "log_sd": m.logSD, "rmse_log_gross": m.rmse,
+		"domestic_share": m.domesticShare, "opening_share": m.openingShare, "coefficients": coefficients,
+	}
+}
+
+// trainingMovie is a released movie with the grosses it actually made.
+type trainingMovie struct {
+	movieFeatures
+	Opening, Domestic, Worldwide float64
+}
+
+// trainRidgeModel fits log(1 + worldwide gross) to ridgeFeatures over the
+// released movies in the database.
+func trainRidgeModel() (*ridgeModel, error) {
+	rows, err := db.Query(`SELECT id, budget, COALESCE(release_date, ''), genres, runtime, collection_id, rt_score,
+		opening_weekend_gross, domestic_gross, worldwide_gross FROM movies WHERE status = 'released' AND worldwide_gross > 0`)
+	if err != nil {
+		return nil, err
+	}
+	var movies []trainingMovie
+	for rows.Next() {
+		var m trainingMovie
+		var genres string
+		var collection int
+		rows.Scan(&m.ID, &m.Budget, &m.ReleaseDate, &genres, &m.Runtime, &collection, &m.RTScore, &m.Opening, &m.Domestic, &m.Worldwide)
+		m.Genres = splitGenres(genres)
+		m.Franchise = collection != 0
+		movies = append(movies, m)
+	}
+	rows.Close()
+	if len(movies) < minTrainingMovies {
+		return nil, fmt.Errorf("%d released movies with grosses, need %d to train", len(movies), minTrainingMovies)
+	}
+
+	n, k := len(movies), len(ridgeFeatureNames())
+	X := make([][]float64, n)
+	y := make([]float64, n)
+	means := make([]float64, k)
+	var yMean float64
+	for i, m := range movies {
+		X[i] = ridgeFeatures(m.movieFeatures)
+		y[i] = math.Log1p(m.Worldwide)
+		yMean += y[i] / float64(n)
+		for j, v := range X[i] {
+			means[j] += v / float64(n)
+		}
+	}
+
+	// Solve (XᵀX + λI)β = Xᵀy on centered data, which leaves the intercept
+	// unpenalized.
+	A := make([][]float64, k)
+	b := make([]float64, k)
+	for j := range A {
+		A[j] = make([]float64, k)
+		A[j][j] = ridgeLambda
+	}
+	for i := range X {
+		for j := 0; j < k; j++ {
+			xj := X[i][j] - means[j]
+			b[j] += xj * (y[i] - yMean)
+			for l := 0; l < k; l++ {
+				A[j][l] += xj * (X[i][l] - means[l])
+			}
+		}
+	}
+	coef, err := solveLinear(A, b)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &ridgeModel{means: means, coef: coef, intercept: yMean, trainedOn: n, trainedAt: time.Now().UTC()}
+	var sse float64
+	for i, tm := range movies {
+		r := y[i] - m.predictLog(tm.movieFeatures)
+		sse += r * r
+	}
+	m.rmse = math.Sqrt(sse / float64(n))
+	// In-sample error understates how far off new movies will be.
+	dof := n - k - 1
+	if dof < 1 {
+		dof = 1
+	}
+	m.logSD = math.Max(math.Sqrt(sse/float64(dof)), m.rmse)
+
+	var domesticShares, openingShares []float64
+	for _, tm := range movies {
+		if tm.Domestic > 0 && tm.Domestic < tm.Worldwide {
+			domesticShares = append(domesticShares, tm.Domestic/tm.Worldwide)
+		}
+		if tm.Opening > 0 && tm.Opening < tm.Domestic {
+			openingShares = append(openingShares, tm.Opening/tm.Domestic)
+		}
+	}
+	m.domesticShare = medianOr(domesticShares, 0.4)
+	m.openingShare = medianOr(openingShares, 0.35)
+	m.version = fmt.Sprintf("ridge-1.%s.n%d", m.trainedAt.Format("20060102"), n)
+	return m, nil
+}
+
+// solveLinear solves Ax = b by Gaussian elimination with partial pivoting.
+func solveLinear(A [][]float64, b []float64) ([]float64, error) {
+	n := len(b)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(A[r][col]) > math.Abs(A[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(A[pivot][col]) < 1e-12 {
+			return nil, errors.New("singular system")
+		}
+		A[col], A[pivot] = A[pivot], A[col]
+		b[col], b[pivot] = b[pivot], b[col]
+		for r := col + 1; r < n; r++ {
+			f := A[r][col] / A[col][col]
+			for c := col; c < n; c++ {
+				A[r][c] -= f * A[col][c]
+			}
+			b[r] -= f * b[col]
+		}
+	}
+	x := make([]float64, n)
+	for r := n - 1; r >= 0; r-- {
+		sum := b[r]
+		for c := r + 1; c < n; c++ {
+			sum -= A[r][c] * x[c]
+		}
+		x[r] = sum / A[r][r]
+	}
+	return x, nil
+}
+
+func medianOr(values []float64, fallback float64) float64 {
+	if len(values) == 0 {
+		return fallback
+	}
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
+
+func splitGenres(s string) []string {
+	var genres []string
+	for _, g := range strings.Split(s, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			genres = append(genres, g)
+		}
+	}
+	return genres
+}
+
+// --- Running Models ---
+
+var (
+	activeProjectionMu sync.RWMutex
+	activeProjection   projectionModel = baselineModel{}
+)
+
+func currentProjectionModel() projectionModel {
+	activeProjectionMu.RLock()
+	defer activeProjectionMu.RUnlock()
+	return activeProjection
+}
+
+// updateProjections retrains the regression and projects every upcoming
+// movie with each model, then re-projects released movies from their run
+// so far.
+func updateProjections() {
+	models := []projectionModel{baselineModel{}}
+	active := projectionModel(baselineModel{})
+	if ridge, err := trainRidgeModel(); err != nil {
+		log.Printf("Projections: %v; using %s", err, active.Version())
+	} else {
+		models = append(models, ridge)
+		active = ridge
+	}
+	activeProjectionMu.Lock()
+	activeProjection = active
+	activeProjectionMu.Unlock()
+
+	rows, err := db.Query(`SELECT id, budget, COALESCE(release_date, ''), genres, runtime, collection_id, rt_score
+		FROM movies WHERE status = 'upcoming'`)
+	if err != nil {
+		return
+	}
+	var movies []movieFeatures
+	for rows.Next() {
+		var f movieFeatures
+		var genres string
+		var collection int
+		rows.Scan(&f.ID, &f.Budget, &f.ReleaseDate, &genres, &f.Runtime, &collection, &f.RTScore)
+		f.Genres = splitGenres(genres)
+		f.Franchise = collection != 0
+		movies = append(movies, f)
+	}
+	rows.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	for _, f := range movies {
+		for _, m := range models {
+			p := m.Project(f)
+			tx.Exec(`INSERT OR REPLACE INTO movie_projections (movie_id, model, version, opening, domestic, worldwide, points, points_low, points_high)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				f.ID, m.Name(), m.Version(), p.Opening, p.Domestic, p.Worldwide, p.Points, p.PointsLow, p.PointsHigh)
+			if m == active {
+				tx.Exec("UPDATE movies SET projected_points = ?, projection_version = ? WHERE id = ?", p.Points, m.Version(), f.ID)
+			}
+		}
+	}
+	released := updateRunRateProjections(tx)
+	if err := tx.Commit(); err != nil {
+		log.Printf("Failed to store projections: %v", err)
+		return
+	}
+	invalidateOdds()
+	log.Printf("Projected %d upcoming movies with %s and %d released movies by run rate", len(movies), active.Version(), released)
+}
+
+// getProjectionModel describes the active projection model.
+func getProjectionModel(c *fiber.Ctx) error {
+	return c.JSON(currentProjectionModel().Info())
+}
+
+func getMovieProjection(c *fiber.Ctx) error {
+	id, _ := strconv.Atoi(c.Params("id"))
+
+	var budget, domestic, worldwide, opening, points, projPoints float64
+	var title, status, version string
+	err := db.QueryRow("SELECT title, budget, domestic_gross, worldwide_gross, opening_weekend_gross, points, projected_points, status, projection_version FROM movies WHERE id = ?", id).
+		Scan(&title, &budget, &domestic, &worldwide, &opening, &points, &projPoints, &status, &version)
+	if err != nil {
+		return fiber.NewError(404, "Movie not found")
+	}
+
+	rows, err := db.Query(`SELECT model, version, opening, domestic, worldwide, points, points_low, points_high, created_at
+		FROM movie_projections WHERE movie_id = ? ORDER BY created_at DESC, id DESC LIMIT 20`, id)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	defer rows.Close()
+	projections := []fiber.Map{}
+	var current fiber.Map
+	for rows.Next() {
+		var model, v string
+		var pOpening, pDomestic, pWorldwide, pPoints, low, high float64
+		var createdAt time.Time
+		rows.Scan(&model, &v, &pOpening, &pDomestic, &pWorldwide, &pPoints, &low, &high, &createdAt)
+		p := fiber.Map{
+			"model": model, "model_version": v, "projected_opening": pOpening, "projected_domestic": pDomestic,
+			"projected_worldwide": pWorldwide, "projected_points": pPoints, "projected_points_low": low,
+			"projected_points_high": high, "created_at": createdAt,
+		}
+		if v == version && current == nil {
+			current = p
+		}
+		projections = append(projections, p)
+	}
+
+	resp := fiber.Map{
+		"movie_id":         id,
+		"title":            title,
+		"status":           status,
+		"current_points":   points,
+		"projected_points": projPoints,
+		"budget":           budget,
+		"actual_domestic":  domestic,
+		"actual_worldwide": worldwide,
+		"actual_opening":   opening,
+		"remaining_points": math.Max(projPoints-points, 0),
+		"model":            nil,
+		"model_version":    nil,
+		"run_rate":         nil,
+		"projections":      projections,
+	}
+	if status == "released" {
+		if rr := runRateSummary(id); rr != nil {
+			resp["run_rate"] = rr
+		}
+	}
+	if current == nil {
+		// Not projected yet; show what the active model makes of it.
+		var genres string
+		var collection int
+		f := movieFeatures{ID: id, Budget: budget}
+		db.QueryRow("SELECT COALESCE(release_date, ''), genres, runtime, collection_id, rt_score FROM movies WHERE id = ?", id).
+			Scan(&f.ReleaseDate, &genres, &f.Runtime, &collection, &f.RTScore)
+		f.Genres, f.Franchise = splitGenres(genres), collection != 0
+		m := currentProjectionModel()
+		p := m.Project(f)
+		current = fiber.Map{
+			"model": m.Name(), "model_version": m.Version(), "projected_opening": p.Opening, "projected_domestic": p.Domestic,
+			"projected_worldwide": p.Worldwide, "projected_points_low": p.PointsLow, "projected_points_high": p.PointsHigh,
+		}
+	}
+	for _, key := range []string{"model", "model_version", "projected_opening", "projected_domestic", "projected_worldwide",
+		"projected_points_low", "projected_points_high"} {
+		resp[key] = current[key]
+	}
+	return c.JSON(resp)
+}
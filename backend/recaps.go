@@ -0,0 +1,575 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// --- Power Rankings & Weekly Recaps ---
+//
+// Power rankings weigh three things: points so far, projected rest-of-season
+// points (what the roster's movies are still expected to earn) and momentum
+// (points in the latest week, with the week before counting half as much).
+// Each is scaled against the league's best, and the power score is 40% points,
+// 40% rest of season and 20% momentum, out of 100.
+//
+// Once a week has ended, the recap job writes a weekly_recap article for it:
+// the power rankings with movement since last week's recap, the week's top
+// movie, biggest bust (the rostered movie whose projection fell furthest
+// over the week), best waiver pickup and biggest trade winner. Articles are
+// stored in league_articles and a short digest is posted to league chat by
+// the league bot, a system user nobody can log in as.
+
+const articleWeeklyRecap = "weekly_recap"
+
+const (
+	errArticleNotFound = "ARTICLE_NOT_FOUND"
+	errNoCompletedWeek = "NO_COMPLETED_WEEK"
+)
+
+const (
+	powerWeightPoints   = 0.4
+	powerWeightRest     = 0.4
+	powerWeightMomentum = 0.2
+)
+
+type powerRanking struct {
+	Rank         int     `json:"rank"`
+	TeamID       int     `json:"team_id"`
+	TeamName     string  `json:"team_name"`
+	Score        float64 `json:"score"`
+	Points       float64 `json:"total_points"`
+	RestOfSeason float64 `json:"rest_of_season_points"`
+	Momentum     float64 `json:"momentum"`
+	WeekPoints   float64 `json:"week_points"`
+	// Change is how many places the team moved since the previous recap;
+	// nil when there isn't one.
+	Change *int `json:"change"`
+}
+
+// recapWindow is the span of one league week as UTC days (for
+// movie_daily_stats) and timestamps (for created_at columns).
+type recapWindow struct {
+	Week           int
+	FromDay, ToDay string
+	From, To       string
+}
+
+func weekWindow(r lineupRules, week int) recapWindow {
+	from, to := r.weekStart(week).UTC(), r.weekStart(week+1).UTC()
+	return recapWindow{
+		Week: week, FromDay: from.Format("2006-01-02"), ToDay: to.Format("2006-01-02"),
+		From: from.Format("2006-01-02 15:04:05"), To: to.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// teamWeekPoints is what a team scored in a week: its week score in leagues
+// that keep them, otherwise what its current roster earned.
+func teamWeekPoints(r lineupRules, teamID, week int) float64 {
+	if week < 1 {
+		return 0
+	}
+	if r.weekly() {
+		return teamWeeksPoints(db, teamID, week, week)
+	}
+	w := weekWindow(r, week)
+	pts := 0.0
+	for _, id := range rosterMovieIDs(db, teamID) {
+		pts += movieWeekPoints(db, id, w.FromDay, w.ToDay)
+	}
+	return pts
+}
+
+// computePowerRankings ranks a league's teams as of the end of week.
+func computePowerRankings(leagueID int, r lineupRules, week int) []powerRanking {
+	rows, err := db.Query(`SELECT t.id, t.name, t.total_points,
+		COALESCE(SUM(MAX(m.projected_points - m.points, 0)), 0)
+		FROM teams t LEFT JOIN roster ro ON ro.team_id = t.id LEFT JOIN movies m ON m.id = ro.movie_id
+		WHERE t.league_id = ? GROUP BY t.id ORDER BY t.id`, leagueID)
+	if err != nil {
+		return []powerRanking{}
+	}
+	rankings := []powerRanking{}
+	for rows.Next() {
+		var p powerRanking
+		rows.Scan(&p.TeamID, &p.TeamName, &p.Points, &p.RestOfSeason)
+		rankings = append(rankings, p)
+	}
+	rows.Close()
+
+	var maxPoints, maxRest, maxMomentum float64
+	for i := range rankings {
+		p := &rankings[i]
+		p.WeekPoints = teamWeekPoints(r, p.TeamID, week)
+		p.Momentum = p.WeekPoints + teamWeekPoints(r, p.TeamID, week-1)/2
+		maxPoints = math.Max(maxPoints, p.Points)
+		maxRest = math.Max(maxRest, p.RestOfSeason)
+		maxMomentum = math.Max(maxMomentum, p.Momentum)
+	}
+	share := func(v, max float64) float64 {
+		if max <= 0 || v <= 0 {
+			return 0
+		}
+		return v / max
+	}
+	for i := range rankings {
+		p := &rankings[i]
+		score := powerWeightPoints*share(p.Points, maxPoints) + powerWeightRest*share(p.RestOfSeason, maxRest) +
+			powerWeightMomentum*share(p.Momentum, maxMomentum)
+		p.Score = math.Round(score*1000) / 10
+	}
+	sort.SliceStable(rankings, func(i, j int) bool {
+		if rankings[i].Score != rankings[j].Score {
+			return rankings[i].Score > rankings[j].Score
+		}
+		return rankings[i].TeamID < rankings[j].TeamID
+	})
+
+	previous := previousRecapRanks(leagueID, week)
+	for i := range rankings {
+		p := &rankings[i]
+		p.Rank = i + 1
+		if old, ok := previous[p.TeamID]; ok {
+			change := old - p.Rank
+			p.Change = &change
+		}
+	}
+	return rankings
+}
+
+// previousRecapRanks is each team's power rank in the last recap before
+// week.
+func previousRecapRanks(leagueID, week int) map[int]int {
+	ranks := map[int]int{}
+	var data string
+	if db.QueryRow("SELECT data FROM league_articles WHERE league_id = ? AND kind = ? AND week < ? ORDER BY week DESC LIMIT 1",
+		leagueID, articleWeeklyRecap, week).Scan(&data) != nil {
+		return ranks
+	}
+	var recap struct {
+		PowerRankings []powerRanking `json:"power_rankings"`
+	}
+	json.Unmarshal([]byte(data), &recap)
+	for _, p := range recap.PowerRankings {
+		ranks[p.TeamID] = p.Rank
+	}
+	return ranks
+}
+
+// --- Highlights ---
+
+type rosteredMovie struct {
+	MovieID, TeamID int
+	Title, TeamName string
+}
+
+func leagueRosteredMovies(leagueID int) []rosteredMovie {
+	rows, err := db.Query(`SELECT m.id, m.title, t.id, t.name FROM roster r
+		JOIN teams t ON t.id = r.team_id JOIN movies m ON m.id = r.movie_id
+		WHERE t.league_id = ? ORDER BY m.id`, leagueID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var movies []rosteredMovie
+	for rows.Next() {
+		var m rosteredMovie
+		rows.Scan(&m.MovieID, &m.Title, &m.TeamID, &m.TeamName)
+		movies = append(movies, m)
+	}
+	return movies
+}
+
+// topMovie is the rostered movie that earned the most in the week.
+func topMovie(movies []rosteredMovie, w recapWindow) fiber.Map {
+	var best fiber.Map
+	bestPts := 0.0
+	for _, m := range movies {
+		if pts := movieWeekPoints(db, m.MovieID, w.FromDay, w.ToDay); pts > bestPts {
+			bestPts = pts
+			best = fiber.Map{"movie_id": m.MovieID, "title": m.Title, "team_id": m.TeamID, "team_name": m.TeamName, "points": pts}
+		}
+	}
+	return best
+}
+
+// biggestBust is the rostered movie whose projection dropped the most over
+// the week.
+func biggestBust(movies []rosteredMovie, w recapWindow) fiber.Map {
+	var worst fiber.Map
+	worstDrop := 0.0
+	// Baseline rows are written alongside the active model's; skip them
+	// when there is anything else from the same run.
+	const latest = `SELECT points FROM movie_projections WHERE movie_id = ? AND created_at < ?
+		ORDER BY created_at DESC, model = 'baseline', id DESC LIMIT 1`
+	for _, m := range movies {
+		var before, after float64
+		if db.QueryRow(latest,
+			m.MovieID, w.From).Scan(&before) != nil {
+			continue
+		}
+		if db.QueryRow(latest,
+			m.MovieID, w.To).Scan(&after) != nil {
+			continue
+		}
+		if drop := before - after; drop > worstDrop {
+			worstDrop = drop
+			worst = fiber.Map{
+				"movie_id": m.MovieID, "title": m.Title, "team_id": m.TeamID, "team_name": m.TeamName,
+				"projected_before": before, "projected_after": after, "drop": drop,
+			}
+		}
+	}
+	return worst
+}
+
+// bestWaiverPickup is the week's waiver claim worth the most, counting
+// points earned and still expected.
+func bestWaiverPickup(leagueID int, w recapWindow) fiber.Map {
+	rows, err := db.Query(`SELECT tx.team_id, t.name, tx.movie_id FROM transactions tx JOIN teams t ON t.id = tx.team_id
+		WHERE tx.league_id = ? AND tx.type = 'waiver' AND tx.created_at >= ? AND tx.created_at < ?`, leagueID, w.From, w.To)
+	if err != nil {
+		return nil
+	}
+	type pickup struct {
+		TeamID, MovieID int
+		TeamName        string
+	}
+	var pickups []pickup
+	for rows.Next() {
+		var p pickup
+		rows.Scan(&p.TeamID, &p.TeamName, &p.MovieID)
+		pickups = append(pickups, p)
+	}
+	rows.Close()
+
+	var best fiber.Map
+	bestValue := math.Inf(-1)
+	for _, p := range pickups {
+		m := loadAnalyzedMovie(p.MovieID)
+		if v := m.value(); v > bestValue {
+			bestValue = v
+			best = fiber.Map{
+				"movie_id": m.ID, "title": m.Title, "team_id": p.TeamID, "team_name": p.TeamName,
+				"points": m.Points, "remaining_points": m.Remaining, "value": v,
+			}
+		}
+	}
+	return best
+}
+
+// biggestTradeWinner is the team that came out furthest ahead in a trade
+// completed during the week, by the value of what changed hands.
+func biggestTradeWinner(leagueID int, w recapWindow) fiber.Map {
+	rows, err := db.Query(`SELECT DISTINCT tx.trade_id FROM transactions tx JOIN trades tr ON tr.id = tx.trade_id
+		WHERE tx.league_id = ? AND tx.type = 'trade' AND tr.status = 'accepted' AND tx.created_at >= ? AND tx.created_at < ?`,
+		leagueID, w.From, w.To)
+	if err != nil {
+		return nil
+	}
+	var tradeIDs []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		tradeIDs = append(tradeIDs, id)
+	}
+	rows.Close()
+
+	var best fiber.Map
+	bestNet := 0.0
+	for _, tradeID := range tradeIDs {
+		items, err := db.Query("SELECT team_id, to_team_id, movie_id FROM trade_items WHERE trade_id = ?", tradeID)
+		if err != nil {
+			continue
+		}
+		net := map[int]float64{}
+		received := map[int][]string{}
+		given := map[int][]string{}
+		for items.Next() {
+			var from, movieID int
+			var to sql.NullInt64
+			items.Scan(&from, &to, &movieID)
+			if !to.Valid {
+				continue
+			}
+			m := loadAnalyzedMovie(movieID)
+			net[int(to.Int64)] += m.value()
+			net[from] -= m.value()
+			received[int(to.Int64)] = append(received[int(to.Int64)], m.Title)
+			given[from] = append(given[from], m.Title)
+		}
+		items.Close()
+		for teamID, v := range net {
+			if v > bestNet {
+				bestNet = v
+				best = fiber.Map{
+					"trade_id": tradeID, "team_id": teamID, "team_name": teamName(teamID), "net_value": v,
+					"received": stringsOrEmpty(received[teamID]), "given": stringsOrEmpty(given[teamID]),
+				}
+			}
+		}
+	}
+	return best
+}
+
+func stringsOrEmpty(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// --- Articles ---
+
+// buildWeeklyRecap gathers a week's recap and writes it up.
+func buildWeeklyRecap(leagueID int, r lineupRules, week int) (title, body, digest string, data fiber.Map) {
+	w := weekWindow(r, week)
+	rankings := computePowerRankings(leagueID, r, week)
+	movies := leagueRosteredMovies(leagueID)
+	top, bust := topMovie(movies, w), biggestBust(movies, w)
+	pickup, trade := bestWaiverPickup(leagueID, w), biggestTradeWinner(leagueID, w)
+
+	title = fmt.Sprintf("Week %d Recap", week)
+	var b strings.Builder
+	b.WriteString("Power Rankings\n")
+	for _, p := range rankings {
+		move := ""
+		if p.Change != nil && *p.Change != 0 {
+			move = fmt.Sprintf(" (%+d)", *p.Change)
+		}
+		fmt.Fprintf(&b, "%d. %s%s: %.1f (%.1f pts, %.1f to come, %.1f this week)\n",
+			p.Rank, p.TeamName, move, p.Score, p.Points, p.RestOfSeason, p.WeekPoints)
+	}
+	b.WriteString("\n")
+	if top != nil {
+		fmt.Fprintf(&b, "Movie of the Week: %s earned %.1f points for %s.\n", top["title"], top["points"], top["team_name"])
+	}
+	if bust != nil {
+		fmt.Fprintf(&b, "Biggest Bust: %s's projection fell %.1f points to %.1f, bad news for %s.\n",
+			bust["title"], bust["drop"], bust["projected_after"], bust["team_name"])
+	}
+	if pickup != nil {
+		fmt.Fprintf(&b, "Best Waiver Pickup: %s grabbed %s, worth %.1f points.\n", pickup["team_name"], pickup["title"], pickup["value"])
+	}
+	if trade != nil {
+		fmt.Fprintf(&b, "Trade of the Week: %s won its deal for %s by %.1f points.\n",
+			trade["team_name"], strings.Join(trade["received"].([]string), ", "), trade["net_value"])
+	}
+	if top == nil && bust == nil && pickup == nil && trade == nil {
+		b.WriteString("A quiet week at the box office.\n")
+	}
+
+	digest = title + " is out."
+	if len(rankings) > 0 {
+		digest += fmt.Sprintf(" %s tops the power rankings.", rankings[0].TeamName)
+	}
+	if top != nil {
+		digest += fmt.Sprintf(" Movie of the week: %s (%.1f pts).", top["title"], top["points"])
+	}
+
+	data = fiber.Map{
+		"week": week, "starts_at": r.weekStart(week).UTC().Format(time.RFC3339), "ends_at": r.weekStart(week + 1).UTC().Format(time.RFC3339),
+		"power_rankings": rankings, "top_movie": top, "biggest_bust": bust, "best_waiver_pickup": pickup, "biggest_trade_winner": trade,
+	}
+	return title, strings.TrimRight(b.String(), "\n"), digest, data
+}
+
+// publishWeeklyRecap writes (or rewrites) a week's recap. The chat digest
+// and notifications only go out the first time.
+func publishWeeklyRecap(leagueID, week int) (int64, error) {
+	r, err := loadLineupRules(db, leagueID)
+	if err != nil {
+		return 0, err
+	}
+	title, body, digest, data := buildWeeklyRecap(leagueID, r, week)
+	encoded, _ := json.Marshal(data)
+
+	var existing int64
+	db.QueryRow("SELECT id FROM league_articles WHERE league_id = ? AND kind = ? AND week = ?", leagueID, articleWeeklyRecap, week).Scan(&existing)
+	if existing != 0 {
+		_, err := db.Exec("UPDATE league_articles SET title = ?, body = ?, data = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+			title, body, string(encoded), existing)
+		return existing, err
+	}
+	res, err := db.Exec("INSERT INTO league_articles (league_id, kind, week, title, body, data) VALUES (?, ?, ?, ?, ?, ?)",
+		leagueID, articleWeeklyRecap, week, title, body, string(encoded))
+	if err != nil {
+		return 0, err
+	}
+	id, _ := res.LastInsertId()
+	postBotMessage(leagueID, digest)
+	notifyLeague(leagueID, "weekly_recap", title, digest)
+	broadcastLeagueEvent(leagueID, fiber.Map{"type": "article_published", "league_id": leagueID, "article_id": id, "title": title})
+	return id, nil
+}
+
+// leagueBot returns the system user that posts recaps to chat, creating it
+// the first time.
+func leagueBot() (int, string, error) {
+	const email, name = "league-bot@system.invalid", "Box Office Bot"
+	// "!" is never a valid bcrypt hash, so nobody can log in as it.
+	if _, err := db.Exec("INSERT OR IGNORE INTO users (email, password_hash, display_name, is_system) VALUES (?, '!', ?, 1)", email, name); err != nil {
+		return 0, "", err
+	}
+	var id int
+	err := db.QueryRow("SELECT id FROM users WHERE email = ?", email).Scan(&id)
+	return id, name, err
+}
+
+func postBotMessage(leagueID int, message string) {
+	botID, name, err := leagueBot()
+	if err != nil {
+		log.Printf("League bot unavailable: %v", err)
+		return
+	}
+	res, err := db.Exec("INSERT INTO league_messages (league_id, user_id, message) VALUES (?, ?, ?)", leagueID, botID, message)
+	if err != nil {
+		return
+	}
+	msgID, _ := res.LastInsertId()
+	broadcastChat(leagueID, fiber.Map{
+		"type": "chat", "id": msgID, "league_id": leagueID, "user_id": botID,
+		"message": message, "display_name": name, "created_at": time.Now().Format(time.RFC3339),
+	})
+}
+
+// runWeeklyRecaps publishes the recap for each active league's last
+// finished week, if it hasn't been written yet.
+func runWeeklyRecaps(now time.Time) {
+	rows, err := db.Query("SELECT id FROM leagues WHERE status = 'active'")
+	if err != nil {
+		return
+	}
+	var leagues []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		leagues = append(leagues, id)
+	}
+	rows.Close()
+	for _, id := range leagues {
+		r, err := loadLineupRules(db, id)
+		if err != nil {
+			continue
+		}
+		week := r.weekAt(now) - 1
+		if week < 1 {
+			continue
+		}
+		var exists int
+		db.QueryRow("SELECT COUNT(*) FROM league_articles WHERE league_id = ? AND kind = ? AND week = ?", id, articleWeeklyRecap, week).Scan(&exists)
+		if exists > 0 {
+			continue
+		}
+		if _, err := publishWeeklyRecap(id, week); err != nil {
+			log.Printf("Weekly recap for league %d week %d failed: %v", id, week, err)
+		}
+	}
+}
+
+func scheduledRecaps() {
+	ticker := time.NewTicker(15 * time.Minute)
+	defer ticker.Stop()
+	for {
+		<-ticker.C
+		runWeeklyRecaps(time.Now())
+	}
+}
+
+// --- Handlers ---
+
+func getPowerRankings(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	r, err := loadLineupRules(db, leagueID)
+	if err != nil {
+		return err
+	}
+	week := r.currentWeek()
+	return c.JSON(fiber.Map{"league_id": leagueID, "week": week, "power_rankings": computePowerRankings(leagueID, r, week)})
+}
+
+func articleJSON(id, leagueID, week int, kind, title, body, data string, createdAt, updatedAt time.Time) fiber.Map {
+	var decoded interface{}
+	json.Unmarshal([]byte(data), &decoded)
+	return fiber.Map{
+		"id": id, "league_id": leagueID, "kind": kind, "week": week, "title": title,
+		"body": body, "data": decoded, "created_at": createdAt, "updated_at": updatedAt,
+	}
+}
+
+// getLeagueArticles lists a league's articles, newest first. Bodies are
+// left out; ?kind= filters by kind.
+func getLeagueArticles(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	query := "SELECT id, kind, week, title, created_at FROM league_articles WHERE league_id = ?"
+	args := []interface{}{leagueID}
+	if kind := c.Query("kind"); kind != "" {
+		query += " AND kind = ?"
+		args = append(args, kind)
+	}
+	rows, err := db.Query(query+" ORDER BY week DESC, id DESC", args...)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	defer rows.Close()
+	articles := []fiber.Map{}
+	for rows.Next() {
+		var id, week int
+		var kind, title string
+		var createdAt time.Time
+		rows.Scan(&id, &kind, &week, &title, &createdAt)
+		articles = append(articles, fiber.Map{"id": id, "league_id": leagueID, "kind": kind, "week": week, "title": title, "created_at": createdAt})
+	}
+	return c.JSON(articles)
+}
+
+func getLeagueArticle(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	articleID, _ := strconv.Atoi(c.Params("articleId"))
+	var week int
+	var kind, title, body, data string
+	var createdAt, updatedAt time.Time
+	err := db.QueryRow("SELECT kind, week, title, body, data, created_at, updated_at FROM league_articles WHERE id = ? AND league_id = ?", articleID, leagueID).
+		Scan(&kind, &week, &title, &body, &data, &createdAt, &updatedAt)
+	if err != nil {
+		return newAPIError(404, errArticleNotFound, "Article not found")
+	}
+	return c.JSON(articleJSON(articleID, leagueID, week, kind, title, body, data, createdAt, updatedAt))
+}
+
+// publishRecapNow lets a commissioner write the recap for the last finished
+// week (or ?week=) without waiting for the job, rewriting it if it exists.
+func publishRecapNow(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	if _, err := requireCommissioner(c, leagueID); err != nil {
+		return err
+	}
+	r, err := loadLineupRules(db, leagueID)
+	if err != nil {
+		return err
+	}
+	last := r.currentWeek() - 1
+	week := c.QueryInt("week", last)
+	if week < 1 || week > last {
+		return newAPIError(400, errNoCompletedWeek, "There is no finished week to recap").
+			with("week", week).with("last_finished_week", last)
+	}
+	id, err := publishWeeklyRecap(leagueID, week)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	var kind, title, body, data string
+	var createdAt, updatedAt time.Time
+	db.QueryRow("SELECT kind, title, body, data, created_at, updated_at FROM league_articles WHERE id = ?", id).
+		Scan(&kind, &title, &body, &data, &createdAt, &updatedAt)
+	return c.Status(201).JSON(articleJSON(int(id), leagueID, week, kind, title, body, data, createdAt, updatedAt))
+}
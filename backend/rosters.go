@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// --- Roster Rules ---
+//
+// A team may hold at most max_roster_size movies; 0 means the league's
+// draft_rounds. Leagues can also split the roster into typed slots:
+// "summer" slots take movies released May through August, "awards" slots
+// take October through December releases, and "flex" slots take anything.
+// When any slot count is set the roster must fit the slots as well.
+//
+// Rosters that were already over a limit when it was introduced are left
+// alone; only changes that make things worse are rejected.
+
+const (
+	errRosterFull            = "ROSTER_FULL"
+	errRosterSlotUnavailable = "ROSTER_SLOT_UNAVAILABLE"
+	errRosterForbidden       = "ROSTER_FORBIDDEN"
+)
+
+type rosterRules struct {
+	MaxSize                             int
+	SummerSlots, AwardsSlots, FlexSlots int
+}
+
+func loadRosterRules(q queryer, leagueID int) rosterRules {
+	var r rosterRules
+	var draftRounds int
+	q.QueryRow("SELECT max_roster_size, draft_rounds, summer_slots, awards_slots, flex_slots FROM leagues WHERE id = ?", leagueID).
+		Scan(&r.MaxSize, &draftRounds, &r.SummerSlots, &r.AwardsSlots, &r.FlexSlots)
+	if r.MaxSize == 0 {
+		r.MaxSize = draftRounds
+	}
+	return r
+}
+
+func (r rosterRules) typed() bool {
+	return r.SummerSlots+r.AwardsSlots+r.FlexSlots > 0
+}
+
+// slotType is the typed slot a movie's release date qualifies it for, or ""
+// if it can only go in a flex slot.
+func slotType(releaseDate string) string {
+	if len(releaseDate) < 7 {
+		return ""
+	}
+	switch releaseDate[5:7] {
+	case "05", "06", "07", "08":
+		return "summer"
+	case "10", "11", "12":
+		return "awards"
+	}
+	return ""
+}
+
+// assignSlots places each movie in a slot, filling its own slot type before
+// flex. Movies that don't fit are reported as overflow.
+func (r rosterRules) assignSlots(movieIDs []int, releaseDates map[int]string) (slots map[int]string, overflow int) {
+	slots = make(map[int]string)
+	if !r.typed() {
+		return slots, 0
+	}
+	free := map[string]int{"summer": r.SummerSlots, "awards": r.AwardsSlots, "flex": r.FlexSlots}
+	var rest []int
+	for _, id := range movieIDs {
+		if t := slotType(releaseDates[id]); t != "" && free[t] > 0 {
+			free[t]--
+			slots[id] = t
+		} else {
+			rest = append(rest, id)
+		}
+	}
+	for _, id := range rest {
+		if free["flex"] > 0 {
+			free["flex"]--
+			slots[id] = "flex"
+		} else {
+			overflow++
+		}
+	}
+	return slots, overflow
+}
+
+func rosterMovieIDs(q queryer, teamID int) []int {
+	rows, err := q.Query("SELECT movie_id FROM roster WHERE team_id = ? ORDER BY acquired_at, id", teamID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func releaseDates(q queryer, movieIDs []int) map[int]string {
+	dates := make(map[int]string, len(movieIDs))
+	for _, id := range movieIDs {
+		var d string
+		q.QueryRow("SELECT COALESCE(release_date, '') FROM movies WHERE id = ?", id).Scan(&d)
+		dates[id] = d
+	}
+	return dates
+}
+
+// checkRosterChange reports whether a team can add and remove the given
+// movies without breaking its league's roster rules.
+func checkRosterChange(q queryer, teamID int, add, remove []int) error {
+	var leagueID int
+	q.QueryRow("SELECT league_id FROM teams WHERE id = ?", teamID).Scan(&leagueID)
+	rules := loadRosterRules(q, leagueID)
+
+	current := rosterMovieIDs(q, teamID)
+	removed := make(map[int]bool)
+	for _, id := range remove {
+		removed[id] = true
+	}
+	var next []int
+	for _, id := range current {
+		if !removed[id] {
+			next = append(next, id)
+		}
+	}
+	next = append(next, add...)
+
+	if rules.MaxSize > 0 && len(next) > rules.MaxSize && len(next) > len(current) {
+		return newAPIError(409, errRosterFull, "Roster is full").
+			with("team_id", teamID).with("max_roster_size", rules.MaxSize)
+	}
+	if rules.typed() {
+		dates := releaseDates(q, append(append([]int{}, current...), add...))
+		_, before := rules.assignSlots(current, dates)
+		_, after := rules.assignSlots(next, dates)
+		if after > 0 && after > before {
+			return newAPIError(409, errRosterSlotUnavailable, "No open roster slot for this movie").
+				with("team_id", teamID).with("summer_slots", rules.SummerSlots).
+				with("awards_slots", rules.AwardsSlots).with("flex_slots", rules.FlexSlots)
+		}
+	}
+	return nil
+}
+
+// validateRosterSettings makes sure a league's roster can hold a full draft.
+func validateRosterSettings(draftRounds int, settings map[string]interface{}) error {
+	if n, ok := settings["max_roster_size"].(int); ok && n > 0 && n < draftRounds {
+		return newAPIError(400, "INVALID_SETTING", fmt.Sprintf("max_roster_size must be at least draft_rounds (%d)", draftRounds)).
+			with("setting", "max_roster_size")
+	}
+	slots := 0
+	for _, key := range []string{"summer_slots", "awards_slots", "flex_slots"} {
+		n, _ := settings[key].(int)
+		slots += n
+	}
+	if slots > 0 && slots < draftRounds {
+		return newAPIError(400, "INVALID_SETTING", fmt.Sprintf("Roster slots must add up to at least draft_rounds (%d)", draftRounds)).
+			with("setting", "flex_slots")
+	}
+	return nil
+}
+
+// dropMovie releases a movie from a team's roster onto waivers.
+func dropMovie(c *fiber.Ctx) error {
+	teamID, _ := strconv.Atoi(c.Params("id"))
+	movieID, _ := strconv.Atoi(c.Params("movieId"))
+	userID := getUserID(c)
+
+	var leagueID, ownerID int
+	if err := db.QueryRow("SELECT league_id, user_id FROM teams WHERE id = ?", teamID).Scan(&leagueID, &ownerID); err != nil {
+		return newAPIError(404, errTeamNotFound, "Team not found")
+	}
+	// Commissioners can drop from any team, outside the usual windows.
+	byCommissioner := ownerID != userID
+	if byCommissioner && !isCommissioner(leagueID, userID) {
+		return newAPIError(403, errRosterForbidden, "You can only drop movies from your own team")
+	}
+	if err := requireActiveLeague(db, leagueID); err != nil {
+		return err
+	}
+	if !byCommissioner {
+		if err := requireTransactionWindow(leagueID, "drop"); err != nil {
+			return err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	res, _ := tx.Exec("DELETE FROM roster WHERE team_id = ? AND movie_id = ?", teamID, movieID)
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return newAPIError(404, errMovieNotOwned, "Movie is not on this roster").with("movie_id", movieID)
+	}
+	txnType := "drop"
+	if byCommissioner {
+		txnType = "commissioner_drop"
+		var title string
+		tx.QueryRow("SELECT title FROM movies WHERE id = ?", movieID).Scan(&title)
+		logLeagueAction(tx, leagueID, userID, "roster_drop", teamID, fmt.Sprintf("%s was dropped from %s", title, teamName(teamID)))
+	}
+	tx.Exec("INSERT INTO transactions (league_id, team_id, movie_id, type) VALUES (?, ?, ?, ?)", leagueID, teamID, movieID, txnType)
+	putOnWaivers(tx, leagueID, teamID, movieID)
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	if byCommissioner {
+		createNotification(ownerID, "roster_changed", "Roster Changed", "The commissioner dropped a movie from your roster.", leagueID)
+	}
+
+	// Open trades that move this movie can't go through any more.
+	invalidated := invalidateConflictingTrades(leagueID, 0, []tradeItem{{FromTeamID: teamID, MovieID: movieID}})
+
+	out := fiber.Map{"message": "Movie dropped", "movie_id": movieID, "waiver_until": nil, "invalidated_trades": invalidated}
+	if until, ok := onWaiversUntil(db, leagueID, movieID); ok {
+		out["waiver_until"] = until.UTC().Format(time.RFC3339)
+	}
+	broadcastLeagueEvent(leagueID, fiber.Map{"type": "drop", "league_id": leagueID, "team_id": teamID, "movie_id": movieID})
+	return c.JSON(out)
+}
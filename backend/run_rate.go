@@ -0,0 +1,259 @@
+package main
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// --- Run-Rate Projections ---
+//
+// Once a movie is in theaters, its own grosses say more than any pre-release
+// model. The run-rate projection takes the last week's domestic gross from
+// movie_daily_stats and assumes each later week keeps a fixed share of the
+// one before (the retention), until the theatrical run ends. The retention
+// starts from a prior for the movie's genres, release window and RT score,
+// and is pulled toward the week-over-week holds the movie has actually
+// shown. Worldwide keeps the movie's current worldwide/domestic ratio.
+
+const (
+	// theatricalRunDays is how long a run is projected to last.
+	theatricalRunDays = 112
+	minRetention      = 0.15
+	maxRetention      = 0.9
+	// defaultRetention is the week-over-week hold for genres not listed.
+	defaultRetention = 0.55
+)
+
+// genreRetention is the typical share of last week's gross a movie keeps.
+// Horror is front-loaded; family films have long legs.
+var genreRetention = map[string]float64{
+	"Horror":          0.40,
+	"Thriller":        0.48,
+	"Action":          0.50,
+	"Science Fiction": 0.50,
+	"Adventure":       0.53,
+	"Fantasy":         0.53,
+	"Comedy":          0.55,
+	"Romance":         0.57,
+	"Drama":           0.60,
+	"Animation":       0.65,
+	"Family":          0.65,
+}
+
+// runRateInputs is what a run-rate projection works from.
+type runRateInputs struct {
+	movieFeatures
+	Opening, Domestic, Worldwide float64
+}
+
+// runRateDetail explains a run-rate projection.
+type runRateDetail struct {
+	DaysInRelease  int
+	WeeklyGross    float64
+	PriorRetention float64
+	Retention      float64
+	WeeksObserved  int
+	WeeksLeft      int
+}
+
+func (d runRateDetail) json() fiber.Map {
+	return fiber.Map{
+		"days_in_release": d.DaysInRelease, "weekly_domestic": d.WeeklyGross, "prior_retention": d.PriorRetention,
+		"retention": d.Retention, "weeks_observed": d.WeeksObserved, "weeks_left": d.WeeksLeft,
+	}
+}
+
+func runRateVersion(asOf time.Time) string {
+	return "run-rate-1." + asOf.Format("20060102")
+}
+
+// priorRetention is the expected week-over-week hold before looking at how
+// the movie is actually doing.
+func priorRetention(f movieFeatures) float64 {
+	r, n := 0.0, 0
+	for _, g := range f.Genres {
+		if v, ok := genreRetention[g]; ok {
+			r += v
+			n++
+		}
+	}
+	if n == 0 {
+		r, n = defaultRetention, 1
+	}
+	r /= float64(n)
+	// Summer and the holidays give movies more weekdays that play like
+	// weekends.
+	if m := f.month(); (m >= 5 && m <= 7) || m >= 11 {
+		r += 0.05
+	}
+	// Word of mouth.
+	if f.RTScore > 0 {
+		r += (f.RTScore - 60) / 100 * 0.2
+	}
+	return math.Min(math.Max(r, minRetention), maxRetention)
+}
+
+// domesticAsOf is the movie's domestic gross at the end of day, from the
+// last snapshot on or before it. Days before release are zero.
+func domesticAsOf(q queryer, movieID int, day, releaseDate string) (float64, bool) {
+	var gross float64
+	err := q.QueryRow("SELECT domestic_gross FROM movie_daily_stats WHERE movie_id = ? AND stat_date <= ? ORDER BY stat_date DESC LIMIT 1", movieID, day).Scan(&gross)
+	if err == sql.ErrNoRows {
+		return 0, releaseDate != "" && day < releaseDate
+	}
+	return gross, err == nil
+}
+
+// projectRunRate projects a released movie's final grosses from its run so
+// far. It reports false when the movie hasn't grossed anything yet.
+func projectRunRate(q queryer, m runRateInputs, asOf time.Time) (grossProjection, runRateDetail, bool) {
+	var d runRateDetail
+	release, err := time.Parse("2006-01-02", m.ReleaseDate)
+	if err != nil || m.Domestic <= 0 {
+		return grossProjection{}, d, false
+	}
+	d.DaysInRelease = int(asOf.Sub(release).Hours()/24) + 1
+	if d.DaysInRelease < 1 {
+		d.DaysInRelease = 1
+	}
+
+	// Domestic gross at the end of each of the last few weeks, newest first.
+	weekEnds := []float64{m.Domestic}
+	for k := 1; k <= 4; k++ {
+		day := asOf.AddDate(0, 0, -7*k).Format("2006-01-02")
+		gross, ok := domesticAsOf(q, m.ID, day, m.ReleaseDate)
+		if !ok {
+			break
+		}
+		weekEnds = append(weekEnds, gross)
+		if gross == 0 {
+			break
+		}
+	}
+
+	if len(weekEnds) > 1 && d.DaysInRelease >= 7 {
+		d.WeeklyGross = weekEnds[0] - weekEnds[1]
+	} else {
+		// Still in the first week, or no snapshot a week back: treat the
+		// whole gross so far as one partial week. Opening weekends are most
+		// of a first week, so the first few days aren't scaled up by much.
+		scale := math.Min(7/math.Max(float64(d.DaysInRelease), 3), 1.6)
+		d.WeeklyGross = m.Domestic * scale
+	}
+
+	d.PriorRetention = priorRetention(m.movieFeatures)
+	observed := 0.0
+	for k := 1; k+1 < len(weekEnds); k++ {
+		this, prev := weekEnds[k-1]-weekEnds[k], weekEnds[k]-weekEnds[k+1]
+		if prev <= 0 || d.DaysInRelease < 7*(k+1) {
+			// The earlier week was partial; its hold isn't comparable.
+			break
+		}
+		observed += math.Min(math.Max(this/prev, minRetention), maxRetention)
+		d.WeeksObserved++
+	}
+	d.Retention = (d.PriorRetention + observed) / float64(1+d.WeeksObserved)
+
+	d.WeeksLeft = int(math.Ceil(float64(theatricalRunDays-d.DaysInRelease) / 7))
+	if d.WeeksLeft < 0 {
+		d.WeeksLeft = 0
+	}
+	remaining := 0.0
+	week := d.WeeklyGross
+	for k := 0; k < d.WeeksLeft; k++ {
+		week *= d.Retention
+		remaining += week
+	}
+
+	ratio := 0.0
+	if m.Worldwide > m.Domestic {
+		ratio = m.Worldwide / m.Domestic
+	} else {
+		ratio = 1 / 0.4
+		if r, ok := currentProjectionModel().(*ridgeModel); ok && r.domesticShare > 0 {
+			ratio = 1 / r.domesticShare
+		}
+	}
+
+	// The more weeks seen, the surer the hold.
+	logSD := 0.25 + 0.35/float64(1+d.WeeksObserved)
+	points := func(rest float64) float64 {
+		domestic := m.Domestic + rest
+		return calculateMoviePoints(movieData{
+			ID: m.ID, Budget: m.Budget, DomesticGross: domestic, WorldwideGross: math.Max(m.Worldwide, domestic*ratio),
+			RTScore: m.RTScore, OpeningWeekend: m.Opening, Status: "released",
+		})
+	}
+	domestic := m.Domestic + remaining
+	return grossProjection{
+		Opening: m.Opening, Domestic: domestic, Worldwide: math.Max(m.Worldwide, domestic*ratio),
+		Points:     points(remaining),
+		PointsLow:  points(remaining * math.Exp(-projectionZ*logSD)),
+		PointsHigh: points(remaining * math.Exp(projectionZ*logSD)),
+	}, d, true
+}
+
+// loadRunRateInputs reads what projectRunRate needs for one movie.
+func loadRunRateInputs(q queryer, movieID int) (runRateInputs, error) {
+	m := runRateInputs{movieFeatures: movieFeatures{ID: movieID}}
+	var genres string
+	var collection int
+	err := q.QueryRow(`SELECT budget, COALESCE(release_date, ''), genres, runtime, collection_id, rt_score,
+		opening_weekend_gross, domestic_gross, worldwide_gross FROM movies WHERE id = ?`, movieID).
+		Scan(&m.Budget, &m.ReleaseDate, &genres, &m.Runtime, &collection, &m.RTScore, &m.Opening, &m.Domestic, &m.Worldwide)
+	m.Genres, m.Franchise = splitGenres(genres), collection != 0
+	return m, err
+}
+
+// updateRunRateProjections re-projects every released movie that has
+// grossed something from its run so far.
+func updateRunRateProjections(tx *sql.Tx) int {
+	rows, err := tx.Query("SELECT id FROM movies WHERE status = 'released' AND domestic_gross > 0")
+	if err != nil {
+		return 0
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	asOf := time.Now().UTC()
+	version := runRateVersion(asOf)
+	n := 0
+	for _, id := range ids {
+		m, err := loadRunRateInputs(tx, id)
+		if err != nil {
+			continue
+		}
+		p, _, ok := projectRunRate(tx, m, asOf)
+		if !ok {
+			continue
+		}
+		tx.Exec(`INSERT OR REPLACE INTO movie_projections (movie_id, model, version, opening, domestic, worldwide, points, points_low, points_high)
+			VALUES (?, 'run_rate', ?, ?, ?, ?, ?, ?, ?)`,
+			id, version, p.Opening, p.Domestic, p.Worldwide, p.Points, p.PointsLow, p.PointsHigh)
+		tx.Exec("UPDATE movies SET projected_points = ?, projection_version = ? WHERE id = ?", p.Points, version, id)
+		n++
+	}
+	return n
+}
+
+// runRateSummary describes a released movie's run-rate projection for
+// GET /api/movies/:id/projection, or nil if it doesn't have one.
+func runRateSummary(movieID int) fiber.Map {
+	m, err := loadRunRateInputs(db, movieID)
+	if err != nil {
+		return nil
+	}
+	_, d, ok := projectRunRate(db, m, time.Now().UTC())
+	if !ok {
+		return nil
+	}
+	return d.json()
+}
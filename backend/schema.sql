@@ -36,7 +36,7 @@ CREATE TABLE IF NOT EXISTS movies (
     domestic_gross REAL NOT NULL DEFAULT 0,
     worldwide_gross REAL NOT NULL DEFAULT 0,
     rt_score REAL NOT NULL DEFAULT 0,
-    status TEXT NOT NULL DEFAULT 'upcoming' CHECK(status IN ('upcoming','released','free_agent'))
+    status TEXT NOT NULL DEFAULT 'upcoming' CHECK(status IN ('upcoming','released'))
 );
 
 CREATE TABLE IF NOT EXISTS roster (
@@ -44,7 +44,7 @@ CREATE TABLE IF NOT EXISTS roster (
     team_id INTEGER NOT NULL REFERENCES teams(id),
     movie_id INTEGER NOT NULL REFERENCES movies(id),
     acquired_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    acquisition_type TEXT NOT NULL DEFAULT 'draft' CHECK(acquisition_type IN ('draft','waiver','trade')),
+    acquisition_type TEXT NOT NULL DEFAULT 'draft' CHECK(acquisition_type IN ('draft','waiver','trade','commissioner')),
     UNIQUE(team_id, movie_id)
 );
 
@@ -62,7 +62,7 @@ CREATE TABLE IF NOT EXISTS trades (
     league_id INTEGER NOT NULL REFERENCES leagues(id),
     proposer_team_id INTEGER NOT NULL REFERENCES teams(id),
     receiver_team_id INTEGER NOT NULL REFERENCES teams(id),
-    status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending','accepted','rejected')),
+    status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending','accepted','rejected','invalid','countered','cancelled','expired','in_review','vetoed','reversed')),
     proposed_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -88,7 +88,7 @@ CREATE TABLE IF NOT EXISTS transactions (
     league_id INTEGER NOT NULL REFERENCES leagues(id),
     team_id INTEGER NOT NULL REFERENCES teams(id),
     movie_id INTEGER NOT NULL REFERENCES movies(id),
-    type TEXT NOT NULL CHECK(type IN ('draft','waiver','trade','drop')),
+    type TEXT NOT NULL CHECK(type IN ('draft','waiver','trade','drop','trade_veto','commissioner_add','commissioner_drop','reversal')),
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -99,6 +99,91 @@ CREATE TABLE IF NOT EXISTS transactions (
 -- season_start TEXT  (e.g. "2026-01-01")
 -- season_end   TEXT  (e.g. "2026-12-31")
 
+-- Trade lifecycle columns (added via init code ALTER)
+-- leagues.trade_expiry_hours INTEGER  (0 = offers never expire)
+-- trades.parent_trade_id     INTEGER  (trade this one counters)
+-- trades.note                TEXT
+-- trades.expires_at          DATETIME
+-- trades.responded_at        DATETIME
+
+-- Trade review columns (added via init code ALTER)
+-- leagues.trade_review_mode    TEXT     ('none', 'commissioner' or 'vote')
+-- leagues.trade_veto_threshold REAL     (share of eligible owners needed to veto)
+-- leagues.trade_review_hours   INTEGER
+-- trades.review_ends_at        DATETIME
+-- transactions.trade_id        INTEGER
+
+-- Multi-team trade columns (added via init code ALTER)
+-- trade_items.to_team_id  INTEGER  (team receiving the movie; team_id gives it up)
+
+-- League calendar columns (added via init code ALTER)
+-- leagues.trade_deadline     TEXT  (YYYY-MM-DD, '' = none)
+-- leagues.waiver_cutoff      TEXT  (YYYY-MM-DD, '' = none)
+-- leagues.roster_lock_dates  TEXT  (comma-separated YYYY-MM-DD list)
+
+-- FAAB waiver columns (added via init code ALTER)
+-- leagues.waiver_mode          TEXT     ('faab' or 'rolling')
+-- leagues.faab_budget          INTEGER  (season budget per team)
+-- leagues.waiver_run_day       INTEGER  (0 = Sunday ... 6 = Saturday, UTC)
+-- leagues.waiver_run_hour      INTEGER  (0-23, UTC)
+-- teams.faab_spent             INTEGER
+-- waiver_claims.bid            INTEGER
+-- waiver_claims.drop_movie_id  INTEGER  (dropped only if the claim wins)
+-- waiver_claims.result         TEXT
+-- waiver_claims.processed_at   DATETIME
+
+-- Rolling waiver columns (added via init code ALTER)
+-- leagues.waiver_period_hours  INTEGER  (how long a dropped movie stays on waivers)
+-- teams.waiver_priority        INTEGER  (1 = first claim)
+
+-- Roster rule columns (added via init code ALTER)
+-- leagues.max_roster_size  INTEGER  (0 = draft_rounds)
+-- leagues.summer_slots     INTEGER  (May-August releases)
+-- leagues.awards_slots     INTEGER  (October-December releases)
+-- leagues.flex_slots       INTEGER  (any release; all three 0 = untyped roster)
+
+-- Lineup columns (added via init code ALTER)
+-- leagues.scoring_mode      TEXT     ('season' = every rostered movie scores, 'lineup' = weekly starters only)
+-- leagues.lineup_size       INTEGER  (starters per week)
+-- leagues.lineup_lock_day   INTEGER  (0 = Sunday ... 6 = Saturday, in lineup_timezone)
+-- leagues.lineup_lock_hour  INTEGER  (0-23, in lineup_timezone)
+-- leagues.lineup_timezone   TEXT     (IANA name, e.g. America/New_York)
+-- leagues.league_format     TEXT     ('points' = cumulative table, 'h2h' = weekly matchups)
+
+-- Playoff columns (added via init code ALTER)
+-- leagues.playoff_teams            INTEGER  (0 = no playoffs)
+-- leagues.playoff_seeding          TEXT     ('standings' or 'points')
+-- leagues.playoff_weeks_per_round  INTEGER
+-- leagues.playoff_consolation      BOOLEAN  (bracket for teams that miss the playoffs)
+-- leagues.champion_team_id         INTEGER
+
+-- Lifecycle columns (added via init code ALTER)
+-- leagues.auto_start_draft   BOOLEAN   (start the draft at draft_date)
+-- leagues.season_grace_days  INTEGER   (days after season_end before the league completes)
+-- leagues.completed_at       DATETIME
+
+-- Season history columns (added via init code ALTER)
+-- leagues.previous_league_id  INTEGER  (the league this one continues as its next season)
+
+-- Commissioner columns (added via init code ALTER)
+-- users.is_system           BOOLEAN  (placeholder that holds an orphaned team; can't log in)
+-- transactions.reverses_id  INTEGER  (the transaction a reversal undoes)
+
+-- Access columns (added via init code ALTER)
+-- leagues.visibility     TEXT     ('private' or 'public'; public leagues can be read by anyone signed in)
+-- leagues.join_approval  BOOLEAN  (joining from the directory needs a commissioner's approval)
+
+-- Division columns (added via init code ALTER)
+-- leagues.division_matchups         INTEGER  (times division rivals meet per h2h schedule cycle)
+-- leagues.playoff_division_winners  BOOLEAN  (division leaders are seeded ahead of wildcards)
+-- teams.division_id                 INTEGER
+
+-- Projection columns (added via init code ALTER)
+-- movies.genres              TEXT     (comma-separated TMDB genre names)
+-- movies.runtime             INTEGER  (minutes; 0 when unknown)
+-- movies.collection_id       INTEGER  (TMDB collection, i.e. franchise; 0 for none)
+-- movies.projection_version  TEXT     (model version behind projected_points)
+
 CREATE TABLE IF NOT EXISTS league_messages (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     league_id INTEGER NOT NULL REFERENCES leagues(id),
@@ -117,3 +202,248 @@ CREATE TABLE IF NOT EXISTS notifications (
     read BOOLEAN NOT NULL DEFAULT false,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
+
+CREATE TABLE IF NOT EXISTS trade_messages (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    trade_id INTEGER NOT NULL REFERENCES trades(id),
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    message TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS trade_votes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    trade_id INTEGER NOT NULL REFERENCES trades(id),
+    team_id INTEGER NOT NULL REFERENCES teams(id),
+    veto BOOLEAN NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(trade_id, team_id)
+);
+
+CREATE TABLE IF NOT EXISTS trade_teams (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    trade_id INTEGER NOT NULL REFERENCES trades(id),
+    team_id INTEGER NOT NULL REFERENCES teams(id),
+    status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending','accepted','rejected')),
+    responded_at DATETIME,
+    UNIQUE(trade_id, team_id)
+);
+
+CREATE TABLE IF NOT EXISTS waiver_wire (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    league_id INTEGER NOT NULL REFERENCES leagues(id),
+    movie_id INTEGER NOT NULL REFERENCES movies(id),
+    dropped_by_team_id INTEGER REFERENCES teams(id),
+    dropped_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    available_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS movie_daily_stats (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    movie_id INTEGER NOT NULL REFERENCES movies(id),
+    stat_date TEXT NOT NULL,
+    domestic_gross REAL NOT NULL DEFAULT 0,
+    worldwide_gross REAL NOT NULL DEFAULT 0,
+    points REAL NOT NULL DEFAULT 0,
+    UNIQUE(movie_id, stat_date)
+);
+
+CREATE TABLE IF NOT EXISTS team_lineups (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    team_id INTEGER NOT NULL REFERENCES teams(id),
+    week INTEGER NOT NULL,
+    movie_id INTEGER NOT NULL REFERENCES movies(id),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(team_id, week, movie_id)
+);
+
+CREATE TABLE IF NOT EXISTS team_week_scores (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    team_id INTEGER NOT NULL REFERENCES teams(id),
+    week INTEGER NOT NULL,
+    points REAL NOT NULL DEFAULT 0,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(team_id, week)
+);
+
+CREATE TABLE IF NOT EXISTS matchups (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    league_id INTEGER NOT NULL REFERENCES leagues(id),
+    week INTEGER NOT NULL,
+    home_team_id INTEGER NOT NULL REFERENCES teams(id),
+    away_team_id INTEGER REFERENCES teams(id),  -- NULL = bye
+    home_points REAL NOT NULL DEFAULT 0,
+    away_points REAL NOT NULL DEFAULT 0,
+    UNIQUE(league_id, week, home_team_id)
+);
+
+CREATE TABLE IF NOT EXISTS playoff_games (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    league_id INTEGER NOT NULL REFERENCES leagues(id),
+    bracket TEXT NOT NULL DEFAULT 'championship' CHECK(bracket IN ('championship','consolation')),
+    round INTEGER NOT NULL,
+    slot INTEGER NOT NULL,
+    start_week INTEGER NOT NULL,
+    end_week INTEGER NOT NULL,
+    team1_id INTEGER REFERENCES teams(id),  -- better seed
+    team2_id INTEGER REFERENCES teams(id),  -- NULL for a bye
+    seed1 INTEGER,
+    seed2 INTEGER,
+    team1_points REAL NOT NULL DEFAULT 0,
+    team2_points REAL NOT NULL DEFAULT 0,
+    winner_team_id INTEGER REFERENCES teams(id),
+    status TEXT NOT NULL DEFAULT 'scheduled' CHECK(status IN ('scheduled','in_progress','final','bye')),
+    UNIQUE(league_id, bracket, round, slot)
+);
+
+CREATE TABLE IF NOT EXISTS league_results (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    league_id INTEGER NOT NULL REFERENCES leagues(id),
+    season_year INTEGER NOT NULL,
+    team_id INTEGER NOT NULL REFERENCES teams(id),
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    team_name TEXT NOT NULL,
+    owner_name TEXT NOT NULL,
+    final_rank INTEGER NOT NULL,
+    total_points REAL NOT NULL,
+    wins INTEGER NOT NULL DEFAULT 0,
+    losses INTEGER NOT NULL DEFAULT 0,
+    ties INTEGER NOT NULL DEFAULT 0,
+    points_for REAL NOT NULL DEFAULT 0,
+    points_against REAL NOT NULL DEFAULT 0,
+    champion BOOLEAN NOT NULL DEFAULT 0,
+    finalized_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(league_id, team_id)
+);
+
+-- Final results are a permanent record.
+CREATE TRIGGER IF NOT EXISTS league_results_no_update BEFORE UPDATE ON league_results
+BEGIN SELECT RAISE(ABORT, 'league_results is immutable'); END;
+
+CREATE TRIGGER IF NOT EXISTS league_results_no_delete BEFORE DELETE ON league_results
+BEGIN SELECT RAISE(ABORT, 'league_results is immutable'); END;
+
+CREATE TABLE IF NOT EXISTS league_result_picks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    league_id INTEGER NOT NULL REFERENCES leagues(id),
+    season_year INTEGER NOT NULL,
+    team_id INTEGER NOT NULL REFERENCES teams(id),
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    team_name TEXT NOT NULL,
+    owner_name TEXT NOT NULL,
+    movie_id INTEGER NOT NULL REFERENCES movies(id),
+    movie_title TEXT NOT NULL,
+    draft_round INTEGER NOT NULL,
+    pick_number INTEGER NOT NULL,
+    points REAL NOT NULL DEFAULT 0,
+    budget REAL NOT NULL DEFAULT 0,
+    worldwide_gross REAL NOT NULL DEFAULT 0,
+    UNIQUE(league_id, pick_number)
+);
+
+CREATE TRIGGER IF NOT EXISTS league_result_picks_no_update BEFORE UPDATE ON league_result_picks
+BEGIN SELECT RAISE(ABORT, 'league_result_picks is immutable'); END;
+
+CREATE TRIGGER IF NOT EXISTS league_result_picks_no_delete BEFORE DELETE ON league_result_picks
+BEGIN SELECT RAISE(ABORT, 'league_result_picks is immutable'); END;
+
+CREATE TABLE IF NOT EXISTS league_setting_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    league_id INTEGER NOT NULL REFERENCES leagues(id),
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    setting TEXT NOT NULL,
+    old_value TEXT NOT NULL DEFAULT '',
+    new_value TEXT NOT NULL DEFAULT '',
+    changed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS league_commissioners (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    league_id INTEGER NOT NULL REFERENCES leagues(id),
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    appointed_by INTEGER NOT NULL REFERENCES users(id),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(league_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS league_audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    league_id INTEGER NOT NULL REFERENCES leagues(id),
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    action TEXT NOT NULL,
+    team_id INTEGER REFERENCES teams(id),
+    details TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS league_join_requests (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    league_id INTEGER NOT NULL REFERENCES leagues(id),
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    team_name TEXT NOT NULL,
+    message TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending','approved','denied','withdrawn')),
+    decided_by INTEGER REFERENCES users(id),
+    decided_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS league_invites (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    league_id INTEGER NOT NULL REFERENCES leagues(id),
+    code TEXT NOT NULL UNIQUE,
+    created_by INTEGER NOT NULL REFERENCES users(id),
+    email TEXT,
+    max_uses INTEGER NOT NULL DEFAULT 0,
+    expires_at DATETIME,
+    revoked_at DATETIME,
+    revoked_by INTEGER REFERENCES users(id),
+    email_sent_at DATETIME,
+    email_error TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS league_invite_uses (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    invite_id INTEGER NOT NULL REFERENCES league_invites(id),
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    team_id INTEGER REFERENCES teams(id),
+    accepted_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS league_divisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    league_id INTEGER NOT NULL REFERENCES leagues(id),
+    name TEXT NOT NULL,
+    conference TEXT NOT NULL DEFAULT '',
+    position INTEGER NOT NULL DEFAULT 0,
+    UNIQUE(league_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS movie_projections (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    movie_id INTEGER NOT NULL REFERENCES movies(id),
+    model TEXT NOT NULL,
+    version TEXT NOT NULL,
+    opening REAL NOT NULL DEFAULT 0,
+    domestic REAL NOT NULL DEFAULT 0,
+    worldwide REAL NOT NULL DEFAULT 0,
+    points REAL NOT NULL DEFAULT 0,
+    points_low REAL NOT NULL DEFAULT 0,
+    points_high REAL NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(movie_id, version)
+);
+
+CREATE TABLE IF NOT EXISTS league_articles (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    league_id INTEGER NOT NULL REFERENCES leagues(id),
+    kind TEXT NOT NULL,
+    week INTEGER NOT NULL DEFAULT 0,
+    title TEXT NOT NULL,
+    body TEXT NOT NULL DEFAULT '',
+    data TEXT NOT NULL DEFAULT '{}',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(league_id, kind, week)
+);
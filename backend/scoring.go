@@ -60,6 +60,10 @@ func calculateMoviePoints(m movieData) float64 {
 }
 
 func recalculateAllScores() error {
+	// Lineups that locked since the last run need to exist before their
+	// weeks are scored.
+	lockAllLineups()
+
 	rows, err := db.Query(`SELECT id, budget, domestic_gross, worldwide_gross, rt_score, opening_weekend_gross, status FROM movies`)
 	if err != nil {
 		return err
@@ -78,16 +82,24 @@ func recalculateAllScores() error {
 		}
 		pts := calculateMoviePoints(m)
 		tx.Exec("UPDATE movies SET points = ? WHERE id = ?", pts, m.ID)
+		recordDailyStats(tx, m, pts)
 	}
 
 	// Update team total_points
 	tx.Exec(`UPDATE teams SET total_points = COALESCE(
 		(SELECT SUM(m.points) FROM roster r JOIN movies m ON m.id = r.movie_id WHERE r.team_id = teams.id), 0)`)
+	// Lineup leagues only score their starters, week by week.
+	updateLineupScores(tx)
+	updateMatchupScores(tx)
 
 	if err := tx.Commit(); err != nil {
 		return err
 	}
 
+	// Fresh week scores can decide playoff games.
+	advanceAllPlayoffs()
+	invalidateOdds()
+
 	log.Println("Recalculated all scores")
 	return nil
 }
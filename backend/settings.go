@@ -0,0 +1,223 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// leagueSetting is a configurable league option stored as a column on
+// leagues. Settings are accepted by createLeague and returned by getLeague.
+type leagueSetting struct {
+	Key     string
+	Kind    string   // "int", "float", "string", "bool", "date", "dates" or "timezone"
+	Options []string // allowed values for string settings
+	Min     float64  // bounds for numeric settings
+	Max     float64
+}
+
+var leagueSettingDefs = []leagueSetting{
+	{Key: "trade_expiry_hours", Kind: "int", Min: 0, Max: 24 * 14},
+	{Key: "trade_review_mode", Kind: "string", Options: []string{"none", "commissioner", "vote"}},
+	{Key: "trade_veto_threshold", Kind: "float", Min: 0.01, Max: 1},
+	{Key: "trade_review_hours", Kind: "int", Min: 1, Max: 24 * 7},
+	{Key: "trade_deadline", Kind: "date"},
+	{Key: "waiver_cutoff", Kind: "date"},
+	{Key: "roster_lock_dates", Kind: "dates"},
+	{Key: "waiver_mode", Kind: "string", Options: []string{"faab", "rolling"}},
+	{Key: "faab_budget", Kind: "int", Min: 0, Max: 10000},
+	{Key: "waiver_run_day", Kind: "int", Min: 0, Max: 6},
+	{Key: "waiver_run_hour", Kind: "int", Min: 0, Max: 23},
+	{Key: "waiver_period_hours", Kind: "int", Min: 0, Max: 24 * 7},
+	{Key: "max_roster_size", Kind: "int", Min: 0, Max: 100},
+	{Key: "summer_slots", Kind: "int", Min: 0, Max: 50},
+	{Key: "awards_slots", Kind: "int", Min: 0, Max: 50},
+	{Key: "flex_slots", Kind: "int", Min: 0, Max: 50},
+	{Key: "scoring_mode", Kind: "string", Options: []string{"season", "lineup"}},
+	{Key: "lineup_size", Kind: "int", Min: 1, Max: 50},
+	{Key: "lineup_lock_day", Kind: "int", Min: 0, Max: 6},
+	{Key: "lineup_lock_hour", Kind: "int", Min: 0, Max: 23},
+	{Key: "lineup_timezone", Kind: "timezone"},
+	{Key: "league_format", Kind: "string", Options: []string{"points", "h2h"}},
+	{Key: "playoff_teams", Kind: "int", Min: 0, Max: 32},
+	{Key: "playoff_seeding", Kind: "string", Options: []string{"standings", "points"}},
+	{Key: "playoff_weeks_per_round", Kind: "int", Min: 1, Max: 4},
+	{Key: "playoff_consolation", Kind: "bool"},
+	{Key: "auto_start_draft", Kind: "bool"},
+	{Key: "season_grace_days", Kind: "int", Min: 0, Max: 60},
+	{Key: "visibility", Kind: "string", Options: []string{"private", "public"}},
+	{Key: "join_approval", Kind: "bool"},
+	{Key: "division_matchups", Kind: "int", Min: 1, Max: 4},
+	{Key: "playoff_division_winners", Kind: "bool"},
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func findLeagueSetting(key string) (leagueSetting, bool) {
+	for _, s := range leagueSettingDefs {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return leagueSetting{}, false
+}
+
+// parse converts a decoded JSON value into the value stored in the column,
+// rejecting anything outside the setting's allowed range.
+func (s leagueSetting) parse(v interface{}) (interface{}, error) {
+	switch s.Kind {
+	case "int", "float":
+		n, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a number", s.Key)
+		}
+		if n < s.Min || n > s.Max {
+			return nil, fmt.Errorf("%s must be between %g and %g", s.Key, s.Min, s.Max)
+		}
+		if s.Kind == "int" {
+			if n != float64(int(n)) {
+				return nil, fmt.Errorf("%s must be a whole number", s.Key)
+			}
+			return int(n), nil
+		}
+		return n, nil
+	case "bool":
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s must be true or false", s.Key)
+		}
+		return b, nil
+	case "date":
+		// Dates are YYYY-MM-DD; an empty string clears the setting.
+		str, ok := v.(string)
+		if !ok || (str != "" && !isDate(str)) {
+			return nil, fmt.Errorf("%s must be a date (YYYY-MM-DD)", s.Key)
+		}
+		return str, nil
+	case "dates":
+		// Date lists are stored comma-separated in a single column.
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s must be a list of dates", s.Key)
+		}
+		dates := make([]string, 0, len(list))
+		for _, d := range list {
+			str, ok := d.(string)
+			if !ok || !isDate(str) {
+				return nil, fmt.Errorf("%s must be a list of dates (YYYY-MM-DD)", s.Key)
+			}
+			dates = append(dates, str)
+		}
+		sort.Strings(dates)
+		return strings.Join(dates, ","), nil
+	case "timezone":
+		// IANA names such as America/New_York.
+		str, ok := v.(string)
+		if !ok || str == "" {
+			return nil, fmt.Errorf("%s must be a time zone name", s.Key)
+		}
+		if _, err := time.LoadLocation(str); err != nil {
+			return nil, fmt.Errorf("%s must be a time zone name", s.Key)
+		}
+		return str, nil
+	default:
+		str, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a string", s.Key)
+		}
+		if len(s.Options) > 0 {
+			for _, o := range s.Options {
+				if str == o {
+					return str, nil
+				}
+			}
+			return nil, fmt.Errorf("%s must be one of %s", s.Key, strings.Join(s.Options, ", "))
+		}
+		return str, nil
+	}
+}
+
+// parseLeagueSettings picks the known setting keys out of a raw JSON body
+// and validates them. Unknown keys are ignored.
+func parseLeagueSettings(body []byte) (map[string]interface{}, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, newAPIError(400, "INVALID_REQUEST", "Invalid request")
+	}
+	values := make(map[string]interface{})
+	for key, v := range raw {
+		s, ok := findLeagueSetting(key)
+		if !ok {
+			continue
+		}
+		parsed, err := s.parse(v)
+		if err != nil {
+			return nil, newAPIError(400, "INVALID_SETTING", err.Error()).with("setting", key)
+		}
+		values[key] = parsed
+	}
+	return values, nil
+}
+
+// applyLeagueSettings writes already-validated settings to the league row.
+func applyLeagueSettings(ex execer, leagueID int, values map[string]interface{}) error {
+	for key, v := range values {
+		if _, err := ex.Exec("UPDATE leagues SET "+key+" = ? WHERE id = ?", v, leagueID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getLeagueSettings reads every configurable setting for a league.
+func getLeagueSettings(leagueID int) fiber.Map {
+	cols := make([]string, len(leagueSettingDefs))
+	vals := make([]interface{}, len(leagueSettingDefs))
+	ptrs := make([]interface{}, len(leagueSettingDefs))
+	for i, s := range leagueSettingDefs {
+		cols[i] = s.Key
+		ptrs[i] = &vals[i]
+	}
+	settings := fiber.Map{}
+	if err := db.QueryRow("SELECT "+strings.Join(cols, ", ")+" FROM leagues WHERE id = ?", leagueID).Scan(ptrs...); err != nil {
+		return settings
+	}
+	for i, s := range leagueSettingDefs {
+		v := vals[i]
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		if s.Kind == "bool" {
+			if n, ok := v.(int64); ok {
+				v = n != 0
+			}
+		}
+		if s.Kind == "dates" {
+			str, _ := v.(string)
+			v = splitDates(str)
+		}
+		settings[s.Key] = v
+	}
+	return settings
+}
+
+func isDate(s string) bool {
+	_, err := time.Parse("2006-01-02", s)
+	return err == nil
+}
+
+// splitDates reads a comma-separated date list column.
+func splitDates(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
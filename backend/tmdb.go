@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -42,6 +43,26 @@ type tmdbMovie struct {
 		ID   int    `json:"id"`
 		Name string `json:"name"`
 	} `json:"genres"`
+	BelongsToCollection *struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"belongs_to_collection"`
+}
+
+// genreList is the movie's genres as stored in movies.genres.
+func (m *tmdbMovie) genreList() string {
+	names := make([]string, len(m.Genres))
+	for i, g := range m.Genres {
+		names[i] = g.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func (m *tmdbMovie) collectionID() int {
+	if m.BelongsToCollection == nil {
+		return 0
+	}
+	return m.BelongsToCollection.ID
 }
 
 func tmdbGet(path string) ([]byte, error) {
@@ -175,14 +196,14 @@ func tmdbSyncHandler(c *fiber.Ctx) error {
 		revenue := details.Revenue
 
 		// Upsert: try update first, then insert
-		res, _ := db.Exec(`UPDATE movies SET title=?, release_date=?, poster_url=?, budget=?, domestic_gross=?, worldwide_gross=?, status=?
-			WHERE tmdb_id=?`,
-			m.Title, m.ReleaseDate, poster, budget, revenue, revenue, status, m.ID)
+		res, _ := db.Exec(`UPDATE movies SET title=?, release_date=?, poster_url=?, budget=?, domestic_gross=?, worldwide_gross=?, status=?,
+			genres=?, runtime=?, collection_id=? WHERE tmdb_id=?`,
+			m.Title, m.ReleaseDate, poster, budget, revenue, revenue, status, details.genreList(), details.Runtime, details.collectionID(), m.ID)
 		rows, _ := res.RowsAffected()
 		if rows == 0 {
-			db.Exec(`INSERT INTO movies (tmdb_id, title, release_date, poster_url, budget, domestic_gross, worldwide_gross, status)
-				VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-				m.ID, m.Title, m.ReleaseDate, poster, budget, revenue, revenue, status)
+			db.Exec(`INSERT INTO movies (tmdb_id, title, release_date, poster_url, budget, domestic_gross, worldwide_gross, status, genres, runtime, collection_id)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				m.ID, m.Title, m.ReleaseDate, poster, budget, revenue, revenue, status, details.genreList(), details.Runtime, details.collectionID())
 		}
 		synced++
 	}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"math"
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// --- Trade Analyzer ---
+//
+// A movie's points so far move with it, since team totals are the sum of
+// the current roster. Its remaining points are what it is still expected
+// to earn: projected_points minus points, never below zero. A movie's
+// value to a roster is both together.
+
+// Share of remaining points used as the standard deviation of a movie's
+// outcome. Unreleased movies are far less certain than ones already in
+// theaters.
+const (
+	upcomingRemainingStdDev = 0.5
+	releasedRemainingStdDev = 0.2
+)
+
+type analyzedMovie struct {
+	ID                           int
+	Title, Status                string
+	Points, Projected, Remaining float64
+}
+
+func loadAnalyzedMovie(id int) analyzedMovie {
+	m := analyzedMovie{ID: id}
+	db.QueryRow("SELECT title, status, points, projected_points FROM movies WHERE id = ?", id).
+		Scan(&m.Title, &m.Status, &m.Points, &m.Projected)
+	m.Remaining = math.Max(m.Projected-m.Points, 0)
+	return m
+}
+
+func (m analyzedMovie) value() float64 { return m.Points + m.Remaining }
+
+func (m analyzedMovie) variance() float64 {
+	share := releasedRemainingStdDev
+	if m.Status == "upcoming" {
+		share = upcomingRemainingStdDev
+	}
+	sd := share * m.Remaining
+	return sd * sd
+}
+
+func (m analyzedMovie) json() fiber.Map {
+	return fiber.Map{
+		"movie_id": m.ID, "title": m.Title, "status": m.Status, "points": m.Points,
+		"projected_points": m.Projected, "remaining_points": m.Remaining, "std_dev": math.Sqrt(m.variance()),
+	}
+}
+
+// tradeSide collects what one team gives and receives in a trade.
+type tradeSide struct {
+	TeamID                      int
+	Give, Receive               []analyzedMovie
+	EarnedGiven, EarnedRecv     float64
+	RemainGiven, RemainRecv     float64
+	VarianceGiven, VarianceRecv float64
+	ValueGiven, ValueRecv       float64
+}
+
+func (s *tradeSide) net() float64 { return s.ValueRecv - s.ValueGiven }
+
+// teamStanding is a team's current and projected end-of-season points.
+type teamStanding struct {
+	TeamID            int
+	Name              string
+	Points, Projected float64
+}
+
+func loadLeagueStandings(leagueID int) []teamStanding {
+	rows, err := db.Query(`SELECT t.id, t.name, t.total_points, COALESCE(SUM(MAX(m.points, m.projected_points)), 0)
+		FROM teams t LEFT JOIN roster r ON r.team_id = t.id LEFT JOIN movies m ON m.id = r.movie_id
+		WHERE t.league_id = ? GROUP BY t.id`, leagueID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var standings []teamStanding
+	for rows.Next() {
+		var s teamStanding
+		rows.Scan(&s.TeamID, &s.Name, &s.Points, &s.Projected)
+		standings = append(standings, s)
+	}
+	return standings
+}
+
+// rankBy ranks teams by the given score, highest first, breaking ties by
+// team ID so ranks are stable.
+func rankBy(standings []teamStanding, score func(teamStanding) float64) map[int]int {
+	sorted := append([]teamStanding{}, standings...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := score(sorted[i]), score(sorted[j])
+		if a != b {
+			return a > b
+		}
+		return sorted[i].TeamID < sorted[j].TeamID
+	})
+	ranks := make(map[int]int, len(sorted))
+	for i, s := range sorted {
+		ranks[s.TeamID] = i + 1
+	}
+	return ranks
+}
+
+// riskLevel grades how uncertain the incoming remaining points are, as a
+// coefficient of variation.
+func riskLevel(variance, remaining float64) string {
+	if remaining <= 0 {
+		return "low"
+	}
+	cv := math.Sqrt(variance) / remaining
+	switch {
+	case cv >= 0.4:
+		return "high"
+	case cv >= 0.2:
+		return "medium"
+	}
+	return "low"
+}
+
+// tradeRecommendationFor scales the accept/reject thresholds to the size of
+// the team's projected total, so the same swing matters more to a small
+// roster than a large one.
+func tradeRecommendationFor(net, projectedTotal float64) string {
+	base := math.Max(projectedTotal, 1)
+	switch {
+	case net > 0.1*base:
+		return "strong_accept"
+	case net > 0.01*base:
+		return "lean_accept"
+	case net < -0.1*base:
+		return "strong_reject"
+	case net < -0.01*base:
+		return "lean_reject"
+	}
+	return "neutral"
+}
+
+// fairnessScore is 100 when every team gets back as much value as it gives
+// up and 0 when one side gets everything.
+func fairnessScore(sides []*tradeSide) float64 {
+	var moved, imbalance float64
+	for _, s := range sides {
+		moved += s.ValueGiven
+		imbalance += math.Abs(s.net())
+	}
+	if moved <= 0 {
+		return 100
+	}
+	return math.Round(100*math.Max(0, 1-imbalance/(2*moved))*10) / 10
+}
+
+// analyzeLeagueTrade evaluates a set of trade items against the league's
+// current rosters and standings.
+func analyzeLeagueTrade(leagueID int, items []tradeItem) fiber.Map {
+	sides := make(map[int]*tradeSide)
+	var order []*tradeSide
+	side := func(teamID int) *tradeSide {
+		if sides[teamID] == nil {
+			sides[teamID] = &tradeSide{TeamID: teamID, Give: []analyzedMovie{}, Receive: []analyzedMovie{}}
+			order = append(order, sides[teamID])
+		}
+		return sides[teamID]
+	}
+	for _, it := range items {
+		m := loadAnalyzedMovie(it.MovieID)
+		from, to := side(it.FromTeamID), side(it.ToTeamID)
+		from.Give = append(from.Give, m)
+		from.EarnedGiven += m.Points
+		from.RemainGiven += m.Remaining
+		from.VarianceGiven += m.variance()
+		from.ValueGiven += m.value()
+		to.Receive = append(to.Receive, m)
+		to.EarnedRecv += m.Points
+		to.RemainRecv += m.Remaining
+		to.VarianceRecv += m.variance()
+		to.ValueRecv += m.value()
+	}
+
+	before := loadLeagueStandings(leagueID)
+	after := make([]teamStanding, len(before))
+	for i, s := range before {
+		after[i] = s
+		if ts := sides[s.TeamID]; ts != nil {
+			after[i].Points += ts.EarnedRecv - ts.EarnedGiven
+			after[i].Projected += ts.net()
+		}
+	}
+	points := func(s teamStanding) float64 { return s.Points }
+	projected := func(s teamStanding) float64 { return s.Projected }
+	rankNow, rankNowAfter := rankBy(before, points), rankBy(after, points)
+	rankProj, rankProjAfter := rankBy(before, projected), rankBy(after, projected)
+
+	standings := []fiber.Map{}
+	byTeam := make(map[int]fiber.Map)
+	for i, s := range before {
+		row := fiber.Map{
+			"team_id": s.TeamID, "team_name": s.Name,
+			"points_before": s.Points, "points_after": after[i].Points,
+			"rank_before": rankNow[s.TeamID], "rank_after": rankNowAfter[s.TeamID],
+			"projected_points_before": s.Projected, "projected_points_after": after[i].Projected,
+			"projected_rank_before": rankProj[s.TeamID], "projected_rank_after": rankProjAfter[s.TeamID],
+			"projected_rank_change": rankProj[s.TeamID] - rankProjAfter[s.TeamID],
+		}
+		standings = append(standings, row)
+		byTeam[s.TeamID] = row
+	}
+	sort.SliceStable(standings, func(i, j int) bool {
+		return standings[i]["projected_rank_after"].(int) < standings[j]["projected_rank_after"].(int)
+	})
+
+	teams := []fiber.Map{}
+	for _, s := range order {
+		give, recv := []fiber.Map{}, []fiber.Map{}
+		for _, m := range s.Give {
+			give = append(give, m.json())
+		}
+		for _, m := range s.Receive {
+			recv = append(recv, m.json())
+		}
+		projectedTotal := 0.0
+		if row := byTeam[s.TeamID]; row != nil {
+			projectedTotal = row["projected_points_before"].(float64)
+		}
+		teams = append(teams, fiber.Map{
+			"team_id": s.TeamID, "team_name": teamName(s.TeamID),
+			"give": give, "receive": recv,
+			"earned_points_given": s.EarnedGiven, "earned_points_received": s.EarnedRecv,
+			"remaining_points_given": s.RemainGiven, "remaining_points_received": s.RemainRecv,
+			"remaining_points_difference": s.RemainRecv - s.RemainGiven,
+			"value_difference":            s.net(),
+			"risk": fiber.Map{
+				"given_std_dev": math.Sqrt(s.VarianceGiven), "received_std_dev": math.Sqrt(s.VarianceRecv),
+				"level": riskLevel(s.VarianceRecv, s.RemainRecv),
+			},
+			"standings":      byTeam[s.TeamID],
+			"recommendation": tradeRecommendationFor(s.net(), projectedTotal),
+		})
+	}
+
+	return fiber.Map{
+		"league_id": leagueID, "fairness_score": fairnessScore(order),
+		"teams": teams, "projected_standings": standings,
+	}
+}
+
+// analyzeTrade evaluates an existing trade (trade_id) or a proposal in the
+// same shape createTrade accepts. The older give/receive movie ID lists are
+// still accepted for a league-agnostic comparison.
+func analyzeTrade(c *fiber.Ctx) error {
+	userID := getUserID(c)
+	var body struct {
+		tradeProposal
+		TradeID int   `json:"trade_id"`
+		Give    []int `json:"give"`
+		Receive []int `json:"receive"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return newAPIError(400, errTradeInvalidRequest, "Invalid request")
+	}
+
+	if body.TradeID > 0 {
+		t, err := loadTrade(db, body.TradeID)
+		if err != nil {
+			return err
+		}
+		var member int
+		db.QueryRow("SELECT COUNT(*) FROM teams WHERE league_id = ? AND user_id = ?", t.LeagueID, userID).Scan(&member)
+		if member == 0 {
+			return newAPIError(403, errNotInLeague, "You don't have a team in this league")
+		}
+		analysis := analyzeLeagueTrade(t.LeagueID, loadTradeItems(db, t.ID))
+		analysis["trade_id"] = t.ID
+		return c.JSON(analysis)
+	}
+
+	if body.LeagueID > 0 {
+		var teamID int
+		if err := db.QueryRow("SELECT id FROM teams WHERE league_id = ? AND user_id = ?", body.LeagueID, userID).Scan(&teamID); err != nil {
+			return newAPIError(403, errNotInLeague, "You don't have a team in this league")
+		}
+		items := body.tradeItems(teamID, body.ReceiverTeamID)
+		if err := validateTradeProposal(body.LeagueID, teamID, items); err != nil {
+			return err
+		}
+		return c.JSON(analyzeLeagueTrade(body.LeagueID, items))
+	}
+
+	getPoints := func(ids []int) (float64, float64) {
+		var pts, proj float64
+		for _, id := range ids {
+			m := loadAnalyzedMovie(id)
+			pts += m.Points
+			proj += m.Projected
+		}
+		return pts, proj
+	}
+
+	givePts, giveProj := getPoints(body.Give)
+	recvPts, recvProj := getPoints(body.Receive)
+
+	diff := recvPts - givePts
+	projDiff := recvProj - giveProj
+
+	rec := "neutral"
+	if projDiff > 10 {
+		rec = "strong_accept"
+	} else if projDiff > 0 {
+		rec = "lean_accept"
+	} else if projDiff < -10 {
+		rec = "strong_reject"
+	} else if projDiff < 0 {
+		rec = "lean_reject"
+	}
+
+	return c.JSON(fiber.Map{
+		"give_points":          givePts,
+		"receive_points":       recvPts,
+		"point_difference":     diff,
+		"give_projected":       giveProj,
+		"receive_projected":    recvProj,
+		"projected_difference": projDiff,
+		"recommendation":       rec,
+	})
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// --- Trade Review ---
+//
+// Leagues with trade_review_mode "commissioner" or "vote" hold accepted
+// trades in review for trade_review_hours before rosters change. The
+// commissioner can approve or veto at any point; in "vote" mode the other
+// owners can also veto once trade_veto_threshold of them agree, and a trade
+// still standing when the review period ends goes through. In
+// "commissioner" mode nothing goes through on its own: the trade stays in
+// review until a commissioner approves or vetoes it.
+
+const (
+	errTradeNotInReview  = "TRADE_NOT_IN_REVIEW"
+	errTradeReviewClosed = "TRADE_REVIEW_CLOSED"
+)
+
+// startTradeReview moves an accepted trade into review and tells the league.
+// Only a pending trade can start review, so it happens once.
+func startTradeReview(t *tradeRecord, mode string) (string, error) {
+	var hours int
+	db.QueryRow("SELECT trade_review_hours FROM leagues WHERE id = ?", t.LeagueID).Scan(&hours)
+	if hours <= 0 {
+		hours = 48
+	}
+	endsAt := time.Now().Add(time.Duration(hours) * time.Hour)
+	res, err := db.Exec("UPDATE trades SET status = 'in_review', responded_at = CURRENT_TIMESTAMP, review_ends_at = ? WHERE id = ? AND status = 'pending'",
+		sqlTime(endsAt), t.ID)
+	if err != nil {
+		return "", fiber.NewError(500, err.Error())
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", newAPIError(409, errTradeNotPending, "Trade is no longer pending")
+	}
+	t.Status = "in_review"
+
+	summary := fmt.Sprintf("%s agreed to trade #%d", t.teamNames(), t.ID)
+	if mode == "vote" {
+		notifyLeague(t.LeagueID, "trade_review", "Trade Up For Review",
+			summary+". Cast your vote before the review period ends.", t.participantUserIDs()...)
+	} else {
+		notifyLeague(t.LeagueID, "trade_review", "Trade Up For Review",
+			summary+". It will go through once the commissioner approves it.", t.participantUserIDs()...)
+	}
+	return endsAt.UTC().Format(time.RFC3339), nil
+}
+
+// vetoVotesNeeded is the number of veto votes from owners outside the trade
+// that blocks it.
+func vetoVotesNeeded(t *tradeRecord) (needed, eligible int) {
+	var threshold float64
+	db.QueryRow("SELECT trade_veto_threshold FROM leagues WHERE id = ?", t.LeagueID).Scan(&threshold)
+	db.QueryRow("SELECT COUNT(*) FROM teams WHERE league_id = ?", t.LeagueID).Scan(&eligible)
+	eligible -= len(t.Participants)
+	needed = int(math.Ceil(threshold * float64(eligible)))
+	if needed < 1 {
+		needed = 1
+	}
+	return needed, eligible
+}
+
+func tradeReviewJSON(t *tradeRecord) fiber.Map {
+	var vetoes, approvals int
+	db.QueryRow("SELECT COALESCE(SUM(veto), 0), COALESCE(SUM(1 - veto), 0) FROM trade_votes WHERE trade_id = ?", t.ID).
+		Scan(&vetoes, &approvals)
+	needed, eligible := vetoVotesNeeded(t)
+	return fiber.Map{
+		"review_ends_at": t.ReviewEndsAt.String, "veto_votes": vetoes, "approve_votes": approvals,
+		"vetoes_needed": needed, "eligible_voters": eligible,
+	}
+}
+
+// approveTradeReview ends review in the trade's favour and executes it.
+func approveTradeReview(t *tradeRecord, reason string) ([]int, error) {
+	invalidated, err := executeTrade(t)
+	if err != nil {
+		return nil, err
+	}
+	notifyLeague(t.LeagueID, "trade_approved", "Trade Approved",
+		fmt.Sprintf("Trade #%d between %s %s", t.ID, t.teamNames(), reason))
+	return invalidated, nil
+}
+
+// vetoTrade blocks a trade under review and logs the veto against each
+// movie so it shows up in the league's transaction history.
+func vetoTrade(t *tradeRecord, reason string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	res, err := tx.Exec("UPDATE trades SET status = 'vetoed' WHERE id = ? AND status = 'in_review'", t.ID)
+	if err != nil {
+		tx.Rollback()
+		return fiber.NewError(500, err.Error())
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return newAPIError(409, errTradeNotInReview, "Trade is not under review")
+	}
+	for _, it := range loadTradeItems(tx, t.ID) {
+		tx.Exec("INSERT INTO transactions (league_id, team_id, movie_id, type, trade_id) VALUES (?, ?, ?, 'trade_veto', ?)",
+			t.LeagueID, it.FromTeamID, it.MovieID, t.ID)
+	}
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	t.Status = "vetoed"
+
+	notifyLeague(t.LeagueID, "trade_vetoed", "Trade Vetoed",
+		fmt.Sprintf("Trade #%d between %s %s", t.ID, t.teamNames(), reason))
+	return nil
+}
+
+func loadTradeInReview(c *fiber.Ctx) (*tradeRecord, error) {
+	tradeID, _ := strconv.Atoi(c.Params("id"))
+	t, err := loadTrade(db, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if t.Status != "in_review" {
+		return nil, newAPIError(409, errTradeNotInReview, "Trade is not under review").with("trade_status", t.Status)
+	}
+	return t, nil
+}
+
+func approveTrade(c *fiber.Ctx) error {
+	t, err := loadTradeInReview(c)
+	if err != nil {
+		return err
+	}
+	if !isCommissioner(t.LeagueID, getUserID(c)) {
+		return newAPIError(403, errTradeForbidden, "Only the commissioner can approve trades")
+	}
+	if rosterLockedToday(t.LeagueID) {
+		return newAPIError(400, errRosterLocked, "Rosters are locked today").with("date", today())
+	}
+	invalidated, err := approveTradeReview(t, "was approved by the commissioner")
+	if err != nil {
+		return err
+	}
+	logLeagueAction(db, t.LeagueID, getUserID(c), "trade_approved", 0, fmt.Sprintf("Trade #%d between %s was approved", t.ID, t.teamNames()))
+	return c.JSON(fiber.Map{"message": "Trade approved", "status": t.Status, "invalidated_trades": invalidated})
+}
+
+func commissionerVetoTrade(c *fiber.Ctx) error {
+	t, err := loadTradeInReview(c)
+	if err != nil {
+		return err
+	}
+	if !isCommissioner(t.LeagueID, getUserID(c)) {
+		return newAPIError(403, errTradeForbidden, "Only the commissioner can veto trades")
+	}
+	if err := vetoTrade(t, "was vetoed by the commissioner"); err != nil {
+		return err
+	}
+	logLeagueAction(db, t.LeagueID, getUserID(c), "trade_vetoed", 0, fmt.Sprintf("Trade #%d between %s was vetoed", t.ID, t.teamNames()))
+	return c.JSON(fiber.Map{"message": "Trade vetoed", "status": t.Status})
+}
+
+// voteOnTrade records an owner's vote in a league-vote review. Owners who
+// are party to the trade can't vote, and a vote can be changed until the
+// review period ends.
+func voteOnTrade(c *fiber.Ctx) error {
+	userID := getUserID(c)
+	var body struct {
+		Veto *bool `json:"veto"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.Veto == nil {
+		return newAPIError(400, errTradeInvalidRequest, "veto (true or false) required")
+	}
+
+	t, err := loadTradeInReview(c)
+	if err != nil {
+		return err
+	}
+	var mode string
+	db.QueryRow("SELECT trade_review_mode FROM leagues WHERE id = ?", t.LeagueID).Scan(&mode)
+	if mode != "vote" {
+		return newAPIError(400, errTradeForbidden, "This league doesn't vote on trades")
+	}
+	if t.isParticipant(userID) {
+		return newAPIError(403, errTradeForbidden, "Teams in the trade can't vote on it")
+	}
+	// A trade whose review has ended is only waiting to be processed.
+	var closed bool
+	db.QueryRow("SELECT review_ends_at <= datetime('now') FROM trades WHERE id = ?", t.ID).Scan(&closed)
+	if closed {
+		return newAPIError(409, errTradeReviewClosed, "Voting on this trade has closed").with("review_ends_at", t.ReviewEndsAt.String)
+	}
+	var teamID int
+	if err := db.QueryRow("SELECT id FROM teams WHERE league_id = ? AND user_id = ?", t.LeagueID, userID).Scan(&teamID); err != nil {
+		return newAPIError(403, errNotInLeague, "You don't have a team in this league")
+	}
+
+	db.Exec(`INSERT INTO trade_votes (trade_id, team_id, veto) VALUES (?, ?, ?)
+		ON CONFLICT(trade_id, team_id) DO UPDATE SET veto = excluded.veto, created_at = CURRENT_TIMESTAMP`,
+		t.ID, teamID, *body.Veto)
+
+	var vetoes int
+	db.QueryRow("SELECT COUNT(*) FROM trade_votes WHERE trade_id = ? AND veto = 1", t.ID).Scan(&vetoes)
+	if needed, _ := vetoVotesNeeded(t); vetoes >= needed {
+		if err := vetoTrade(t, "was vetoed by a league vote"); err != nil {
+			return err
+		}
+	}
+
+	return c.JSON(fiber.Map{"message": "Vote recorded", "status": t.Status, "review": tradeReviewJSON(t)})
+}
+
+// processTradeReviews lets trades in vote-reviewed leagues whose review
+// period has ended without a veto go through. Trades agreed before the
+// trade deadline still clear review after it. Trades awaiting a
+// commissioner are left alone.
+func processTradeReviews() {
+	rows, err := db.Query(`SELECT t.id FROM trades t JOIN leagues l ON l.id = t.league_id
+		WHERE t.status = 'in_review' AND t.review_ends_at <= datetime('now') AND l.trade_review_mode = 'vote'`)
+	if err != nil {
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		t, err := loadTrade(db, id)
+		if err != nil {
+			continue
+		}
+		// Trades clearing review on a roster lock date wait for the next
+		// unlocked day.
+		if rosterLockedToday(t.LeagueID) {
+			continue
+		}
+		if _, err := approveTradeReview(t, "cleared the review period"); err != nil {
+			log.Printf("Trade %d failed after review: %v", id, err)
+			// Database errors are worth another try on the next run; a trade
+			// that breaks the league's rules will never go through.
+			if _, ok := err.(*apiError); ok {
+				failTradeReview(t, err)
+			}
+		}
+	}
+}
+
+// failTradeReview closes a trade that cleared review but can't be carried
+// out, and tells the teams in it why.
+func failTradeReview(t *tradeRecord, reason error) {
+	res, err := db.Exec("UPDATE trades SET status = 'invalid' WHERE id = ? AND status = 'in_review'", t.ID)
+	if err != nil {
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+	t.Status = "invalid"
+	t.notifyParticipants("trade_invalid", "Trade Invalidated",
+		fmt.Sprintf("Trade #%d cleared review but couldn't go through: %s", t.ID, reason.Error()), 0)
+}
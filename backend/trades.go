@@ -0,0 +1,906 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Trade error codes returned in the "code" field of error responses.
+const (
+	errTradeInvalidRequest  = "TRADE_INVALID_REQUEST"
+	errTradeEmpty           = "TRADE_EMPTY"
+	errTradeSelf            = "TRADE_SELF"
+	errTradeDuplicateMovie  = "TRADE_DUPLICATE_MOVIE"
+	errTradeProposerMissing = "TRADE_PROPOSER_NOT_INCLUDED"
+	errTradeNotFound        = "TRADE_NOT_FOUND"
+	errTradeNotPending      = "TRADE_NOT_PENDING"
+	errTradeExpired         = "TRADE_EXPIRED"
+	errTradeAlreadyAnswered = "TRADE_ALREADY_ANSWERED"
+	errTradeForbidden       = "TRADE_FORBIDDEN"
+	errLeagueNotFound       = "LEAGUE_NOT_FOUND"
+	errLeagueNotActive      = "LEAGUE_NOT_ACTIVE"
+	errNotInLeague          = "NOT_IN_LEAGUE"
+	errTeamNotInLeague      = "TEAM_NOT_IN_LEAGUE"
+	errMovieNotOwned        = "MOVIE_NOT_OWNED"
+)
+
+// tradeItem moves one movie from one team to another. A trade can involve
+// any number of teams; each participant gives and/or receives items.
+type tradeItem struct {
+	FromTeamID int `json:"from_team_id"`
+	ToTeamID   int `json:"to_team_id"`
+	MovieID    int `json:"movie_id"`
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx so validation can run
+// either up front or inside the transaction that applies a trade.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// requireActiveLeague rejects trades in leagues that are still drafting or
+// already finished.
+func requireActiveLeague(q queryer, leagueID int) error {
+	var status string
+	if err := q.QueryRow("SELECT status FROM leagues WHERE id = ?", leagueID).Scan(&status); err != nil {
+		return newAPIError(404, errLeagueNotFound, "League not found")
+	}
+	if status != "active" {
+		return newAPIError(400, errLeagueNotActive, "Trades are only allowed while the league is active").
+			with("league_status", status)
+	}
+	return nil
+}
+
+// validateTradeItems checks that every movie is still on the roster of the
+// team giving it up and that no movie appears twice.
+func validateTradeItems(q queryer, items []tradeItem) error {
+	seen := make(map[int]bool)
+	for _, it := range items {
+		if seen[it.MovieID] {
+			return newAPIError(400, errTradeDuplicateMovie, "A movie can only appear once in a trade").
+				with("movie_id", it.MovieID)
+		}
+		seen[it.MovieID] = true
+
+		var owned int
+		q.QueryRow("SELECT COUNT(*) FROM roster WHERE team_id = ? AND movie_id = ?", it.FromTeamID, it.MovieID).Scan(&owned)
+		if owned == 0 {
+			return newAPIError(409, errMovieNotOwned, "Movie is not on the roster of the team trading it").
+				with("team_id", it.FromTeamID).with("movie_id", it.MovieID)
+		}
+	}
+	return nil
+}
+
+// validateTradeProposal checks the shape of a new trade: every team is in
+// the league, the proposer takes part, and no team sends a movie to itself.
+// Ownership is then checked per item.
+func validateTradeProposal(leagueID, proposerTeamID int, items []tradeItem) error {
+	if len(items) == 0 {
+		return newAPIError(400, errTradeEmpty, "A trade must include at least one movie")
+	}
+	inLeague := make(map[int]bool)
+	proposerIncluded := false
+	for _, it := range items {
+		if it.FromTeamID == it.ToTeamID {
+			return newAPIError(400, errTradeSelf, "A team can't trade a movie to itself").with("movie_id", it.MovieID)
+		}
+		for _, teamID := range []int{it.FromTeamID, it.ToTeamID} {
+			if teamID == proposerTeamID {
+				proposerIncluded = true
+			}
+			if _, checked := inLeague[teamID]; !checked {
+				var teamLeagueID int
+				db.QueryRow("SELECT league_id FROM teams WHERE id = ?", teamID).Scan(&teamLeagueID)
+				inLeague[teamID] = teamLeagueID == leagueID
+			}
+			if !inLeague[teamID] {
+				return newAPIError(400, errTeamNotInLeague, "Team is not in this league").with("team_id", teamID)
+			}
+		}
+	}
+	if !proposerIncluded {
+		return newAPIError(400, errTradeProposerMissing, "Your team must give or receive at least one movie")
+	}
+	if err := validateTradeItems(db, items); err != nil {
+		return err
+	}
+	return checkTradeRosters(db, items)
+}
+
+// checkTradeRosters checks every team's roster would still be within the
+// league's roster rules after the trade.
+func checkTradeRosters(q queryer, items []tradeItem) error {
+	adds := make(map[int][]int)
+	removes := make(map[int][]int)
+	var teams []int
+	for _, it := range items {
+		for _, teamID := range []int{it.FromTeamID, it.ToTeamID} {
+			if adds[teamID] == nil && removes[teamID] == nil {
+				teams = append(teams, teamID)
+				adds[teamID], removes[teamID] = []int{}, []int{}
+			}
+		}
+		removes[it.FromTeamID] = append(removes[it.FromTeamID], it.MovieID)
+		adds[it.ToTeamID] = append(adds[it.ToTeamID], it.MovieID)
+	}
+	for _, teamID := range teams {
+		if err := checkRosterChange(q, teamID, adds[teamID], removes[teamID]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadTradeItems(q queryer, tradeID int) []tradeItem {
+	rows, err := q.Query("SELECT team_id, to_team_id, movie_id FROM trade_items WHERE trade_id = ?", tradeID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var items []tradeItem
+	for rows.Next() {
+		var it tradeItem
+		rows.Scan(&it.FromTeamID, &it.ToTeamID, &it.MovieID)
+		items = append(items, it)
+	}
+	return items
+}
+
+// tradeParticipant is a team taking part in a trade and its answer so far.
+// The proposer is recorded as accepted when the trade is created.
+type tradeParticipant struct {
+	TeamID, UserID int
+	Status         string
+}
+
+type tradeRecord struct {
+	ID, LeagueID             int
+	ProposerTeamID           int
+	ProposerUserID           int
+	Status, Note, ProposedAt string
+	ParentTradeID            sql.NullInt64
+	ExpiresAt, ReviewEndsAt  sql.NullString
+	Expired                  bool
+	Participants             []tradeParticipant
+}
+
+func loadTrade(q queryer, tradeID int) (*tradeRecord, error) {
+	var t tradeRecord
+	err := q.QueryRow(`SELECT t.id, t.league_id, t.proposer_team_id, p.user_id,
+		t.status, t.note, t.proposed_at, t.parent_trade_id, t.expires_at, t.review_ends_at,
+		t.expires_at IS NOT NULL AND t.expires_at <= datetime('now')
+		FROM trades t JOIN teams p ON p.id = t.proposer_team_id
+		WHERE t.id = ?`, tradeID).
+		Scan(&t.ID, &t.LeagueID, &t.ProposerTeamID, &t.ProposerUserID,
+			&t.Status, &t.Note, &t.ProposedAt, &t.ParentTradeID, &t.ExpiresAt, &t.ReviewEndsAt, &t.Expired)
+	if err != nil {
+		return nil, newAPIError(404, errTradeNotFound, "Trade not found")
+	}
+
+	rows, err := q.Query(`SELECT tt.team_id, tm.user_id, tt.status FROM trade_teams tt JOIN teams tm ON tm.id = tt.team_id
+		WHERE tt.trade_id = ? ORDER BY tt.team_id != ?, tt.id`, tradeID, t.ProposerTeamID)
+	if err != nil {
+		return nil, fiber.NewError(500, err.Error())
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p tradeParticipant
+		rows.Scan(&p.TeamID, &p.UserID, &p.Status)
+		t.Participants = append(t.Participants, p)
+	}
+	return &t, nil
+}
+
+// requirePending checks that a trade can still be acted on, expiring it on
+// the spot if its window has passed before the background sweep got to it.
+func (t *tradeRecord) requirePending() error {
+	if t.Status == "pending" && t.Expired {
+		expireTrade(t)
+		t.Status = "expired"
+	}
+	if t.Status != "pending" {
+		code := errTradeNotPending
+		if t.Status == "expired" {
+			code = errTradeExpired
+		}
+		return newAPIError(409, code, "Trade is no longer pending").with("trade_status", t.Status)
+	}
+	return nil
+}
+
+func (t *tradeRecord) participant(userID int) *tradeParticipant {
+	for i := range t.Participants {
+		if t.Participants[i].UserID == userID {
+			return &t.Participants[i]
+		}
+	}
+	return nil
+}
+
+func (t *tradeRecord) isParticipant(userID int) bool {
+	return t.participant(userID) != nil
+}
+
+func (t *tradeRecord) participantUserIDs() []int {
+	ids := make([]int, len(t.Participants))
+	for i, p := range t.Participants {
+		ids[i] = p.UserID
+	}
+	return ids
+}
+
+// teamNames lists the participating teams for notification text, e.g.
+// "Reel Deal, Popcorn Kings and Box Office Bandits".
+func (t *tradeRecord) teamNames() string {
+	names := make([]string, len(t.Participants))
+	for i, p := range t.Participants {
+		names[i] = teamName(p.TeamID)
+	}
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// notifyParticipants notifies every team in the trade except exceptUserID.
+func (t *tradeRecord) notifyParticipants(nType, title, body string, exceptUserID int) {
+	for _, p := range t.Participants {
+		if p.UserID != exceptUserID {
+			createNotification(p.UserID, nType, title, body, t.LeagueID)
+		}
+	}
+}
+
+// respondent returns the calling user's participant entry if they are one
+// of the teams being asked to agree to the trade.
+func (t *tradeRecord) respondent(userID int, action string) (*tradeParticipant, error) {
+	p := t.participant(userID)
+	if p == nil || p.TeamID == t.ProposerTeamID {
+		return nil, newAPIError(403, errTradeForbidden, "Only teams receiving this offer can "+action+" it")
+	}
+	return p, nil
+}
+
+func teamName(teamID int) string {
+	var name string
+	db.QueryRow("SELECT name FROM teams WHERE id = ?", teamID).Scan(&name)
+	return name
+}
+
+// tradeProposal is the request body for proposing or countering a trade.
+// Items may name any teams in the league; the offer/request lists are a
+// shorthand for a two-team trade with receiver_team_id. Set analyze to get
+// the trade analysis back with the new trade.
+type tradeProposal struct {
+	LeagueID        int         `json:"league_id"`
+	ReceiverTeamID  int         `json:"receiver_team_id"`
+	OfferMovieIDs   []int       `json:"offer_movie_ids"`
+	RequestMovieIDs []int       `json:"request_movie_ids"`
+	Items           []tradeItem `json:"items"`
+	Note            string      `json:"note"`
+	Analyze         bool        `json:"analyze"`
+}
+
+func (b *tradeProposal) tradeItems(proposerTeamID, receiverTeamID int) []tradeItem {
+	items := append([]tradeItem{}, b.Items...)
+	for _, mid := range b.OfferMovieIDs {
+		items = append(items, tradeItem{FromTeamID: proposerTeamID, ToTeamID: receiverTeamID, MovieID: mid})
+	}
+	for _, mid := range b.RequestMovieIDs {
+		items = append(items, tradeItem{FromTeamID: receiverTeamID, ToTeamID: proposerTeamID, MovieID: mid})
+	}
+	return items
+}
+
+// insertTrade stores a new pending trade, its items and its participating
+// teams. The offer expires after the league's trade_expiry_hours, if set.
+func insertTrade(leagueID, proposerTeamID int, items []tradeItem, note string, parentTradeID int) (int, error) {
+	var expiryHours int
+	db.QueryRow("SELECT trade_expiry_hours FROM leagues WHERE id = ?", leagueID).Scan(&expiryHours)
+	var expiresAt, parent interface{}
+	if expiryHours > 0 {
+		expiresAt = sqlTime(time.Now().Add(time.Duration(expiryHours) * time.Hour))
+	}
+	if parentTradeID > 0 {
+		parent = parentTradeID
+	}
+
+	var others []int
+	seen := map[int]bool{proposerTeamID: true}
+	for _, it := range items {
+		for _, teamID := range []int{it.FromTeamID, it.ToTeamID} {
+			if !seen[teamID] {
+				seen[teamID] = true
+				others = append(others, teamID)
+			}
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	// receiver_team_id keeps pointing at the first counterparty so two-team
+	// trades read the same as before multi-team support.
+	res, err := tx.Exec("INSERT INTO trades (league_id, proposer_team_id, receiver_team_id, note, expires_at, parent_trade_id) VALUES (?, ?, ?, ?, ?, ?)",
+		leagueID, proposerTeamID, others[0], note, expiresAt, parent)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	tradeID, _ := res.LastInsertId()
+	for _, it := range items {
+		tx.Exec("INSERT INTO trade_items (trade_id, team_id, to_team_id, movie_id) VALUES (?, ?, ?, ?)", tradeID, it.FromTeamID, it.ToTeamID, it.MovieID)
+	}
+	tx.Exec("INSERT INTO trade_teams (trade_id, team_id, status, responded_at) VALUES (?, ?, 'accepted', CURRENT_TIMESTAMP)", tradeID, proposerTeamID)
+	for _, teamID := range others {
+		tx.Exec("INSERT INTO trade_teams (trade_id, team_id) VALUES (?, ?)", tradeID, teamID)
+	}
+	return int(tradeID), tx.Commit()
+}
+
+func createTrade(c *fiber.Ctx) error {
+	userID := getUserID(c)
+	var body tradeProposal
+	if err := c.BodyParser(&body); err != nil {
+		return newAPIError(400, errTradeInvalidRequest, "Invalid request")
+	}
+
+	if err := requireActiveLeague(db, body.LeagueID); err != nil {
+		return err
+	}
+	if err := requireTransactionWindow(body.LeagueID, "trade"); err != nil {
+		return err
+	}
+
+	// Find proposer team
+	var proposerTeamID int
+	err := db.QueryRow("SELECT id FROM teams WHERE league_id = ? AND user_id = ?", body.LeagueID, userID).Scan(&proposerTeamID)
+	if err != nil {
+		return newAPIError(403, errNotInLeague, "You don't have a team in this league")
+	}
+
+	items := body.tradeItems(proposerTeamID, body.ReceiverTeamID)
+	if err := validateTradeProposal(body.LeagueID, proposerTeamID, items); err != nil {
+		return err
+	}
+
+	tradeID, err := insertTrade(body.LeagueID, proposerTeamID, items, body.Note, 0)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+
+	t, _ := loadTrade(db, tradeID)
+	t.notifyParticipants("trade_proposed", "New Trade Offer",
+		teamName(proposerTeamID)+" sent you a trade offer", userID)
+
+	out := fiber.Map{"id": tradeID, "status": "pending"}
+	if body.Analyze {
+		out["analysis"] = analyzeLeagueTrade(body.LeagueID, items)
+	}
+	return c.Status(201).JSON(out)
+}
+
+// acceptTrade records one team's acceptance. Once every participant has
+// accepted, the trade goes to league review or executes straight away.
+func acceptTrade(c *fiber.Ctx) error {
+	tradeID, _ := strconv.Atoi(c.Params("id"))
+	userID := getUserID(c)
+
+	t, err := loadTrade(db, tradeID)
+	if err != nil {
+		return err
+	}
+	p, err := t.respondent(userID, "accept")
+	if err != nil {
+		return err
+	}
+	if err := t.requirePending(); err != nil {
+		return err
+	}
+	if p.Status != "pending" {
+		return newAPIError(409, errTradeAlreadyAnswered, "You have already answered this trade")
+	}
+	if err := requireActiveLeague(db, t.LeagueID); err != nil {
+		return err
+	}
+	if err := requireTransactionWindow(t.LeagueID, "trade"); err != nil {
+		return err
+	}
+	if err := validateTradeItems(db, loadTradeItems(db, tradeID)); err != nil {
+		invalidateTrade(tradeID)
+		return err
+	}
+
+	// The acceptance and the check for teams still to answer share a
+	// transaction, so when the last teams accept together exactly one of
+	// them sees nobody left and moves the trade on.
+	tx, err := db.Begin()
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	res, err := tx.Exec("UPDATE trade_teams SET status = 'accepted', responded_at = CURRENT_TIMESTAMP WHERE trade_id = ? AND team_id = ? AND status = 'pending'",
+		tradeID, p.TeamID)
+	if err != nil {
+		tx.Rollback()
+		return fiber.NewError(500, err.Error())
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return newAPIError(409, errTradeAlreadyAnswered, "You have already answered this trade")
+	}
+	waitingOn := []int{}
+	rows, err := tx.Query("SELECT team_id FROM trade_teams WHERE trade_id = ? AND status = 'pending' ORDER BY team_id", tradeID)
+	if err != nil {
+		tx.Rollback()
+		return fiber.NewError(500, err.Error())
+	}
+	for rows.Next() {
+		var teamID int
+		rows.Scan(&teamID)
+		waitingOn = append(waitingOn, teamID)
+	}
+	rows.Close()
+	if err := tx.Commit(); err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	p.Status = "accepted"
+
+	if len(waitingOn) > 0 {
+		t.notifyParticipants("trade_accepted", "Trade Accepted",
+			fmt.Sprintf("%s accepted trade #%d. Waiting on the other teams.", teamName(p.TeamID), tradeID), userID)
+		return c.JSON(fiber.Map{"message": "Trade accepted", "status": "pending", "waiting_on": waitingOn})
+	}
+
+	var mode string
+	db.QueryRow("SELECT trade_review_mode FROM leagues WHERE id = ?", t.LeagueID).Scan(&mode)
+	if mode == "commissioner" || mode == "vote" {
+		reviewEndsAt, err := startTradeReview(t, mode)
+		if err != nil {
+			return err
+		}
+		t.notifyParticipants("trade_accepted", "Trade Accepted",
+			fmt.Sprintf("All teams accepted trade #%d. It is now under league review.", tradeID), userID)
+		return c.JSON(fiber.Map{"message": "Trade accepted and sent to league review", "status": "in_review", "review_ends_at": reviewEndsAt})
+	}
+
+	invalidated, err := executeTrade(t)
+	if err != nil {
+		return err
+	}
+	t.notifyParticipants("trade_accepted", "Trade Accepted",
+		fmt.Sprintf("All teams accepted trade #%d and rosters have been updated", tradeID), userID)
+	return c.JSON(fiber.Map{"message": "Trade accepted", "status": "accepted", "invalidated_trades": invalidated})
+}
+
+// executeTrade moves the movies in an agreed trade and marks it accepted.
+// Ownership is re-checked inside the transaction so a movie dropped or
+// traded elsewhere since the proposal can't be moved; the trade is
+// invalidated instead.
+func executeTrade(t *tradeRecord) ([]int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fiber.NewError(500, err.Error())
+	}
+	items := loadTradeItems(tx, t.ID)
+	if err := requireActiveLeague(tx, t.LeagueID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := validateTradeItems(tx, items); err != nil {
+		tx.Rollback()
+		invalidateTrade(t.ID)
+		return nil, err
+	}
+	if err := checkTradeRosters(tx, items); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	res, err := tx.Exec("UPDATE trades SET status = 'accepted', responded_at = COALESCE(responded_at, CURRENT_TIMESTAMP) WHERE id = ? AND status IN ('pending', 'in_review')", t.ID)
+	if err != nil {
+		tx.Rollback()
+		return nil, fiber.NewError(500, err.Error())
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return nil, newAPIError(409, errTradeNotPending, "Trade is no longer pending")
+	}
+
+	for _, it := range items {
+		tx.Exec("DELETE FROM roster WHERE team_id = ? AND movie_id = ?", it.FromTeamID, it.MovieID)
+		tx.Exec("INSERT OR IGNORE INTO roster (team_id, movie_id, acquisition_type) VALUES (?, ?, 'trade')", it.ToTeamID, it.MovieID)
+		tx.Exec("INSERT INTO transactions (league_id, team_id, movie_id, type, trade_id) VALUES (?, ?, ?, 'trade', ?)", t.LeagueID, it.ToTeamID, it.MovieID, t.ID)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fiber.NewError(500, err.Error())
+	}
+	t.Status = "accepted"
+
+	return invalidateConflictingTrades(t.LeagueID, t.ID, items), nil
+}
+
+// invalidateConflictingTrades marks other open trades in the league that
+// include any of the moved movies as invalid, since they can no longer be
+// executed as proposed.
+func invalidateConflictingTrades(leagueID, tradeID int, moved []tradeItem) []int {
+	if len(moved) == 0 {
+		return []int{}
+	}
+	placeholders := make([]string, len(moved))
+	args := []interface{}{leagueID, tradeID}
+	for i, it := range moved {
+		placeholders[i] = "?"
+		args = append(args, it.MovieID)
+	}
+	rows, err := db.Query(`SELECT DISTINCT t.id FROM trades t JOIN trade_items ti ON ti.trade_id = t.id
+		WHERE t.league_id = ? AND t.status IN ('pending', 'in_review') AND t.id != ? AND ti.movie_id IN (`+strings.Join(placeholders, ",")+`)`, args...)
+	if err != nil {
+		return []int{}
+	}
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		invalidateTrade(id)
+	}
+	return ids
+}
+
+// invalidateTrade marks an open trade invalid and tells every team why.
+func invalidateTrade(tradeID int) {
+	res, _ := db.Exec("UPDATE trades SET status = 'invalid' WHERE id = ? AND status IN ('pending', 'in_review')", tradeID)
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+	t, err := loadTrade(db, tradeID)
+	if err != nil {
+		return
+	}
+	t.notifyParticipants("trade_invalid", "Trade Invalidated",
+		fmt.Sprintf("Trade #%d can no longer be completed because a movie in it has changed hands", tradeID), 0)
+}
+
+// rejectTrade lets any team being asked to agree turn the trade down, which
+// closes it for everyone.
+func rejectTrade(c *fiber.Ctx) error {
+	tradeID, _ := strconv.Atoi(c.Params("id"))
+	userID := getUserID(c)
+
+	t, err := loadTrade(db, tradeID)
+	if err != nil {
+		return err
+	}
+	p, err := t.respondent(userID, "reject")
+	if err != nil {
+		return err
+	}
+	if err := t.requirePending(); err != nil {
+		return err
+	}
+
+	db.Exec("UPDATE trades SET status = 'rejected', responded_at = CURRENT_TIMESTAMP WHERE id = ? AND status = 'pending'", tradeID)
+	db.Exec("UPDATE trade_teams SET status = 'rejected', responded_at = CURRENT_TIMESTAMP WHERE trade_id = ? AND team_id = ?", tradeID, p.TeamID)
+	t.notifyParticipants("trade_rejected", "Trade Rejected",
+		fmt.Sprintf("%s rejected trade #%d", teamName(p.TeamID), tradeID), userID)
+	return c.JSON(fiber.Map{"message": "Trade rejected"})
+}
+
+// cancelTrade lets the proposer withdraw an offer that hasn't been answered.
+func cancelTrade(c *fiber.Ctx) error {
+	tradeID, _ := strconv.Atoi(c.Params("id"))
+	userID := getUserID(c)
+
+	t, err := loadTrade(db, tradeID)
+	if err != nil {
+		return err
+	}
+	if t.ProposerUserID != userID {
+		return newAPIError(403, errTradeForbidden, "Only the proposing team can cancel")
+	}
+	if err := t.requirePending(); err != nil {
+		return err
+	}
+
+	db.Exec("UPDATE trades SET status = 'cancelled', responded_at = CURRENT_TIMESTAMP WHERE id = ? AND status = 'pending'", tradeID)
+	t.notifyParticipants("trade_cancelled", "Trade Withdrawn",
+		teamName(t.ProposerTeamID)+" withdrew their trade offer", userID)
+	return c.JSON(fiber.Map{"message": "Trade cancelled"})
+}
+
+// counterTrade closes the original offer as countered and opens a new one
+// proposed by the countering team. The offer/request shorthand is from the
+// countering team's point of view against the original proposer.
+func counterTrade(c *fiber.Ctx) error {
+	tradeID, _ := strconv.Atoi(c.Params("id"))
+	userID := getUserID(c)
+	var body tradeProposal
+	if err := c.BodyParser(&body); err != nil {
+		return newAPIError(400, errTradeInvalidRequest, "Invalid request")
+	}
+
+	t, err := loadTrade(db, tradeID)
+	if err != nil {
+		return err
+	}
+	p, err := t.respondent(userID, "counter")
+	if err != nil {
+		return err
+	}
+	if err := t.requirePending(); err != nil {
+		return err
+	}
+	if err := requireActiveLeague(db, t.LeagueID); err != nil {
+		return err
+	}
+	if err := requireTransactionWindow(t.LeagueID, "trade"); err != nil {
+		return err
+	}
+
+	items := body.tradeItems(p.TeamID, t.ProposerTeamID)
+	if err := validateTradeProposal(t.LeagueID, p.TeamID, items); err != nil {
+		return err
+	}
+
+	res, _ := db.Exec("UPDATE trades SET status = 'countered', responded_at = CURRENT_TIMESTAMP WHERE id = ? AND status = 'pending'", tradeID)
+	if n, _ := res.RowsAffected(); n == 0 {
+		return newAPIError(409, errTradeNotPending, "Trade is no longer pending")
+	}
+	counterID, err := insertTrade(t.LeagueID, p.TeamID, items, body.Note, t.ID)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+
+	counter, _ := loadTrade(db, counterID)
+	notified := map[int]bool{userID: true}
+	for _, other := range append(t.Participants, counter.Participants...) {
+		if !notified[other.UserID] {
+			notified[other.UserID] = true
+			createNotification(other.UserID, "trade_countered", "Counteroffer Received",
+				fmt.Sprintf("%s countered trade #%d", teamName(p.TeamID), tradeID), t.LeagueID)
+		}
+	}
+
+	out := fiber.Map{"id": counterID, "status": "pending", "parent_trade_id": t.ID}
+	if body.Analyze {
+		out["analysis"] = analyzeLeagueTrade(t.LeagueID, items)
+	}
+	return c.Status(201).JSON(out)
+}
+
+// expireTrade closes an offer whose response window has passed.
+func expireTrade(t *tradeRecord) {
+	res, _ := db.Exec("UPDATE trades SET status = 'expired' WHERE id = ? AND status = 'pending'", t.ID)
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+	t.notifyParticipants("trade_expired", "Trade Expired",
+		fmt.Sprintf("Trade offer from %s expired before every team answered", teamName(t.ProposerTeamID)), 0)
+}
+
+func expireTrades() {
+	rows, err := db.Query("SELECT id FROM trades WHERE status = 'pending' AND expires_at IS NOT NULL AND expires_at <= datetime('now')")
+	if err != nil {
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if t, err := loadTrade(db, id); err == nil {
+			expireTrade(t)
+		}
+	}
+	if len(ids) > 0 {
+		log.Printf("Expired %d trade offers", len(ids))
+	}
+}
+
+// scheduledTradeJobs expires unanswered offers and closes review periods.
+func scheduledTradeJobs() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+	for {
+		<-ticker.C
+		expireTrades()
+		processTradeReviews()
+	}
+}
+
+// tradeJSON renders a trade with its participating teams and items.
+func tradeJSON(t *tradeRecord) fiber.Map {
+	rows, _ := db.Query(`SELECT ti.team_id, ti.to_team_id, ti.movie_id, m.title, m.poster_url, m.points, m.projected_points
+		FROM trade_items ti JOIN movies m ON m.id = ti.movie_id WHERE ti.trade_id = ?`, t.ID)
+	items := []fiber.Map{}
+	if rows != nil {
+		for rows.Next() {
+			var fromTeamID, toTeamID, movieID int
+			var title, poster string
+			var pts, proj float64
+			rows.Scan(&fromTeamID, &toTeamID, &movieID, &title, &poster, &pts, &proj)
+			items = append(items, fiber.Map{
+				"team_id": fromTeamID, "from_team_id": fromTeamID, "to_team_id": toTeamID,
+				"movie_id": movieID, "movie_title": title, "poster_url": poster,
+				"points": pts, "projected_points": proj,
+			})
+		}
+		rows.Close()
+	}
+
+	teams := []fiber.Map{}
+	receiverTeamID := 0
+	for _, p := range t.Participants {
+		teams = append(teams, fiber.Map{
+			"team_id": p.TeamID, "team_name": teamName(p.TeamID), "status": p.Status,
+			"proposer": p.TeamID == t.ProposerTeamID,
+		})
+		if receiverTeamID == 0 && p.TeamID != t.ProposerTeamID {
+			receiverTeamID = p.TeamID
+		}
+	}
+
+	var counterID sql.NullInt64
+	db.QueryRow("SELECT id FROM trades WHERE parent_trade_id = ?", t.ID).Scan(&counterID)
+
+	out := fiber.Map{
+		"id": t.ID, "league_id": t.LeagueID, "status": t.Status, "note": t.Note, "proposed_at": t.ProposedAt,
+		"proposer_team_id": t.ProposerTeamID, "proposer_team_name": teamName(t.ProposerTeamID),
+		"receiver_team_id": receiverTeamID, "receiver_team_name": teamName(receiverTeamID),
+		"teams": teams, "items": items, "expires_at": nil, "parent_trade_id": nil, "counter_trade_id": nil,
+	}
+	if t.ExpiresAt.Valid {
+		out["expires_at"] = t.ExpiresAt.String
+	}
+	if t.ParentTradeID.Valid {
+		out["parent_trade_id"] = t.ParentTradeID.Int64
+	}
+	if counterID.Valid {
+		out["counter_trade_id"] = counterID.Int64
+	}
+	if t.ReviewEndsAt.Valid {
+		out["review"] = tradeReviewJSON(t)
+	}
+	return out
+}
+
+func getTrade(c *fiber.Ctx) error {
+	tradeID, _ := strconv.Atoi(c.Params("id"))
+	userID := getUserID(c)
+
+	t, err := loadTrade(db, tradeID)
+	if err != nil {
+		return err
+	}
+	var member int
+	db.QueryRow("SELECT COUNT(*) FROM teams WHERE league_id = ? AND user_id = ?", t.LeagueID, userID).Scan(&member)
+	if member == 0 {
+		return newAPIError(403, errNotInLeague, "You don't have a team in this league")
+	}
+	return c.JSON(tradeJSON(t))
+}
+
+func getLeagueTrades(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	status := c.Query("status")
+
+	query := "SELECT id FROM trades WHERE league_id = ?"
+	args := []interface{}{leagueID}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY proposed_at DESC, id DESC LIMIT 100"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	trades := []fiber.Map{}
+	for _, id := range ids {
+		if t, err := loadTrade(db, id); err == nil {
+			trades = append(trades, tradeJSON(t))
+		}
+	}
+	return c.JSON(trades)
+}
+
+// --- Trade Messages ---
+
+func getTradeMessages(c *fiber.Ctx) error {
+	tradeID, _ := strconv.Atoi(c.Params("id"))
+	userID := getUserID(c)
+
+	t, err := loadTrade(db, tradeID)
+	if err != nil {
+		return err
+	}
+	if !t.isParticipant(userID) {
+		return newAPIError(403, errTradeForbidden, "Only teams in this trade can read its messages")
+	}
+
+	// Messages on earlier offers in a counter chain stay visible.
+	rows, err := db.Query(`WITH RECURSIVE chain(id, parent) AS (
+			SELECT id, parent_trade_id FROM trades WHERE id = ?
+			UNION ALL SELECT t.id, t.parent_trade_id FROM trades t JOIN chain ON t.id = chain.parent
+		)
+		SELECT tm.id, tm.trade_id, tm.user_id, u.display_name, tm.message, tm.created_at
+		FROM trade_messages tm JOIN users u ON u.id = tm.user_id
+		WHERE tm.trade_id IN (SELECT id FROM chain) ORDER BY tm.id`, tradeID)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	defer rows.Close()
+
+	messages := []fiber.Map{}
+	for rows.Next() {
+		var id, tid, uid int
+		var name, msg, createdAt string
+		rows.Scan(&id, &tid, &uid, &name, &msg, &createdAt)
+		messages = append(messages, fiber.Map{
+			"id": id, "trade_id": tid, "user_id": uid, "display_name": name,
+			"message": msg, "created_at": createdAt,
+		})
+	}
+	return c.JSON(messages)
+}
+
+func sendTradeMessage(c *fiber.Ctx) error {
+	tradeID, _ := strconv.Atoi(c.Params("id"))
+	userID := getUserID(c)
+	var body struct {
+		Message string `json:"message"`
+	}
+	if err := c.BodyParser(&body); err != nil || strings.TrimSpace(body.Message) == "" {
+		return newAPIError(400, errTradeInvalidRequest, "Message required")
+	}
+
+	t, err := loadTrade(db, tradeID)
+	if err != nil {
+		return err
+	}
+	p := t.participant(userID)
+	if p == nil {
+		return newAPIError(403, errTradeForbidden, "Only teams in this trade can message about it")
+	}
+
+	res, err := db.Exec("INSERT INTO trade_messages (trade_id, user_id, message) VALUES (?, ?, ?)", tradeID, userID, body.Message)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	msgID, _ := res.LastInsertId()
+
+	t.notifyParticipants("trade_message", "Trade Message",
+		fmt.Sprintf("%s commented on trade #%d", teamName(p.TeamID), tradeID), userID)
+
+	return c.Status(201).JSON(fiber.Map{
+		"id": msgID, "trade_id": tradeID, "user_id": userID, "message": body.Message,
+		"created_at": time.Now().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,729 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// --- Waivers ---
+//
+// Leagues run waivers in one of two modes (waiver_mode):
+//
+//   - "faab": claims are sealed free agent acquisition budget bids. Each
+//     team spends from the league's faab_budget over the season. Claims wait
+//     for the league's weekly waiver run (waiver_run_day and waiver_run_hour,
+//     UTC), which awards each movie to the highest bid. Ties go to the team
+//     with the better waiver priority.
+//   - "rolling": free agents are added straight away. Movies still on
+//     waivers go to the claiming team with the best waiver priority when
+//     their waiver period ends, and that team drops to the back of the order.
+//     A movie with claims pending stays on waivers until they are processed.
+//
+// Waiver priority starts as the reverse of the first-round draft order.
+//
+// A dropped movie sits on waivers for the league's waiver_period_hours
+// before anyone can pick it up. A claim can name a movie to drop, which
+// happens only if the claim wins. A team's own claims are tried in order of
+// their priority (lowest first). Runs follow the league calendar (see
+// calendar.go): claims wait out roster lock dates, and fail once the waiver
+// cutoff has passed.
+
+const (
+	errWaiverInvalidRequest = "WAIVER_INVALID_REQUEST"
+	errWaiverNotFound       = "WAIVER_NOT_FOUND"
+	errWaiverNotPending     = "WAIVER_NOT_PENDING"
+	errWaiverDuplicateClaim = "WAIVER_DUPLICATE_CLAIM"
+	errWaiverBidTooHigh     = "WAIVER_BID_TOO_HIGH"
+	errWaiverForbidden      = "WAIVER_FORBIDDEN"
+	errWaiverNoBids         = "WAIVER_NO_BIDS"
+	errMovieNotFound        = "MOVIE_NOT_FOUND"
+	errMovieRostered        = "MOVIE_ROSTERED"
+	errMovieNotEligible     = "MOVIE_NOT_ELIGIBLE"
+)
+
+// faabRemaining is what a team has left to bid this season.
+func faabRemaining(q queryer, teamID int) int {
+	var remaining int
+	q.QueryRow(`SELECT MAX(l.faab_budget - t.faab_spent, 0) FROM teams t JOIN leagues l ON l.id = t.league_id
+		WHERE t.id = ?`, teamID).Scan(&remaining)
+	return remaining
+}
+
+// movieRosteredInLeague reports whether any team in the league holds the movie.
+func movieRosteredInLeague(q queryer, leagueID, movieID int) bool {
+	var n int
+	q.QueryRow(`SELECT COUNT(*) FROM roster r JOIN teams t ON t.id = r.team_id
+		WHERE t.league_id = ? AND r.movie_id = ?`, leagueID, movieID).Scan(&n)
+	return n > 0
+}
+
+// putOnWaivers starts a dropped movie's waiver period.
+func putOnWaivers(ex execer, leagueID, teamID, movieID int) {
+	var hours int
+	db.QueryRow("SELECT waiver_period_hours FROM leagues WHERE id = ?", leagueID).Scan(&hours)
+	if hours <= 0 {
+		return
+	}
+	ex.Exec("INSERT INTO waiver_wire (league_id, movie_id, dropped_by_team_id, available_at) VALUES (?, ?, ?, ?)",
+		leagueID, movieID, teamID, sqlTime(time.Now().Add(time.Duration(hours)*time.Hour)))
+}
+
+// pendingWaiverClaims counts the league's unprocessed claims on a movie.
+func pendingWaiverClaims(q queryer, leagueID, movieID int) int {
+	var n int
+	q.QueryRow("SELECT COUNT(*) FROM waiver_claims WHERE league_id = ? AND movie_id = ? AND status = 'pending'", leagueID, movieID).Scan(&n)
+	return n
+}
+
+// onWaiversUntil returns when a movie clears waivers, if it is on them now.
+func onWaiversUntil(q queryer, leagueID, movieID int) (time.Time, bool) {
+	var until time.Time
+	err := q.QueryRow(`SELECT available_at FROM waiver_wire WHERE league_id = ? AND movie_id = ? AND available_at > datetime('now')
+		ORDER BY available_at DESC LIMIT 1`, leagueID, movieID).Scan(&until)
+	return until, err == nil
+}
+
+func leagueWaiverMode(leagueID int) string {
+	var mode string
+	db.QueryRow("SELECT waiver_mode FROM leagues WHERE id = ?", leagueID).Scan(&mode)
+	return mode
+}
+
+// lastWaiverRun is the most recent scheduled run at or before now.
+func lastWaiverRun(now time.Time, weekday, hour int) time.Time {
+	now = now.UTC()
+	run := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, time.UTC)
+	run = run.AddDate(0, 0, -((int(now.Weekday()) - weekday + 7) % 7))
+	if run.After(now) {
+		run = run.AddDate(0, 0, -7)
+	}
+	return run
+}
+
+func nextWaiverRun(now time.Time, weekday, hour int) time.Time {
+	return lastWaiverRun(now, weekday, hour).AddDate(0, 0, 7)
+}
+
+func leagueWaiverSchedule(leagueID int) (weekday, hour int) {
+	db.QueryRow("SELECT waiver_run_day, waiver_run_hour FROM leagues WHERE id = ?", leagueID).Scan(&weekday, &hour)
+	return weekday, hour
+}
+
+func claimWaiver(c *fiber.Ctx) error {
+	userID := getUserID(c)
+	var body struct {
+		LeagueID    int `json:"league_id"`
+		MovieID     int `json:"movie_id"`
+		DropMovieID int `json:"drop_movie_id"`
+		Bid         int `json:"bid"`
+		Priority    int `json:"priority"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return newAPIError(400, errWaiverInvalidRequest, "Invalid request")
+	}
+	if body.Bid < 0 {
+		return newAPIError(400, errWaiverInvalidRequest, "Bid can't be negative")
+	}
+
+	var teamID int
+	err := db.QueryRow("SELECT id FROM teams WHERE league_id = ? AND user_id = ?", body.LeagueID, userID).Scan(&teamID)
+	if err != nil {
+		return newAPIError(403, errNotInLeague, "You don't have a team in this league")
+	}
+	if err := requireActiveLeague(db, body.LeagueID); err != nil {
+		return err
+	}
+	if err := requireTransactionWindow(body.LeagueID, "waiver"); err != nil {
+		return err
+	}
+
+	var releaseDate, seasonStart, seasonEnd string
+	if err := db.QueryRow("SELECT COALESCE(release_date, '') FROM movies WHERE id = ?", body.MovieID).Scan(&releaseDate); err != nil {
+		return newAPIError(404, errMovieNotFound, "Movie not found")
+	}
+	db.QueryRow("SELECT season_start, season_end FROM leagues WHERE id = ?", body.LeagueID).Scan(&seasonStart, &seasonEnd)
+	if releaseDate < seasonStart || releaseDate > seasonEnd {
+		return newAPIError(400, errMovieNotEligible, "Movie release date is outside this league's season window").with("movie_id", body.MovieID)
+	}
+	if movieRosteredInLeague(db, body.LeagueID, body.MovieID) {
+		return newAPIError(409, errMovieRostered, "Movie is already on a roster in this league").with("movie_id", body.MovieID)
+	}
+	if body.DropMovieID > 0 {
+		var owned int
+		db.QueryRow("SELECT COUNT(*) FROM roster WHERE team_id = ? AND movie_id = ?", teamID, body.DropMovieID).Scan(&owned)
+		if owned == 0 {
+			return newAPIError(409, errMovieNotOwned, "Movie to drop is not on your roster").with("movie_id", body.DropMovieID)
+		}
+	}
+	var drop []int
+	if body.DropMovieID > 0 {
+		drop = []int{body.DropMovieID}
+	}
+	if err := checkRosterChange(db, teamID, []int{body.MovieID}, drop); err != nil {
+		return err
+	}
+	mode := leagueWaiverMode(body.LeagueID)
+	if mode == "rolling" && body.Bid > 0 {
+		return newAPIError(400, errWaiverNoBids, "This league uses rolling waivers, not bids")
+	}
+	if remaining := faabRemaining(db, teamID); mode == "faab" && body.Bid > remaining {
+		return newAPIError(400, errWaiverBidTooHigh, "Bid is more than your remaining budget").with("faab_remaining", remaining)
+	}
+	var dup int
+	db.QueryRow("SELECT COUNT(*) FROM waiver_claims WHERE team_id = ? AND movie_id = ? AND status = 'pending'", teamID, body.MovieID).Scan(&dup)
+	if dup > 0 {
+		return newAPIError(409, errWaiverDuplicateClaim, "You already have a pending claim for this movie")
+	}
+
+	var dropMovieID interface{}
+	if body.DropMovieID > 0 {
+		dropMovieID = body.DropMovieID
+	}
+	clearsAt, onWaivers := onWaiversUntil(db, body.LeagueID, body.MovieID)
+	// A movie other teams have claimed stays on waivers until those claims
+	// are processed, even once its waiver period is over.
+	if mode == "rolling" && !onWaivers && pendingWaiverClaims(db, body.LeagueID, body.MovieID) > 0 {
+		clearsAt, onWaivers = time.Now(), true
+	}
+
+	// Rolling leagues hand out free agents first come, first served.
+	if mode == "rolling" && !onWaivers {
+		tx, err := db.Begin()
+		if err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+		if movieRosteredInLeague(tx, body.LeagueID, body.MovieID) {
+			tx.Rollback()
+			return newAPIError(409, errMovieRostered, "Movie is already on a roster in this league").with("movie_id", body.MovieID)
+		}
+		if body.DropMovieID > 0 {
+			tx.Exec("DELETE FROM roster WHERE team_id = ? AND movie_id = ?", teamID, body.DropMovieID)
+			tx.Exec("INSERT INTO transactions (league_id, team_id, movie_id, type) VALUES (?, ?, ?, 'drop')", body.LeagueID, teamID, body.DropMovieID)
+			putOnWaivers(tx, body.LeagueID, teamID, body.DropMovieID)
+		}
+		tx.Exec("INSERT INTO roster (team_id, movie_id, acquisition_type) VALUES (?, ?, 'waiver')", teamID, body.MovieID)
+		tx.Exec("INSERT INTO transactions (league_id, team_id, movie_id, type) VALUES (?, ?, ?, 'waiver')", body.LeagueID, teamID, body.MovieID)
+		res, _ := tx.Exec(`INSERT INTO waiver_claims (league_id, team_id, movie_id, drop_movie_id, priority, status, result, processed_at)
+			VALUES (?, ?, ?, ?, ?, 'won', 'Free agent pickup', CURRENT_TIMESTAMP)`,
+			body.LeagueID, teamID, body.MovieID, dropMovieID, body.Priority)
+		if err := tx.Commit(); err != nil {
+			return fiber.NewError(500, err.Error())
+		}
+		claimID, _ := res.LastInsertId()
+		invalidated := []int{}
+		if body.DropMovieID > 0 {
+			invalidated = invalidateConflictingTrades(body.LeagueID, 0, []tradeItem{{FromTeamID: teamID, MovieID: body.DropMovieID}})
+		}
+		return c.Status(201).JSON(fiber.Map{"id": claimID, "status": "won", "message": "Free agent added", "invalidated_trades": invalidated})
+	}
+
+	res, err := db.Exec("INSERT INTO waiver_claims (league_id, team_id, movie_id, drop_movie_id, bid, priority, status) VALUES (?, ?, ?, ?, ?, ?, 'pending')",
+		body.LeagueID, teamID, body.MovieID, dropMovieID, body.Bid, body.Priority)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	claimID, _ := res.LastInsertId()
+
+	processesAt := clearsAt
+	if mode == "faab" {
+		weekday, hour := leagueWaiverSchedule(body.LeagueID)
+		from := time.Now()
+		if onWaivers {
+			from = clearsAt
+		}
+		processesAt = nextWaiverRun(from, weekday, hour)
+	}
+	return c.Status(201).JSON(fiber.Map{
+		"id": claimID, "status": "pending", "bid": body.Bid,
+		"processes_at": processesAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// cancelWaiverClaim withdraws one of the caller's pending claims.
+func cancelWaiverClaim(c *fiber.Ctx) error {
+	claimID, _ := strconv.Atoi(c.Params("id"))
+	userID := getUserID(c)
+
+	var status string
+	var ownerID int
+	err := db.QueryRow("SELECT w.status, t.user_id FROM waiver_claims w JOIN teams t ON t.id = w.team_id WHERE w.id = ?", claimID).
+		Scan(&status, &ownerID)
+	if err != nil {
+		return newAPIError(404, errWaiverNotFound, "Waiver claim not found")
+	}
+	if ownerID != userID {
+		return newAPIError(403, errWaiverForbidden, "Not your waiver claim")
+	}
+	if status != "pending" {
+		return newAPIError(409, errWaiverNotPending, "Waiver claim has already been processed").with("claim_status", status)
+	}
+
+	db.Exec("UPDATE waiver_claims SET status = 'cancelled', processed_at = CURRENT_TIMESTAMP WHERE id = ? AND status = 'pending'", claimID)
+	return c.JSON(fiber.Map{"message": "Waiver claim cancelled"})
+}
+
+// getLeagueWaivers lists the league's claims. Bids are sealed: other teams'
+// pending claims are hidden until the waiver run.
+func getLeagueWaivers(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	userID := getUserID(c)
+	rows, _ := db.Query(`SELECT w.id, w.team_id, w.movie_id, w.status, w.claimed_at, w.bid, w.drop_movie_id, w.result,
+		t.name as team_name, m.title as movie_title
+		FROM waiver_claims w
+		JOIN teams t ON t.id = w.team_id
+		JOIN movies m ON m.id = w.movie_id
+		WHERE w.league_id = ? AND (w.status != 'pending' OR t.user_id = ?) ORDER BY w.claimed_at DESC`, leagueID, userID)
+	defer rows.Close()
+
+	var waivers []fiber.Map
+	for rows.Next() {
+		var id, teamID, movieID, bid int
+		var status, claimedAt, teamName, movieTitle, result string
+		var dropMovieID sql.NullInt64
+		rows.Scan(&id, &teamID, &movieID, &status, &claimedAt, &bid, &dropMovieID, &result, &teamName, &movieTitle)
+		w := fiber.Map{
+			"id": id, "team_id": teamID, "movie_id": movieID, "status": status,
+			"claimed_at": claimedAt, "team_name": teamName, "movie_title": movieTitle,
+			"bid": bid, "drop_movie_id": nil, "result": result,
+		}
+		if dropMovieID.Valid {
+			w["drop_movie_id"] = dropMovieID.Int64
+		}
+		waivers = append(waivers, w)
+	}
+	if waivers == nil {
+		waivers = []fiber.Map{}
+	}
+	return c.JSON(waivers)
+}
+
+// processWaiversHandler lets the commissioner run waivers now instead of
+// waiting for the scheduled run.
+func processWaiversHandler(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	if !isCommissioner(leagueID, getUserID(c)) {
+		return newAPIError(403, errWaiverForbidden, "Only the commissioner can run waivers")
+	}
+	if err := requireActiveLeague(db, leagueID); err != nil {
+		return err
+	}
+	var results []fiber.Map
+	var err error
+	if leagueWaiverMode(leagueID) == "rolling" {
+		results, err = processRollingWaivers(leagueID)
+	} else {
+		results, err = processWaivers(leagueID, time.Now())
+	}
+	if _, ok := err.(*apiError); ok {
+		return err
+	}
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	return c.JSON(fiber.Map{"message": "Waivers processed", "results": results})
+}
+
+type waiverClaim struct {
+	ID, TeamID, MovieID, Bid, Priority int
+	// WaiverPriority is the claiming team's place in the waiver order.
+	WaiverPriority int
+	DropMovieID    sql.NullInt64
+	UserID         int
+	MovieTitle     string
+}
+
+// orderFAABClaims sorts claims into the order a FAAB run tries them: highest
+// bid first, ties to the team with the better waiver priority. A team's own
+// claims go in the order it gave them, then oldest first.
+func orderFAABClaims(claims []waiverClaim) {
+	sort.SliceStable(claims, func(i, j int) bool {
+		a, b := claims[i], claims[j]
+		switch {
+		case a.Bid != b.Bid:
+			return a.Bid > b.Bid
+		case a.WaiverPriority != b.WaiverPriority:
+			return a.WaiverPriority < b.WaiverPriority
+		case a.Priority != b.Priority:
+			return a.Priority < b.Priority
+		}
+		return a.ID < b.ID
+	})
+}
+
+// processWaivers resolves every pending FAAB claim in the league placed up
+// to cutoff, highest bid first with ties to the better waiver priority.
+// Claims on movies still on waivers at cutoff wait for a later run.
+func processWaivers(leagueID int, cutoff time.Time) ([]fiber.Map, error) {
+	if closed, err := checkWaiverWindow(leagueID); err != nil || closed != nil {
+		return closed, err
+	}
+	initWaiverPriority(leagueID)
+	rows, err := db.Query(`SELECT w.id, w.team_id, w.movie_id, w.bid, w.priority, t.waiver_priority, w.drop_movie_id, t.user_id, m.title
+		FROM waiver_claims w JOIN teams t ON t.id = w.team_id JOIN movies m ON m.id = w.movie_id
+		WHERE w.league_id = ? AND w.status = 'pending' AND w.claimed_at <= ?
+		AND NOT EXISTS (SELECT 1 FROM waiver_wire ww WHERE ww.league_id = w.league_id AND ww.movie_id = w.movie_id AND ww.available_at > ?)`,
+		leagueID, sqlTime(cutoff), sqlTime(cutoff))
+	if err != nil {
+		return nil, err
+	}
+	var claims []waiverClaim
+	for rows.Next() {
+		var w waiverClaim
+		rows.Scan(&w.ID, &w.TeamID, &w.MovieID, &w.Bid, &w.Priority, &w.WaiverPriority, &w.DropMovieID, &w.UserID, &w.MovieTitle)
+		claims = append(claims, w)
+	}
+	rows.Close()
+	orderFAABClaims(claims)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	results := []fiber.Map{}
+	for _, w := range claims {
+		switch {
+		case movieRosteredInLeague(tx, leagueID, w.MovieID):
+			results = append(results, resolveWaiverClaim(tx, w, "lost", "Outbid or claimed by another team"))
+		case w.Bid > faabRemaining(tx, w.TeamID):
+			results = append(results, resolveWaiverClaim(tx, w, "failed", "Not enough budget left"))
+		default:
+			results = append(results, awardWaiverClaim(tx, leagueID, w, fmt.Sprintf("Won for $%d", w.Bid)))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	invalidateWaiverDropTrades(leagueID, claims, results)
+	announceWaiverResults(leagueID, claims, results)
+	return results, nil
+}
+
+// checkWaiverWindow checks the league calendar before a waiver run. On a
+// roster lock date the run waits and the lock comes back as the error. Once
+// the waiver cutoff or the season end has passed no run can award the
+// league's pending claims, so they fail and their results are returned.
+func checkWaiverWindow(leagueID int) ([]fiber.Map, error) {
+	cal, err := loadLeagueCalendar(leagueID)
+	if err != nil {
+		return nil, err
+	}
+	closed := cal.allows("waiver")
+	if closed == nil {
+		return nil, nil
+	}
+	if e, ok := closed.(*apiError); ok && e.Code == errRosterLocked {
+		return nil, closed
+	}
+
+	rows, err := db.Query(`SELECT w.id, w.team_id, w.movie_id, w.bid, w.priority, w.drop_movie_id, t.user_id, m.title
+		FROM waiver_claims w JOIN teams t ON t.id = w.team_id JOIN movies m ON m.id = w.movie_id
+		WHERE w.league_id = ? AND w.status = 'pending' ORDER BY w.id`, leagueID)
+	if err != nil {
+		return nil, err
+	}
+	var claims []waiverClaim
+	for rows.Next() {
+		var w waiverClaim
+		rows.Scan(&w.ID, &w.TeamID, &w.MovieID, &w.Bid, &w.Priority, &w.DropMovieID, &w.UserID, &w.MovieTitle)
+		claims = append(claims, w)
+	}
+	rows.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	results := []fiber.Map{}
+	for _, w := range claims {
+		results = append(results, resolveWaiverClaim(tx, w, "failed", closed.Error()))
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	announceWaiverResults(leagueID, claims, results)
+	return results, nil
+}
+
+func resolveWaiverClaim(tx *sql.Tx, w waiverClaim, status, result string) fiber.Map {
+	tx.Exec("UPDATE waiver_claims SET status = ?, result = ?, processed_at = CURRENT_TIMESTAMP WHERE id = ?", status, result, w.ID)
+	return fiber.Map{
+		"claim_id": w.ID, "team_id": w.TeamID, "movie_id": w.MovieID, "movie_title": w.MovieTitle,
+		"bid": w.Bid, "status": status, "result": result,
+	}
+}
+
+// awardWaiverClaim gives the claimed movie to the team, dropping the named
+// movie first. The claim fails if that movie has left the roster since.
+func awardWaiverClaim(tx *sql.Tx, leagueID int, w waiverClaim, result string) fiber.Map {
+	var drop []int
+	if w.DropMovieID.Valid {
+		drop = []int{int(w.DropMovieID.Int64)}
+	}
+	if err := checkRosterChange(tx, w.TeamID, []int{w.MovieID}, drop); err != nil {
+		return resolveWaiverClaim(tx, w, "failed", err.Error())
+	}
+	if w.DropMovieID.Valid {
+		res, _ := tx.Exec("DELETE FROM roster WHERE team_id = ? AND movie_id = ?", w.TeamID, w.DropMovieID.Int64)
+		if n, _ := res.RowsAffected(); n == 0 {
+			return resolveWaiverClaim(tx, w, "failed", "Movie to drop is no longer on the roster")
+		}
+		tx.Exec("INSERT INTO transactions (league_id, team_id, movie_id, type) VALUES (?, ?, ?, 'drop')", leagueID, w.TeamID, w.DropMovieID.Int64)
+		putOnWaivers(tx, leagueID, w.TeamID, int(w.DropMovieID.Int64))
+	}
+	tx.Exec("INSERT INTO roster (team_id, movie_id, acquisition_type) VALUES (?, ?, 'waiver')", w.TeamID, w.MovieID)
+	tx.Exec("INSERT INTO transactions (league_id, team_id, movie_id, type) VALUES (?, ?, ?, 'waiver')", leagueID, w.TeamID, w.MovieID)
+	tx.Exec("UPDATE teams SET faab_spent = faab_spent + ? WHERE id = ?", w.Bid, w.TeamID)
+	return resolveWaiverClaim(tx, w, "won", result)
+}
+
+// invalidateWaiverDropTrades closes open trades that include a movie a
+// winning claim dropped, as dropping it by hand does.
+func invalidateWaiverDropTrades(leagueID int, claims []waiverClaim, results []fiber.Map) {
+	var dropped []tradeItem
+	for i, w := range claims {
+		if w.DropMovieID.Valid && results[i]["status"] == "won" {
+			dropped = append(dropped, tradeItem{FromTeamID: w.TeamID, MovieID: int(w.DropMovieID.Int64)})
+		}
+	}
+	invalidateConflictingTrades(leagueID, 0, dropped)
+}
+
+// announceWaiverResults notifies each claimant and pushes the results to the
+// league event stream.
+func announceWaiverResults(leagueID int, claims []waiverClaim, results []fiber.Map) {
+	for i, w := range claims {
+		r := results[i]
+		switch r["status"] {
+		case "won":
+			createNotification(w.UserID, "waiver_won", "Waiver Claim Won",
+				fmt.Sprintf("You won %s (%s)", w.MovieTitle, r["result"]), leagueID)
+		default:
+			createNotification(w.UserID, "waiver_lost", "Waiver Claim Unsuccessful",
+				fmt.Sprintf("Your claim for %s was unsuccessful: %s", w.MovieTitle, r["result"]), leagueID)
+		}
+	}
+	if len(results) > 0 {
+		broadcastLeagueEvent(leagueID, fiber.Map{"type": "waivers_processed", "league_id": leagueID, "results": results})
+	}
+}
+
+// processRollingWaivers resolves claims on movies whose waiver period has
+// ended. Each movie goes to the valid claim from the team with the best
+// waiver priority, and that team moves to the back of the order.
+func processRollingWaivers(leagueID int) ([]fiber.Map, error) {
+	if closed, err := checkWaiverWindow(leagueID); err != nil || closed != nil {
+		return closed, err
+	}
+	initWaiverPriority(leagueID)
+	rows, err := db.Query(`SELECT w.id, w.team_id, w.movie_id, w.bid, w.priority, w.drop_movie_id, t.user_id, m.title
+		FROM waiver_claims w JOIN teams t ON t.id = w.team_id JOIN movies m ON m.id = w.movie_id
+		WHERE w.league_id = ? AND w.status = 'pending'
+		AND NOT EXISTS (SELECT 1 FROM waiver_wire ww WHERE ww.league_id = w.league_id AND ww.movie_id = w.movie_id AND ww.available_at > datetime('now'))
+		ORDER BY w.id`, leagueID)
+	if err != nil {
+		return nil, err
+	}
+	var claims []waiverClaim
+	for rows.Next() {
+		var w waiverClaim
+		rows.Scan(&w.ID, &w.TeamID, &w.MovieID, &w.Bid, &w.Priority, &w.DropMovieID, &w.UserID, &w.MovieTitle)
+		claims = append(claims, w)
+	}
+	rows.Close()
+	if len(claims) == 0 {
+		return []fiber.Map{}, nil
+	}
+
+	order := waiverPriorityOrder(leagueID)
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	resolved := make(map[int]fiber.Map)
+	order = resolveRollingClaims(order, claims, func(w waiverClaim) bool {
+		if movieRosteredInLeague(tx, leagueID, w.MovieID) {
+			resolved[w.ID] = resolveWaiverClaim(tx, w, "lost", "Claimed by a team with higher waiver priority")
+			return false
+		}
+		resolved[w.ID] = awardWaiverClaim(tx, leagueID, w, "Won on waivers")
+		return resolved[w.ID]["status"] == "won"
+	})
+	for i, teamID := range order {
+		tx.Exec("UPDATE teams SET waiver_priority = ? WHERE id = ?", i+1, teamID)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	results := make([]fiber.Map, len(claims))
+	for i, w := range claims {
+		results[i] = resolved[w.ID]
+	}
+	invalidateWaiverDropTrades(leagueID, claims, results)
+	announceWaiverResults(leagueID, claims, results)
+	return results, nil
+}
+
+// resolveRollingClaims decides claims in waiver order: next up is always the
+// best-placed team with a claim left, with its own top choice. decide
+// reports whether a claim won; winners move to the back of the order, which
+// is returned.
+func resolveRollingClaims(order []int, claims []waiverClaim, decide func(w waiverClaim) bool) []int {
+	done := make(map[int]bool)
+	for {
+		var next *waiverClaim
+		for _, teamID := range order {
+			for i := range claims {
+				w := &claims[i]
+				if w.TeamID != teamID || done[w.ID] {
+					continue
+				}
+				if next == nil || w.Priority < next.Priority {
+					next = w
+				}
+			}
+			if next != nil {
+				break
+			}
+		}
+		if next == nil {
+			return order
+		}
+		done[next.ID] = true
+		if decide(*next) {
+			order = moveToBack(order, next.TeamID)
+		}
+	}
+}
+
+func moveToBack(order []int, teamID int) []int {
+	out := make([]int, 0, len(order))
+	for _, id := range order {
+		if id != teamID {
+			out = append(out, id)
+		}
+	}
+	return append(out, teamID)
+}
+
+// waiverPriorityOrder lists the league's teams from first to last waiver
+// priority.
+func waiverPriorityOrder(leagueID int) []int {
+	rows, err := db.Query("SELECT id FROM teams WHERE league_id = ? ORDER BY waiver_priority, id", leagueID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var order []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		order = append(order, id)
+	}
+	return order
+}
+
+// initWaiverPriority gives a league its starting waiver order, the reverse
+// of the first-round draft order, unless it already has one. Teams without
+// a draft pick go last.
+func initWaiverPriority(leagueID int) {
+	var unset int
+	db.QueryRow("SELECT COUNT(*) FROM teams WHERE league_id = ? AND waiver_priority = 0", leagueID).Scan(&unset)
+	if unset == 0 {
+		return
+	}
+	rows, err := db.Query(`SELECT t.id FROM teams t
+		LEFT JOIN draft_picks dp ON dp.team_id = t.id AND dp.league_id = t.league_id AND dp.round = 1
+		WHERE t.league_id = ? ORDER BY dp.pick_number IS NULL, dp.pick_number DESC, t.id`, leagueID)
+	if err != nil {
+		return
+	}
+	var order []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		order = append(order, id)
+	}
+	rows.Close()
+	for i, teamID := range order {
+		db.Exec("UPDATE teams SET waiver_priority = ? WHERE id = ?", i+1, teamID)
+	}
+}
+
+func getWaiverPriority(c *fiber.Ctx) error {
+	leagueID, _ := strconv.Atoi(c.Params("id"))
+	initWaiverPriority(leagueID)
+
+	rows, err := db.Query(`SELECT t.id, t.name, t.waiver_priority, MAX(l.faab_budget - t.faab_spent, 0)
+		FROM teams t JOIN leagues l ON l.id = t.league_id WHERE t.league_id = ? ORDER BY t.waiver_priority, t.id`, leagueID)
+	if err != nil {
+		return fiber.NewError(500, err.Error())
+	}
+	defer rows.Close()
+
+	teams := []fiber.Map{}
+	for rows.Next() {
+		var teamID, priority, faab int
+		var name string
+		rows.Scan(&teamID, &name, &priority, &faab)
+		teams = append(teams, fiber.Map{"team_id": teamID, "team_name": name, "priority": priority, "faab_remaining": faab})
+	}
+	return c.JSON(fiber.Map{"league_id": leagueID, "waiver_mode": leagueWaiverMode(leagueID), "teams": teams})
+}
+
+// scheduledWaiverRuns processes waiver claims as they come due: FAAB claims
+// at the first weekly run after they were placed, rolling claims when the
+// movie's waiver period ends.
+func scheduledWaiverRuns() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+	for {
+		<-ticker.C
+		runDueWaivers(time.Now())
+	}
+}
+
+func runDueWaivers(now time.Time) {
+	rows, err := db.Query(`SELECT DISTINCT l.id, l.waiver_mode, l.waiver_run_day, l.waiver_run_hour FROM leagues l
+		JOIN waiver_claims w ON w.league_id = l.id
+		WHERE l.status = 'active' AND w.status = 'pending'`)
+	if err != nil {
+		return
+	}
+	type due struct {
+		leagueID, weekday, hour int
+		mode                    string
+	}
+	var leagues []due
+	for rows.Next() {
+		var d due
+		rows.Scan(&d.leagueID, &d.mode, &d.weekday, &d.hour)
+		leagues = append(leagues, d)
+	}
+	rows.Close()
+
+	for _, d := range leagues {
+		// Claims due on a roster lock date wait for the next unlocked day.
+		if rosterLockedToday(d.leagueID) {
+			continue
+		}
+		var results []fiber.Map
+		var err error
+		if d.mode == "rolling" {
+			results, err = processRollingWaivers(d.leagueID)
+		} else {
+			results, err = processWaivers(d.leagueID, lastWaiverRun(now, d.weekday, d.hour))
+		}
+		if err != nil {
+			log.Printf("Waiver run for league %d failed: %v", d.leagueID, err)
+		} else if len(results) > 0 {
+			log.Printf("Processed %d waiver claims in league %d", len(results), d.leagueID)
+		}
+	}
+}
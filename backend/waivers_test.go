@@ -0,0 +1,141 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveRollingClaims(t *testing.T) {
+	tests := []struct {
+		name      string
+		order     []int
+		claims    []waiverClaim
+		wantWon   []int
+		wantOrder []int
+	}{
+		{
+			name:  "best priority wins and moves to the back",
+			order: []int{1, 2, 3},
+			claims: []waiverClaim{
+				{ID: 10, TeamID: 3, MovieID: 100, Priority: 1},
+				{ID: 11, TeamID: 1, MovieID: 100, Priority: 1},
+			},
+			wantWon:   []int{11},
+			wantOrder: []int{2, 3, 1},
+		},
+		{
+			name:  "a team's own claims go in priority order",
+			order: []int{1, 2},
+			claims: []waiverClaim{
+				{ID: 10, TeamID: 1, MovieID: 100, Priority: 2},
+				{ID: 11, TeamID: 1, MovieID: 101, Priority: 1},
+				{ID: 12, TeamID: 2, MovieID: 101, Priority: 1},
+			},
+			wantWon:   []int{11, 10},
+			wantOrder: []int{2, 1},
+		},
+		{
+			name:  "the back of the order gets another turn after others win",
+			order: []int{1, 2, 3},
+			claims: []waiverClaim{
+				{ID: 10, TeamID: 1, MovieID: 100, Priority: 1},
+				{ID: 11, TeamID: 1, MovieID: 101, Priority: 2},
+				{ID: 12, TeamID: 2, MovieID: 101, Priority: 1},
+			},
+			wantWon:   []int{10, 12},
+			wantOrder: []int{3, 1, 2},
+		},
+		{
+			name:  "losing claims keep their place",
+			order: []int{1, 2, 3},
+			claims: []waiverClaim{
+				{ID: 10, TeamID: 1, MovieID: 999, Priority: 1},
+				{ID: 11, TeamID: 2, MovieID: 100, Priority: 1},
+			},
+			wantWon:   []int{11},
+			wantOrder: []int{1, 3, 2},
+		},
+		{
+			name:      "no claims",
+			order:     []int{1, 2},
+			wantOrder: []int{1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Movie 999 is already rostered; every other movie goes to the
+			// first claim that reaches it.
+			taken := map[int]bool{999: true}
+			var won []int
+			order := resolveRollingClaims(tt.order, tt.claims, func(w waiverClaim) bool {
+				if taken[w.MovieID] {
+					return false
+				}
+				taken[w.MovieID] = true
+				won = append(won, w.ID)
+				return true
+			})
+			if !reflect.DeepEqual(won, tt.wantWon) {
+				t.Errorf("won = %v, want %v", won, tt.wantWon)
+			}
+			if !reflect.DeepEqual(order, tt.wantOrder) {
+				t.Errorf("order = %v, want %v", order, tt.wantOrder)
+			}
+		})
+	}
+}
+
+func TestOrderFAABClaims(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims []waiverClaim
+		want   []int
+	}{
+		{
+			name: "highest bid first",
+			claims: []waiverClaim{
+				{ID: 1, Bid: 5, WaiverPriority: 1},
+				{ID: 2, Bid: 12, WaiverPriority: 3},
+				{ID: 3, Bid: 0, WaiverPriority: 2},
+			},
+			want: []int{2, 1, 3},
+		},
+		{
+			name: "tied bids go to the better waiver priority",
+			claims: []waiverClaim{
+				{ID: 1, Bid: 10, WaiverPriority: 3, Priority: 1},
+				{ID: 2, Bid: 10, WaiverPriority: 1, Priority: 5},
+				{ID: 3, Bid: 10, WaiverPriority: 2, Priority: 1},
+			},
+			want: []int{2, 3, 1},
+		},
+		{
+			name: "a team's own claim priority breaks its ties",
+			claims: []waiverClaim{
+				{ID: 1, Bid: 10, WaiverPriority: 1, Priority: 2},
+				{ID: 2, Bid: 10, WaiverPriority: 1, Priority: 1},
+			},
+			want: []int{2, 1},
+		},
+		{
+			name: "then the earlier claim",
+			claims: []waiverClaim{
+				{ID: 7, Bid: 3, WaiverPriority: 2},
+				{ID: 4, Bid: 3, WaiverPriority: 2},
+			},
+			want: []int{4, 7},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderFAABClaims(tt.claims)
+			var got []int
+			for _, w := range tt.claims {
+				got = append(got, w.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -95,16 +95,27 @@ func (r *draftRoom) autoPick() {
 		return
 	}
 
-	// Pick highest-budget available movie
-	var movieID int
-	err = db.QueryRow(`SELECT m.id FROM movies m WHERE m.id NOT IN 
+	// Pick highest-budget available movie that fits the team's roster
+	rows, err := db.Query(`SELECT m.id FROM movies m WHERE m.id NOT IN 
 		(SELECT movie_id FROM draft_picks WHERE league_id = ? AND movie_id IS NOT NULL)
-		ORDER BY m.budget DESC LIMIT 1`, r.leagueID).Scan(&movieID)
+		ORDER BY m.budget DESC`, r.leagueID)
 	if err != nil {
 		return
 	}
+	var candidates []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		candidates = append(candidates, id)
+	}
+	rows.Close()
 
-	r.executePick(pickID, teamID, movieID, true)
+	for _, movieID := range candidates {
+		if checkRosterChange(db, teamID, []int{movieID}, nil) == nil {
+			r.executePick(pickID, teamID, movieID, true)
+			return
+		}
+	}
 }
 
 func (r *draftRoom) executePick(pickID, teamID, movieID int, isAuto bool) {
@@ -119,6 +130,9 @@ func (r *draftRoom) executePick(pickID, teamID, movieID int, isAuto bool) {
 		tx.Exec("UPDATE leagues SET status = 'active' WHERE id = ?", r.leagueID)
 	}
 	tx.Commit()
+	if remaining == 0 {
+		finishDraft(r.leagueID)
+	}
 
 	// Get movie title
 	var title string
@@ -163,21 +177,20 @@ func setupWebSocketRoutes(app *fiber.App) {
 		return fiber.ErrUpgradeRequired
 	})
 
-	app.Get("/ws/draft/:leagueId", websocket.New(handleDraftWS))
-	app.Get("/ws/chat/:leagueId", websocket.New(handleChatWS))
+	// Draft and event streams are visible to anyone who can see the league;
+	// chat is for members only.
+	app.Get("/ws/draft/:leagueId", wsLeagueAccess(false), websocket.New(handleDraftWS))
+	app.Get("/ws/chat/:leagueId", wsLeagueAccess(true), websocket.New(handleChatWS))
+	app.Get("/ws/league/:leagueId", wsLeagueAccess(false), websocket.New(handleLeagueWS))
 }
 
 func handleDraftWS(c *websocket.Conn) {
-	leagueID := 0
-	if id := c.Params("leagueId"); id != "" {
-		for _, ch := range id {
-			leagueID = leagueID*10 + int(ch-'0')
-		}
-	}
+	access := c.Locals("league_access").(*leagueAccess)
+	leagueID := access.LeagueID
 
 	room := getDraftRoom(leagueID)
 	room.mu.Lock()
-	room.clients[c] = 0 // TODO: extract user from query params
+	room.clients[c] = access.UserID
 	room.mu.Unlock()
 
 	defer func() {
@@ -197,13 +210,16 @@ func handleDraftWS(c *websocket.Conn) {
 		}
 
 		var payload struct {
-			Type    string `json:"type"`
-			MovieID int    `json:"movieId"`
-			UserID  int    `json:"userId"`
+			Type         string `json:"type"`
+			MovieID      int    `json:"movieId"`
+			MovieIDSnake int    `json:"movie_id"`
 		}
 		if err := json.Unmarshal(msg, &payload); err != nil {
 			continue
 		}
+		if payload.MovieID == 0 {
+			payload.MovieID = payload.MovieIDSnake
+		}
 
 		if payload.Type == "pick" && payload.MovieID > 0 {
 			var pickID, teamID int
@@ -216,7 +232,7 @@ func handleDraftWS(c *websocket.Conn) {
 			// Verify user owns team
 			var pickUserID int
 			db.QueryRow("SELECT user_id FROM teams WHERE id = ?", teamID).Scan(&pickUserID)
-			if pickUserID != payload.UserID {
+			if pickUserID != access.UserID {
 				c.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","message":"Not your turn"}`))
 				continue
 			}
@@ -228,6 +244,11 @@ func handleDraftWS(c *websocket.Conn) {
 				c.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","message":"Movie already drafted"}`))
 				continue
 			}
+			if err := checkRosterChange(db, teamID, []int{payload.MovieID}, nil); err != nil {
+				data, _ := json.Marshal(fiber.Map{"type": "error", "message": err.Error()})
+				c.WriteMessage(websocket.TextMessage, data)
+				continue
+			}
 
 			room.stopTimer()
 			room.executePick(pickID, teamID, payload.MovieID, false)
@@ -243,12 +264,8 @@ var (
 )
 
 func handleChatWS(c *websocket.Conn) {
-	leagueID := 0
-	if id := c.Params("leagueId"); id != "" {
-		for _, ch := range id {
-			leagueID = leagueID*10 + int(ch-'0')
-		}
-	}
+	access := c.Locals("league_access").(*leagueAccess)
+	leagueID := access.LeagueID
 
 	chatRoomsMu.Lock()
 	if chatRooms[leagueID] == nil {
@@ -271,7 +288,6 @@ func handleChatWS(c *websocket.Conn) {
 		}
 
 		var payload struct {
-			UserID  int    `json:"userId"`
 			Message string `json:"message"`
 		}
 		if err := json.Unmarshal(msg, &payload); err != nil || payload.Message == "" {
@@ -280,17 +296,17 @@ func handleChatWS(c *websocket.Conn) {
 
 		// Save to DB
 		res, err := db.Exec("INSERT INTO league_messages (league_id, user_id, message) VALUES (?, ?, ?)",
-			leagueID, payload.UserID, payload.Message)
+			leagueID, access.UserID, payload.Message)
 		if err != nil {
 			continue
 		}
 		msgID, _ := res.LastInsertId()
 
 		var displayName string
-		db.QueryRow("SELECT display_name FROM users WHERE id = ?", payload.UserID).Scan(&displayName)
+		db.QueryRow("SELECT display_name FROM users WHERE id = ?", access.UserID).Scan(&displayName)
 
 		broadcast := fiber.Map{
-			"type": "chat", "id": msgID, "user_id": payload.UserID,
+			"type": "chat", "id": msgID, "user_id": access.UserID,
 			"display_name": displayName, "message": payload.Message,
 			"created_at": time.Now().Format(time.RFC3339),
 		}
@@ -313,6 +329,51 @@ func broadcastChat(leagueID int, msg fiber.Map) {
 	}
 }
 
+// --- League Event WebSocket ---
+//
+// League events (waiver results and other league-wide changes) are pushed to
+// every client subscribed to the league. The stream is send-only.
+
+var (
+	leagueRooms   = make(map[int]map[*websocket.Conn]bool)
+	leagueRoomsMu sync.Mutex
+)
+
+func handleLeagueWS(c *websocket.Conn) {
+	access := c.Locals("league_access").(*leagueAccess)
+	leagueID := access.LeagueID
+
+	leagueRoomsMu.Lock()
+	if leagueRooms[leagueID] == nil {
+		leagueRooms[leagueID] = make(map[*websocket.Conn]bool)
+	}
+	leagueRooms[leagueID][c] = true
+	leagueRoomsMu.Unlock()
+
+	defer func() {
+		leagueRoomsMu.Lock()
+		delete(leagueRooms[leagueID], c)
+		leagueRoomsMu.Unlock()
+		c.Close()
+	}()
+
+	// Read until the client disconnects; incoming messages are ignored.
+	for {
+		if _, _, err := c.ReadMessage(); err != nil {
+			break
+		}
+	}
+}
+
+func broadcastLeagueEvent(leagueID int, event fiber.Map) {
+	data, _ := json.Marshal(event)
+	leagueRoomsMu.Lock()
+	defer leagueRoomsMu.Unlock()
+	for conn := range leagueRooms[leagueID] {
+		conn.WriteMessage(websocket.TextMessage, data)
+	}
+}
+
 func init() {
 	log.Println("WebSocket module loaded")
 }
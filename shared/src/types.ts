@@ -26,7 +26,9 @@ export interface Team {
   total_points: number;
 }
 
-export type MovieStatus = 'upcoming' | 'released' | 'free_agent';
+export type MovieStatus = 'upcoming' | 'released';
+
+export type MovieAvailability = 'free_agent' | 'on_waivers' | 'rostered';
 
 export interface Movie {
   id: number;
@@ -63,7 +65,7 @@ export interface DraftPick {
   team?: Team;
 }
 
-export type TradeStatus = 'pending' | 'accepted' | 'rejected';
+export type TradeStatus = 'pending' | 'accepted' | 'rejected' | 'invalid' | 'countered' | 'cancelled' | 'expired' | 'in_review' | 'vetoed';
 
 export interface Trade {
   id: number;
@@ -72,13 +74,27 @@ export interface Trade {
   receiver_team_id: number;
   status: TradeStatus;
   proposed_at: string;
+  note?: string;
+  expires_at?: string | null;
+  parent_trade_id?: number | null;
+  counter_trade_id?: number | null;
+  teams?: TradeTeam[];
   items?: TradeItem[];
 }
 
+export interface TradeTeam {
+  team_id: number;
+  team_name: string;
+  status: 'pending' | 'accepted' | 'rejected';
+  proposer: boolean;
+}
+
 export interface TradeItem {
   id: number;
   trade_id: number;
   team_id: number;
+  from_team_id: number;
+  to_team_id: number;
   movie_id: number;
   movie?: Movie;
 }
@@ -89,12 +105,17 @@ export interface WaiverClaim {
   team_id: number;
   movie_id: number;
   priority: number;
-  status: string;
+  status: WaiverClaimStatus;
+  bid: number;
+  drop_movie_id?: number | null;
+  result?: string;
   claimed_at: string;
   movie?: Movie;
 }
 
-export type TransactionType = 'draft' | 'waiver' | 'trade' | 'drop';
+export type WaiverClaimStatus = 'pending' | 'won' | 'lost' | 'failed' | 'cancelled';
+
+export type TransactionType = 'draft' | 'waiver' | 'trade' | 'drop' | 'trade_veto';
 
 export interface Transaction {
   id: number;
@@ -81,12 +81,28 @@ export interface SeasonRecord {
 }
 
 export interface SeasonWinner {
+  league_id: number;
+  league_name: string;
   season_year: number;
   team_name: string;
   owner: string;
+  user_id: number;
   total_points: number;
 }
 
+export interface CareerStats {
+  user_id: number;
+  display_name: string;
+  seasons: number;
+  titles: number;
+  average_finish: number;
+  best_finish: number;
+  total_points: number;
+  wins: number;
+  losses: number;
+  ties: number;
+}
+
 export const api = {
   // Auth
   register: (email: string, password: string, display_name: string) =>
@@ -102,11 +118,76 @@ export const api = {
   getLeagues: () => request<any[]>('/leagues'),
   createLeague: (data: any) => request<any>('/leagues', { method: 'POST', body: JSON.stringify(data) }),
   getLeague: (id: number) => request<any>(`/leagues/${id}`),
-  joinLeague: (id: number, team_name: string) =>
-    request<any>(`/leagues/${id}/join`, { method: 'POST', body: JSON.stringify({ team_name }) }),
+  updateLeague: (id: number, data: any) =>
+    request<any>(`/leagues/${id}`, { method: 'PATCH', body: JSON.stringify(data) }),
+  getLeagueSettingChanges: (id: number) => request<any[]>(`/leagues/${id}/settings/changes`),
+
+  // Commissioner tools
+  getLeagueAuditLog: (id: number) => request<any[]>(`/leagues/${id}/audit`),
+  getCommissioners: (id: number) => request<any[]>(`/leagues/${id}/commissioners`),
+  addCommissioner: (id: number, user: { user_id?: number; email?: string }) =>
+    request<any>(`/leagues/${id}/commissioners`, { method: 'POST', body: JSON.stringify(user) }),
+  removeCommissioner: (id: number, userId: number) =>
+    request<any>(`/leagues/${id}/commissioners/${userId}`, { method: 'DELETE' }),
+  transferLeague: (id: number, user: { user_id?: number; email?: string }) =>
+    request<any>(`/leagues/${id}/owner`, { method: 'POST', body: JSON.stringify(user) }),
+  removeTeamOwner: (teamId: number) => request<any>(`/teams/${teamId}/owner`, { method: 'DELETE' }),
+  assignTeamOwner: (teamId: number, user: { user_id?: number; email?: string }) =>
+    request<any>(`/teams/${teamId}/owner`, { method: 'PUT', body: JSON.stringify(user) }),
+  commissionerAddMovie: (teamId: number, movieId: number) =>
+    request<any>(`/teams/${teamId}/roster`, { method: 'POST', body: JSON.stringify({ movie_id: movieId }) }),
+  forceTrade: (id: number) => request<any>(`/trades/${id}/force`, { method: 'POST' }),
+  reverseTransaction: (leagueId: number, txId: number) =>
+    request<any>(`/leagues/${leagueId}/transactions/${txId}/reverse`, { method: 'POST' }),
+  joinLeague: (id: number, team_name: string, message?: string) =>
+    request<any>(`/leagues/${id}/join`, { method: 'POST', body: JSON.stringify({ team_name, message }) }),
+  withdrawJoinRequest: (id: number) => request<any>(`/leagues/${id}/join`, { method: 'DELETE' }),
+  getLeagueDirectory: (params?: {
+    search?: string; season_year?: number; min_size?: number; max_size?: number; open_spots?: number;
+    scoring_mode?: string; league_format?: string; draft_after?: string; draft_before?: string;
+    status?: string; sort?: string; limit?: number; offset?: number;
+  }) => {
+    const qs = new URLSearchParams(params as any).toString();
+    return request<any[]>(`/leagues/directory${qs ? '?' + qs : ''}`);
+  },
+  getMyJoinRequests: () => request<any[]>('/leagues/join-requests'),
+  getJoinRequests: (id: number, status = 'pending') => request<any[]>(`/leagues/${id}/join-requests?status=${status}`),
+  approveJoinRequest: (id: number, requestId: number) =>
+    request<any>(`/leagues/${id}/join-requests/${requestId}/approve`, { method: 'POST' }),
+  denyJoinRequest: (id: number, requestId: number, reason?: string) =>
+    request<any>(`/leagues/${id}/join-requests/${requestId}/deny`, { method: 'POST', body: JSON.stringify({ reason }) }),
   joinLeagueByCode: (code: string, team_name: string) =>
     request<any>(`/leagues/join/${code}`, { method: 'POST', body: JSON.stringify({ team_name }) }),
+  getInvitePreview: (code: string) => request<any>(`/leagues/join/${code}`),
+  getLeagueInvite: (id: number) => request<{ invite_code: string }>(`/leagues/${id}/invite`),
+  getLeagueInvites: (id: number, status = 'all') => request<any[]>(`/leagues/${id}/invites?status=${status}`),
+  createLeagueInvites: (id: number, data: { max_uses?: number; expires_in_hours?: number; expires_at?: string; emails?: string[]; message?: string }) =>
+    request<any[]>(`/leagues/${id}/invites`, { method: 'POST', body: JSON.stringify(data) }),
+  revokeLeagueInvite: (id: number, inviteId: number) =>
+    request<any>(`/leagues/${id}/invites/${inviteId}`, { method: 'DELETE' }),
   getStandings: (id: number) => request<any[]>(`/leagues/${id}/standings`),
+  getLeagueOdds: (id: number, params?: { simulations?: number; seed?: number }) => {
+    const qs = new URLSearchParams(params as any).toString();
+    return request<any>(`/leagues/${id}/odds${qs ? '?' + qs : ''}`);
+  },
+  getPowerRankings: (id: number) => request<any>(`/leagues/${id}/power-rankings`),
+  getLeagueArticles: (id: number, kind?: string) => {
+    const qs = kind ? `?kind=${encodeURIComponent(kind)}` : '';
+    return request<any[]>(`/leagues/${id}/articles${qs}`);
+  },
+  getLeagueArticle: (id: number, articleId: number) => request<any>(`/leagues/${id}/articles/${articleId}`),
+  publishRecap: (id: number, week?: number) =>
+    request<any>(`/leagues/${id}/articles/recap${week ? `?week=${week}` : ''}`, { method: 'POST' }),
+  getDivisionStandings: (id: number) => request<any[]>(`/leagues/${id}/standings?group=division`),
+  getDivisions: (id: number) => request<{ divisions: any[]; unassigned: any[] }>(`/leagues/${id}/divisions`),
+  createDivision: (id: number, data: { name: string; conference?: string }) =>
+    request<any>(`/leagues/${id}/divisions`, { method: 'POST', body: JSON.stringify(data) }),
+  updateDivision: (id: number, divisionId: number, data: { name?: string; conference?: string }) =>
+    request<any>(`/leagues/${id}/divisions/${divisionId}`, { method: 'PATCH', body: JSON.stringify(data) }),
+  deleteDivision: (id: number, divisionId: number) =>
+    request<any>(`/leagues/${id}/divisions/${divisionId}`, { method: 'DELETE' }),
+  assignDivision: (teamId: number, division_id: number | null) =>
+    request<any>(`/teams/${teamId}/division`, { method: 'PUT', body: JSON.stringify({ division_id }) }),
   getTransactions: (id: number) => request<any[]>(`/leagues/${id}/transactions`),
   getChatHistory: (id: number, limit = 50) => request<ChatMessage[]>(`/leagues/${id}/chat?limit=${limit}`),
 
@@ -131,6 +212,8 @@ export const api = {
   },
   getMovie: (id: number) => request<any>(`/movies/${id}`),
   getMovieProjections: (id: number) => request<MovieProjection>(`/movies/${id}/projections`),
+  getMovieProjection: (id: number) => request<any>(`/movies/${id}/projection`),
+  getProjectionModel: () => request<any>('/projections/model'),
 
   // Trades
   createTrade: (data: any) => request<any>('/trades', { method: 'POST', body: JSON.stringify(data) }),
@@ -143,11 +226,33 @@ export const api = {
   // Waivers
   claimWaiver: (data: any) => request<any>('/waivers/claim', { method: 'POST', body: JSON.stringify(data) }),
   getLeagueWaivers: (id: number) => request<any[]>(`/leagues/${id}/waivers`),
+  getFreeAgents: (leagueId: number, params?: { availability?: string; status?: string; search?: string; sort?: string; order?: string }) => {
+    const qs = new URLSearchParams(params as any).toString();
+    return request<any[]>(`/leagues/${leagueId}/free-agents${qs ? '?' + qs : ''}`);
+  },
+  dropMovie: (teamId: number, movieId: number) =>
+    request<any>(`/teams/${teamId}/roster/${movieId}`, { method: 'DELETE' }),
+
+  // Lineups
+  getTeamLineup: (teamId: number, week?: number) =>
+    request<any>(`/teams/${teamId}/lineup${week ? '?week=' + week : ''}`),
+  setTeamLineup: (teamId: number, movieIds: number[], week?: number) =>
+    request<any>(`/teams/${teamId}/lineup`, { method: 'PUT', body: JSON.stringify({ movie_ids: movieIds, week }) }),
+  getLeagueLineups: (leagueId: number, week?: number) =>
+    request<any>(`/leagues/${leagueId}/lineups${week ? '?week=' + week : ''}`),
+  getMatchups: (leagueId: number, week?: number) =>
+    request<any>(`/leagues/${leagueId}/matchups${week ? '?week=' + week : ''}`),
+  getPlayoffs: (leagueId: number) => request<any>(`/leagues/${leagueId}/playoffs`),
+  getLeagueResults: (leagueId: number) => request<any>(`/leagues/${leagueId}/results`),
 
   // Notifications
   getNotifications: () => request<AppNotification[]>('/notifications'),
   markNotificationRead: (id: number) => request<any>(`/notifications/${id}/read`, { method: 'PUT' }),
 
   // Season History
-  getSeasonHistory: () => request<{ winners: SeasonWinner[]; records: SeasonRecord[] }>('/seasons/history'),
+  getSeasonHistory: (params?: { league_id?: number; user_id?: number }) => {
+    const qs = new URLSearchParams(params as any).toString();
+    return request<{ lineage: number[]; winners: SeasonWinner[]; records: SeasonRecord[]; careers: CareerStats[]; seasons: any[] }>(
+      `/seasons/history${qs ? '?' + qs : ''}`);
+  },
 };
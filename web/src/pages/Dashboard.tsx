@@ -10,7 +10,7 @@ export default function Dashboard() {
   const [showJoin, setShowJoin] = useState(false);
   const currentYear = new Date().getFullYear();
   const [newLeague, setNewLeague] = useState({ name: '', season_year: currentYear, max_teams: 8, team_name: '', season_start: `${currentYear}-01-01`, season_end: `${currentYear}-12-31`, draft_rounds: 15 });
-  const [joinId, setJoinId] = useState('');
+  const [joinCode, setJoinCode] = useState('');
   const [joinTeamName, setJoinTeamName] = useState('');
   const { user } = useAuth();
   const navigate = useNavigate();
@@ -33,9 +33,11 @@ export default function Dashboard() {
   const handleJoin = async (e: React.FormEvent) => {
     e.preventDefault();
     try {
-      await api.joinLeague(parseInt(joinId), joinTeamName);
+      // Accept a pasted invite link as well as the bare code.
+      const code = joinCode.trim().replace(/\/+$/, '').split('/').pop() || '';
+      const result = await api.joinLeagueByCode(code, joinTeamName);
       setShowJoin(false);
-      loadLeagues();
+      navigate(`/league/${result.league_id}`);
     } catch {}
   };
 
@@ -76,7 +78,7 @@ export default function Dashboard() {
           <div className="modal" onClick={e => e.stopPropagation()}>
             <h2>Join League</h2>
             <form onSubmit={handleJoin}>
-              <input placeholder="League ID" value={joinId} onChange={e => setJoinId(e.target.value)} required />
+              <input placeholder="Invite Link or Code" value={joinCode} onChange={e => setJoinCode(e.target.value)} required />
               <input placeholder="Your Team Name" value={joinTeamName} onChange={e => setJoinTeamName(e.target.value)} />
               <button className="btn btn-primary" type="submit">Join</button>
             </form>
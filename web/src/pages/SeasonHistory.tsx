@@ -37,10 +37,10 @@ export default function SeasonHistory() {
         ) : (
           <div className="champions-list">
             {winners.map(w => (
-              <div key={w.season_year} className="champion-card">
+              <div key={w.league_id} className="champion-card">
                 <span className="trophy">🏆</span>
                 <div>
-                  <h3>{w.season_year} Champion</h3>
+                  <h3>{w.season_year} {w.league_name} Champion</h3>
                   <strong>{w.team_name}</strong>
                   <span>by {w.owner}</span>
                   <span className="pts">{w.total_points.toFixed(1)} pts</span>
@@ -9,8 +9,8 @@ export default function WaiverWire() {
   const [movies, setMovies] = useState<any[]>([]);
 
   useEffect(() => {
-    api.getMovies({ status: 'free_agent' }).then(setMovies);
-  }, []);
+    api.getFreeAgents(leagueId).then(setMovies);
+  }, [leagueId]);
 
   const handleClaim = async (movieId: number) => {
     try {